@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/client"
+)
+
+// uploadDir uploads every file under dir and returns their digests keyed by
+// slash separated path relative to dir, the form deployments take
+func uploadDir(ctx context.Context, c *client.Client, dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		b, err := c.UploadBlob(ctx, raw)
+		if err != nil {
+			return fmt.Errorf("failed to upload %s:%v", path, err)
+		}
+		files[filepath.ToSlash(rel)] = b.Digest
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file to upload in %s", dir)
+	}
+	return files, nil
+}
+
+// readManifest reads the digests of files as printed by "blobs push"
+func readManifest(file string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read files manifest %s:%v", file, err)
+	}
+	var files map[string]string
+	if err := json.Unmarshal(raw, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse files manifest %s:%v", file, err)
+	}
+	return files, nil
+}
+
+func printManifest(w io.Writer, files map[string]string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(files)
+}
+
+func addBlobsCmd(root *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "blobs",
+		Short: "Manage the files the server keeps by digest for deployments",
+	}
+	addBlobsListCmd(cmd)
+	addBlobsPushCmd(cmd)
+	addBlobsGetCmd(cmd)
+	addBlobsGCCmd(cmd)
+	root.AddCommand(cmd)
+}
+
+func blobTable(w io.Writer, blobs ...api.Blob) {
+	fmt.Fprintln(w, "DIGEST\tSIZE\tUPDATED\tDEPLOYMENTS")
+	for _, b := range blobs {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", b.Digest, b.Size, b.UpdatedAt.Local().Format(time.RFC3339), strings.Join(b.Refs, ","))
+	}
+}
+
+func addBlobsListCmd(root *cobra.Command) {
+	var opts clientOptions
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List stored blobs with the deployments referencing them",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			blobs, err := c.Blobs(ctx)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, blobs, func(w io.Writer) { blobTable(w, blobs...) })
+		},
+	}
+	opts.addFlags(cmd)
+	root.AddCommand(cmd)
+}
+
+func addBlobsPushCmd(root *cobra.Command) {
+	var opts clientOptions
+	cmd := &cobra.Command{
+		Use:   "push DIR",
+		Short: "Upload the files of a dir and print their digests",
+		Long: "Upload the files of a dir and print their digests as a JSON manifest, which\n" +
+			"\"deploy --files\" reads. Files already stored are not sent twice.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			files, err := uploadDir(ctx, c, args[0])
+			if err != nil {
+				return err
+			}
+			return printManifest(os.Stdout, files)
+		},
+	}
+	opts.addConnectionFlags(cmd)
+	root.AddCommand(cmd)
+}
+
+func addBlobsGetCmd(root *cobra.Command) {
+	var opts clientOptions
+	var output string
+	cmd := &cobra.Command{
+		Use:          "get DIGEST",
+		Short:        "Download a blob to stdout or a file",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			if output == "" {
+				return c.DownloadBlob(ctx, args[0], os.Stdout)
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			if err := c.DownloadBlob(ctx, args[0], f); err != nil {
+				f.Close()
+				os.Remove(output)
+				return err
+			}
+			return f.Close()
+		},
+	}
+	opts.addConnectionFlags(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write, stdout if empty")
+	root.AddCommand(cmd)
+}
+
+func addBlobsGCCmd(root *cobra.Command) {
+	var opts clientOptions
+	cmd := &cobra.Command{
+		Use:          "gc",
+		Short:        "Remove blobs no retained deployment references",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			result, err := c.CollectBlobs(ctx)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, result, func(w io.Writer) {
+				fmt.Fprintf(w, "Removed %d blobs, freed %d bytes\n", len(result.Removed), result.Freed)
+			})
+		},
+	}
+	opts.addFlags(cmd)
+	root.AddCommand(cmd)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/pki"
+)
+
+// defaultCertsDir holds the development CA and the certificates it issues
+const defaultCertsDir = "certs"
+
+func addCertsCmd(root *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "certs",
+		Short: "Manage a development CA and the certificates of servers and workers",
+		Long: `Manage a development CA and the certificates it issues to servers and
+workers. Certificates are good for serving and for dialing, so the same files
+serve TLS and authenticate to the other end. They plug into the tls section of
+the server config, with the CA as caFile to verify workers and clients.`,
+	}
+	addCertsInitCmd(cmd)
+	addCertsIssueCmd(cmd)
+	addCertsRenewCmd(cmd)
+	root.AddCommand(cmd)
+}
+
+// serverHosts are the names a server certificate is valid for by default
+func serverHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "localhost" {
+		hosts = append(hosts, name)
+	}
+	return hosts
+}
+
+func addCertsInitCmd(root *cobra.Command) {
+	var dir string
+	var hosts []string
+	var validity, caValidity time.Duration
+	var force bool
+	cmd := &cobra.Command{
+		Use:          "init",
+		Short:        "Create a CA and issue the certificate of the server",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ca, err := pki.Init(dir, caValidity, force)
+			if err != nil {
+				return err
+			}
+			if len(hosts) == 0 {
+				hosts = serverHosts()
+			}
+			issued, err := ca.Issue(pki.Request{Name: "server", Hosts: hosts, Validity: validity})
+			if err != nil {
+				return err
+			}
+			printIssued(issued)
+			caFile, _ := filepath.Abs(filepath.Join(dir, pki.CACertFile))
+			certFile, _ := filepath.Abs(issued.CertFile)
+			keyFile, _ := filepath.Abs(issued.KeyFile)
+			fmt.Printf("\nAdd to the server config:\n\ntls:\n  certFile: %s\n  keyFile: %s\n  caFile: %s\n", certFile, keyFile, caFile)
+			fmt.Printf("\nand to the client config:\n\ntls:\n  caFile: %s\n", caFile)
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&dir, "dir", defaultCertsDir, "Directory of the CA and certificates")
+	flags.StringSliceVar(&hosts, "host", nil, "DNS name or IP the server is reached at, may be repeated, defaults to localhost and the host name")
+	flags.DurationVar(&validity, "validity", pki.DefaultCertValidity, "How long the server certificate lasts")
+	flags.DurationVar(&caValidity, "ca-validity", pki.DefaultCAValidity, "How long the CA lasts")
+	flags.BoolVar(&force, "force", false, "Replace an existing CA, certificates it issued are no longer trusted")
+	root.AddCommand(cmd)
+}
+
+func addCertsIssueCmd(root *cobra.Command) {
+	var dir, worker string
+	var server bool
+	var hosts []string
+	var validity time.Duration
+	cmd := &cobra.Command{
+		Use:          "issue",
+		Short:        "Issue the certificate of a worker or the server, replacing the previous one",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (worker == "") == !server {
+				return fmt.Errorf("either --worker or --server is required")
+			}
+			ca, err := pki.Load(dir)
+			if err != nil {
+				return err
+			}
+			req := pki.Request{Name: "server", Hosts: hosts, Validity: validity}
+			if worker != "" {
+				req.Name = "worker-" + worker
+				req.Hosts = append([]string{worker}, hosts...)
+			} else if len(hosts) == 0 {
+				req.Hosts = serverHosts()
+			}
+			issued, err := ca.Issue(req)
+			if err != nil {
+				return err
+			}
+			printIssued(issued)
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&dir, "dir", defaultCertsDir, "Directory of the CA and certificates")
+	flags.StringVar(&worker, "worker", "", "Name of the worker, the certificate is valid for it as a host name")
+	flags.BoolVar(&server, "server", false, "Issue the certificate of the server")
+	flags.StringSliceVar(&hosts, "host", nil, "Other DNS name or IP the certificate is valid for, may be repeated")
+	flags.DurationVar(&validity, "validity", pki.DefaultCertValidity, "How long the certificate lasts")
+	root.AddCommand(cmd)
+}
+
+func addCertsRenewCmd(root *cobra.Command) {
+	var dir string
+	var within, validity time.Duration
+	cmd := &cobra.Command{
+		Use:   "renew",
+		Short: "Issue again the certificates expiring soon",
+		Long: `Issue again the certificates of the CA expiring within --within, with the same
+hosts and a new key. Send SIGHUP to servers to serve the renewed certificate
+without restarting.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ca, err := pki.Load(dir)
+			if err != nil {
+				return err
+			}
+			deadline := time.Now().Add(within)
+			if ca.Cert.NotAfter.Before(deadline) {
+				fmt.Fprintf(os.Stderr, "The CA expires on %s, certificates cannot outlast it; run certs init --force to replace it\n",
+					ca.Cert.NotAfter.Local().Format(time.RFC3339))
+			}
+			renewed, err := ca.Renew(deadline, validity)
+			for _, issued := range renewed {
+				printIssued(issued)
+			}
+			if err != nil {
+				return err
+			}
+			if len(renewed) == 0 {
+				fmt.Println("No certificate expires within", within)
+			}
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&dir, "dir", defaultCertsDir, "Directory of the CA and certificates")
+	flags.DurationVar(&within, "within", 30*24*time.Hour, "Renew certificates expiring within this long")
+	flags.DurationVar(&validity, "validity", pki.DefaultCertValidity, "How long renewed certificates last")
+	root.AddCommand(cmd)
+}
+
+func printIssued(issued *pki.Issued) {
+	fmt.Printf("Issued %s and %s for %v, expires %s\n", issued.CertFile, issued.KeyFile,
+		pki.Hosts(issued.Cert), issued.Cert.NotAfter.Local().Format(time.RFC3339))
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/client"
+	"github.com/beacon/deployer/pkg/spec"
+)
+
+// clientOptions are the flags shared by commands talking to a server
+type clientOptions struct {
+	configFile string
+	server     string
+	token      string
+	output     string
+}
+
+func (o *clientOptions) addFlags(cmd *cobra.Command) {
+	o.addConnectionFlags(cmd)
+	cmd.Flags().StringVarP(&o.output, "output", "o", "table", "Output format: table, json or yaml")
+}
+
+// addConnectionFlags adds the flags reaching the server only, for commands
+// which do not print API objects
+func (o *clientOptions) addConnectionFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&o.configFile, "client-config", "", "Client config file, defaults to "+client.DefaultConfigFile())
+	flags.StringVar(&o.server, "server", "", "Server host:port, overrides the client config")
+	flags.StringVar(&o.token, "token", "", "Access token, overrides the client config")
+}
+
+// client builds a client from the config file and flags
+func (o *clientOptions) client() (*client.Client, error) {
+	cfg := &client.Config{}
+	file := o.configFile
+	if file == "" {
+		file = client.DefaultConfigFile()
+		if _, err := os.Stat(file); err != nil {
+			file = ""
+		}
+	}
+	if file != "" {
+		loaded, err := client.LoadConfig(file)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+	if o.server != "" {
+		cfg.Server = o.server
+	}
+	if o.token != "" {
+		cfg.Token = o.token
+	}
+	return client.New(*cfg)
+}
+
+// print writes v in the selected format, table is the table form of v
+func (o *clientOptions) print(w io.Writer, v interface{}, table func(w io.Writer)) error {
+	switch o.output {
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		raw, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(raw)
+		return err
+	}
+	return fmt.Errorf("unknown output format %s", o.output)
+}
+
+func deploymentTable(w io.Writer, deployments ...*api.Deployment) {
+	fmt.Fprintln(w, "ID\tTARGET\tENV\tSTATE\tWORKERS\tUPDATED\tMESSAGE")
+	for _, d := range deployments {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.ID, d.Target, d.Env, d.State,
+			strings.Join(d.Workers, ","), d.UpdatedAt.Local().Format(time.RFC3339), d.Message)
+	}
+}
+
+// stepsTable lists the attempts of the steps every worker reported, in the
+// order of the spec
+func stepsTable(w io.Writer, d *api.Deployment) {
+	if d.Spec == nil || len(d.Steps) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nWORKER\tSTEP\tSTATE\tATTEMPTS\tMESSAGE")
+	for _, worker := range d.Workers {
+		for _, step := range d.Spec.Steps {
+			if status, ok := d.Steps[worker][step.Name]; ok {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\n", worker, step.Name, status.State, status.Attempts, step.Retries+1, status.Message)
+			}
+		}
+	}
+}
+
+// hooksTable lists the results of the hooks every worker ran
+func hooksTable(w io.Writer, d *api.Deployment) {
+	if len(d.HookResults) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nWORKER\tPHASE\tHOOK\tSTATE\tATTEMPTS\tMESSAGE")
+	for _, r := range d.HookResults {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", r.Worker, r.Phase, r.Name, r.State, r.Attempts, r.Message)
+	}
+}
+
+// signalContext is cancelled on SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(ch)
+	}()
+	return ctx, cancel
+}
+
+// parseValues merges values files and key=value overrides, dotted keys
+// set nested values
+func parseValues(files, sets []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file %s:%v", file, err)
+		}
+		var v map[string]interface{}
+		if err := yaml.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("failed to parse values file %s:%v", file, err)
+		}
+		mergeValues(values, v)
+	}
+	for _, set := range sets {
+		i := strings.Index(set, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid value %q, expected key=value", set)
+		}
+		var value interface{}
+		if err := yaml.Unmarshal([]byte(set[i+1:]), &value); err != nil || value == nil {
+			value = set[i+1:]
+		}
+		keys := strings.Split(set[:i], ".")
+		m := values
+		for _, k := range keys[:len(keys)-1] {
+			next, ok := m[k].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[k] = next
+			}
+			m = next
+		}
+		m[keys[len(keys)-1]] = value
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
+
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sv, ok := v.(map[string]interface{}); ok {
+			if dv, ok := dst[k].(map[string]interface{}); ok {
+				mergeValues(dv, sv)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// freezeOverride is the override of a --override-freeze reason, the server
+// records who asked for it
+func freezeOverride(reason string) *api.FreezeOverride {
+	if reason == "" {
+		return nil
+	}
+	return &api.FreezeOverride{By: os.Getenv("USER"), Reason: reason}
+}
+
+// lockOverride is the override of a --override-lock reason, the server
+// only accepts it from the owner of the lock
+func lockOverride(reason string) *api.LockOverride {
+	if reason == "" {
+		return nil
+	}
+	return &api.LockOverride{By: os.Getenv("USER"), Reason: reason}
+}
+
+// waitDeployment prints state changes until d ends and fails unless it
+// succeeded
+func waitDeployment(ctx context.Context, c *client.Client, d *api.Deployment) error {
+	last := d.State
+	d, err := c.WatchDeployment(ctx, d.ID, func(d *api.Deployment) error {
+		if d.State != last {
+			last = d.State
+			fmt.Fprintf(os.Stderr, "%s is %s\n", d.ID, d.State)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if d.State != api.DeploymentSucceeded {
+		return fmt.Errorf("deployment %s %s: %s", d.ID, d.State, d.Message)
+	}
+	return nil
+}
+
+func addDeployCmd(root *cobra.Command) {
+	var opts clientOptions
+	var env string
+	var workers, files, sets []string
+	var wait bool
+	var override, lockReason string
+	var selector map[string]string
+	var rollout api.Rollout
+	var verifyFile string
+	var autoRollback bool
+	var manifest, bundle string
+	var specFile string
+	var key string
+	cmd := &cobra.Command{
+		Use:   "deploy TARGET",
+		Short: "Deploy a target through a remote server",
+		Args:  cobra.ExactArgs(1),
+		// Failures come from the server, usage would only hide them
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := parseValues(files, sets)
+			if err != nil {
+				return err
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			action := api.Action{
+				Action:         api.ActionDeploy,
+				Target:         args[0],
+				Env:            env,
+				Workers:        workers,
+				Selector:       selector,
+				Values:         values,
+				FreezeOverride: freezeOverride(override),
+				LockOverride:   lockOverride(lockReason),
+			}
+			if len(rollout.Waves) > 0 {
+				action.Rollout = &rollout
+			}
+			if verifyFile != "" {
+				if action.Verify, err = readVerification(verifyFile); err != nil {
+					return err
+				}
+				action.Verify.AutoRollback = action.Verify.AutoRollback || autoRollback
+			} else if autoRollback {
+				return fmt.Errorf("--auto-rollback needs probes given with --verify")
+			}
+			switch {
+			case manifest != "" && bundle != "":
+				return fmt.Errorf("--files and --bundle are exclusive")
+			case manifest != "":
+				if action.Files, err = readManifest(manifest); err != nil {
+					return err
+				}
+			case bundle != "":
+				if action.Files, err = uploadDir(ctx, c, bundle); err != nil {
+					return err
+				}
+			}
+			if specFile != "" {
+				if action.Spec, err = spec.Load(specFile); err != nil {
+					return err
+				}
+			}
+			d, err := c.SubmitWithKey(ctx, key, action)
+			if err != nil {
+				return err
+			}
+			if err := opts.print(os.Stdout, d, func(w io.Writer) { deploymentTable(w, d) }); err != nil {
+				return err
+			}
+			if wait {
+				return waitDeployment(ctx, c, d)
+			}
+			return nil
+		},
+	}
+	opts.addFlags(cmd)
+	flags := cmd.Flags()
+	flags.StringVarP(&env, "env", "e", "", "Environment to deploy to")
+	flags.StringArrayVarP(&workers, "worker", "w", nil, "Worker to deploy on, may be repeated")
+	flags.StringToStringVarP(&selector, "selector", "l", nil, "Deploy on workers having these labels, such as role=web")
+	flags.StringSliceVar(&rollout.Waves, "waves", nil, "Roll out in waves of these sizes, such as 1,10%; the rest make a last wave")
+	flags.StringVar(&rollout.Pause, "pause", "", "Pause between waves, such as 10m")
+	flags.IntVar(&rollout.MaxFailures, "max-failures", 0, "Number of workers which may fail before the rollout stops")
+	flags.BoolVar(&rollout.Manual, "manual", false, "Wait for the rollout to be resumed after every wave")
+	flags.StringArrayVarP(&files, "values", "f", nil, "Values file in JSON/YAML format, may be repeated")
+	flags.StringArrayVar(&sets, "set", nil, "Override a value with key=value, dotted keys set nested values")
+	flags.BoolVar(&wait, "wait", false, "Wait for the deployment to end")
+	flags.StringVar(&override, "override-freeze", "", "Deploy despite freezes, for the reason given")
+	flags.StringVar(&lockReason, "override-lock", "", "Deploy despite the lock you own on the environment, for the reason given")
+	flags.StringVar(&verifyFile, "verify", "", "Probes in JSON/YAML format checking every worker after it deployed, run from the server")
+	flags.BoolVar(&autoRollback, "auto-rollback", false, "Roll back to the previous deployment if this one fails")
+	flags.StringVar(&manifest, "files", "", "JSON manifest of files by digest, as printed by blobs push, sent to workers")
+	flags.StringVar(&bundle, "bundle", "", "Upload the files of this dir and send them to workers")
+	flags.StringVar(&specFile, "spec", "", "Spec file in YAML/JSON format declaring the steps workers run")
+	flags.StringVar(&key, "idempotency-key", "", "Key making retries of this command return the deployment it created, such as the CI job ID")
+	root.AddCommand(cmd)
+}
+
+// readVerification reads probes from a file holding either a verification
+// or just a list of probes
+func readVerification(file string) (*api.Verification, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read probes file %s:%v", file, err)
+	}
+	v := &api.Verification{}
+	if err := yaml.Unmarshal(raw, v); err != nil {
+		if err := yaml.Unmarshal(raw, &v.Probes); err != nil {
+			return nil, fmt.Errorf("failed to parse probes file %s:%v", file, err)
+		}
+	}
+	return v, nil
+}
+
+func addStatusCmd(root *cobra.Command) {
+	var opts clientOptions
+	cmd := &cobra.Command{
+		Use:          "status [ID]",
+		Short:        "Show one deployment, or list all of them",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			if len(args) == 1 {
+				d, err := c.Deployment(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				return opts.print(os.Stdout, d, func(w io.Writer) {
+					deploymentTable(w, d)
+					if len(d.Resources) == 0 {
+						return
+					}
+					fmt.Fprintln(w, "\nWORKER\tRESOURCE\tSTATE")
+					for _, worker := range d.Workers {
+						names := make([]string, 0, len(d.Resources[worker]))
+						for name := range d.Resources[worker] {
+							names = append(names, name)
+						}
+						sort.Strings(names)
+						for _, name := range names {
+							fmt.Fprintf(w, "%s\t%s\t%s\n", worker, name, d.Resources[worker][name])
+						}
+					}
+					stepsTable(w, d)
+					hooksTable(w, d)
+				})
+			}
+			deployments, err := c.Deployments(ctx)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, deployments, func(w io.Writer) {
+				ds := make([]*api.Deployment, len(deployments))
+				for i := range deployments {
+					ds[i] = &deployments[i]
+				}
+				deploymentTable(w, ds...)
+			})
+		},
+	}
+	opts.addFlags(cmd)
+	root.AddCommand(cmd)
+}
+
+func addLogsCmd(root *cobra.Command) {
+	var opts clientOptions
+	var follow bool
+	cmd := &cobra.Command{
+		Use:          "logs ID",
+		Short:        "Print the log of a deployment",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			printEntry := func(e api.LogEntry) error {
+				if opts.output == "table" || opts.output == "" {
+					_, err := fmt.Printf("%s [%s] %s\n", e.Time.Local().Format(time.RFC3339), e.Source, e.Line)
+					return err
+				}
+				// One document per entry so that output can be streamed
+				return opts.print(os.Stdout, e, nil)
+			}
+			if follow {
+				err := c.FollowLogs(ctx, args[0], printEntry)
+				if err == context.Canceled {
+					return nil
+				}
+				return err
+			}
+			entries, err := c.Logs(ctx, args[0], 0)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if err := printEntry(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	opts.addFlags(cmd)
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing new lines until the deployment ends")
+	root.AddCommand(cmd)
+}
+
+func addCancelCmd(root *cobra.Command) {
+	var opts clientOptions
+	var reason string
+	cmd := &cobra.Command{
+		Use:          "cancel ID",
+		Short:        "Cancel a deployment which has not ended",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			d, err := c.Cancel(ctx, args[0], api.Review{By: os.Getenv("USER"), Comment: reason})
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, d, func(w io.Writer) { deploymentTable(w, d) })
+		},
+	}
+	opts.addFlags(cmd)
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the deployment is cancelled, kept in its log")
+	root.AddCommand(cmd)
+}
+
+func addRollbackCmd(root *cobra.Command) {
+	var opts clientOptions
+	var env string
+	var wait bool
+	var override, lockReason string
+	var key string
+	cmd := &cobra.Command{
+		Use:          "rollback TARGET",
+		Short:        "Deploy the previous successful deployment of a target again",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			d, err := c.SubmitWithKey(ctx, key, api.Action{
+				Action:         api.ActionRollback,
+				Target:         args[0],
+				Env:            env,
+				FreezeOverride: freezeOverride(override),
+				LockOverride:   lockOverride(lockReason),
+			})
+			if err != nil {
+				return err
+			}
+			if err := opts.print(os.Stdout, d, func(w io.Writer) { deploymentTable(w, d) }); err != nil {
+				return err
+			}
+			if wait {
+				return waitDeployment(ctx, c, d)
+			}
+			return nil
+		},
+	}
+	opts.addFlags(cmd)
+	flags := cmd.Flags()
+	flags.StringVarP(&env, "env", "e", "", "Environment to roll back")
+	flags.BoolVar(&wait, "wait", false, "Wait for the rollback to end")
+	flags.StringVar(&override, "override-freeze", "", "Roll back despite freezes, for the reason given")
+	flags.StringVar(&lockReason, "override-lock", "", "Roll back despite the lock you own on the environment, for the reason given")
+	flags.StringVar(&key, "idempotency-key", "", "Key making retries of this command return the rollback it created")
+	root.AddCommand(cmd)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/config"
+)
+
+// layersHelp documents where the server config comes from
+const layersHelp = `Every field of the config comes from, in increasing precedence:
+
+  1. its default
+  2. the config file, YAML, JSON or TOML if it ends in .toml
+  3. its DEPLOYER_* environment variable, such as DEPLOYER_LIMITS_MAX_BODY_BYTES
+     for limits.maxBodyBytes
+  4. flags, --addr, --mode, --data-dir and --set path=value
+
+The config file is optional, so that containers may be configured through
+environment variables only. Lists of strings are comma separated in variables
+and --set, other lists and maps are written in JSON or YAML, such as
+DEPLOYER_AUTH_TOKENS='[{"name":"ci","token":"..."}]'.
+Request limits are on by default, 20 requests per second with bursts of 40 per
+identity and 10MiB REST bodies among others. Set a limit to 0 to turn it off,
+such as --set limits.ratePerSecond=0.
+"deployer config show" lists every field with its variable.`
+
+// configOptions are the flags reading the server config, shared by the
+// commands running or inspecting a server
+type configOptions struct {
+	file    string
+	addr    string
+	mode    string
+	dataDir string
+	set     []string
+}
+
+func (o *configOptions) addFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVarP(&o.file, "config", "c", "", "Config file for deployer, YAML, JSON or TOML")
+	flags.StringVar(&o.addr, "addr", "", "Listen address, overrides addr")
+	flags.StringVar(&o.mode, "mode", "", "Mode, server or worker, overrides mode")
+	flags.StringVar(&o.dataDir, "data-dir", "", "Data directory, overrides dataDir")
+	flags.StringArrayVar(&o.set, "set", nil, "Set a config field as path=value, such as limits.burst=100, may be repeated")
+}
+
+// layers returns the layers of the config, only the flags given on the
+// command line override the other layers
+func (o *configOptions) layers(cmd *cobra.Command) (config.Layers, error) {
+	l := config.Layers{File: o.file, Env: os.Environ(), Flags: make(map[string]string)}
+	for _, kv := range o.set {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return l, fmt.Errorf("invalid --set %s, expected path=value", kv)
+		}
+		l.Flags[kv[:i]] = kv[i+1:]
+	}
+	flags := cmd.Flags()
+	for flag, path := range map[string]string{"addr": "addr", "mode": "mode", "data-dir": "dataDir"} {
+		if flags.Changed(flag) {
+			value, _ := flags.GetString(flag)
+			l.Flags[path] = value
+		}
+	}
+	return l, nil
+}
+
+// loadConfig reads and validates the config from its layers
+func loadConfig(l config.Layers) (*config.Config, config.Sources, error) {
+	cfg, sources, err := config.Load(l)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := config.Validate(cfg); err != nil {
+		return nil, nil, fmt.Errorf("invalid config:%v", err)
+	}
+	return cfg, sources, nil
+}
+
+func addConfigCmd(root *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the server config",
+		Long:  layersHelp,
+	}
+	addConfigShowCmd(cmd)
+	addConfigValidateCmd(cmd)
+	addConfigSchemaCmd(cmd)
+	root.AddCommand(cmd)
+}
+
+func addConfigShowCmd(root *cobra.Command) {
+	var opts configOptions
+	var output clientOptions
+	cmd := &cobra.Command{
+		Use:          "show",
+		Short:        "Print the effective server config and where every value came from",
+		Long:         layersHelp,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l, err := opts.layers(cmd)
+			if err != nil {
+				return err
+			}
+			cfg, sources, err := config.Load(l)
+			if err != nil {
+				return err
+			}
+			values := config.Describe(cfg, sources)
+			return output.print(os.Stdout, values, func(w io.Writer) { configTable(w, values) })
+		},
+	}
+	opts.addFlags(cmd)
+	cmd.Flags().StringVarP(&output.output, "output", "o", "table", "Output format: table, json or yaml")
+	root.AddCommand(cmd)
+}
+
+func addConfigValidateCmd(root *cobra.Command) {
+	var opts configOptions
+	var output clientOptions
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the server config and report every problem found",
+		Long: `Check the server config read from the same layers as "deployer run" and
+report every problem at once: unknown or mistyped fields of the config file,
+variables and flags which do not parse and fields failing validation. Problems
+with fields of the file mention their line.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l, err := opts.layers(cmd)
+			if err != nil {
+				return err
+			}
+			problems, err := config.Check(l)
+			if err != nil {
+				return err
+			}
+			if output.output != "table" || len(problems) > 0 {
+				if problems == nil {
+					problems = config.Problems{}
+				}
+				if err := output.print(os.Stdout, problems, func(w io.Writer) { problemsTable(w, opts.file, problems) }); err != nil {
+					return err
+				}
+			}
+			switch len(problems) {
+			case 0:
+			case 1:
+				return fmt.Errorf("found a problem in the config")
+			default:
+				return fmt.Errorf("found %d problems in the config", len(problems))
+			}
+			if output.output == "table" {
+				fmt.Println("The config is valid")
+			}
+			return nil
+		},
+	}
+	opts.addFlags(cmd)
+	cmd.Flags().StringVarP(&output.output, "output", "o", "table", "Output format: table, json or yaml")
+	root.AddCommand(cmd)
+}
+
+func addConfigSchemaCmd(root *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of config files",
+		Long: `Print the JSON Schema of config files, for editors to complete fields and
+CI to lint config files.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(config.Schema())
+		},
+	}
+	root.AddCommand(cmd)
+}
+
+// problemsTable lists problems the way compilers do, file:line: message
+func problemsTable(w io.Writer, file string, problems config.Problems) {
+	for _, p := range problems {
+		switch {
+		case p.Line > 0:
+			fmt.Fprintf(w, "%s:%d: ", file, p.Line)
+		case p.Path == "" && file != "":
+			fmt.Fprintf(w, "%s: ", file)
+		}
+		p.Line = 0
+		fmt.Fprintln(w, p)
+	}
+}
+
+func configTable(w io.Writer, values []config.Value) {
+	fmt.Fprintln(w, "FIELD\tVALUE\tSOURCE\tENV")
+	for _, v := range values {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.Path, configValue(v.Value), v.Source, v.Env)
+	}
+}
+
+// configValue formats a value as it would be written in a variable, lists
+// and maps in JSON
+func configValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+func formatValue(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
+
+func printChanges(w io.Writer, indent string, changes []api.ValueChange) {
+	for _, c := range changes {
+		path := c.Path
+		if path == "" {
+			path = "."
+		}
+		switch c.Kind {
+		case api.ChangeAdded:
+			fmt.Fprintf(w, "%s+ %s: %s\n", indent, path, formatValue(c.To))
+		case api.ChangeRemoved:
+			fmt.Fprintf(w, "%s- %s: %s\n", indent, path, formatValue(c.From))
+		default:
+			fmt.Fprintf(w, "%s~ %s: %s -> %s\n", indent, path, formatValue(c.From), formatValue(c.To))
+		}
+	}
+}
+
+// printDiff writes the values and steps changed, then the unified diff of
+// every file followed by its semantic changes
+func printDiff(w io.Writer, d *api.Diff) {
+	from := d.From
+	if from == "" {
+		from = "nothing"
+	}
+	fmt.Fprintf(w, "Changes from %s to %s\n", from, d.To)
+	if len(d.Values) == 0 && len(d.Spec) == 0 && len(d.Files) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+	if len(d.Values) > 0 {
+		fmt.Fprintln(w, "\nValues:")
+		printChanges(w, "  ", d.Values)
+	}
+	if len(d.Spec) > 0 {
+		fmt.Fprintln(w, "\nSpec:")
+		printChanges(w, "  ", d.Spec)
+	}
+	for _, f := range d.Files {
+		fmt.Fprintf(w, "\n%s %s\n", f.Kind, f.Path)
+		switch {
+		case f.TooLarge:
+			fmt.Fprintf(w, "Files %s and %s are too large to compare\n", f.FromDigest, f.ToDigest)
+			continue
+		case f.Binary:
+			fmt.Fprintf(w, "Binary files %s and %s differ\n", f.FromDigest, f.ToDigest)
+			continue
+		case f.Unified != "":
+			fmt.Fprint(w, f.Unified)
+		}
+		if f.Semantic {
+			if len(f.Changes) == 0 {
+				fmt.Fprintln(w, "Same content, only key order or formatting changed")
+			} else {
+				fmt.Fprintln(w, "Semantic changes:")
+				printChanges(w, "  ", f.Changes)
+			}
+		}
+	}
+}
+
+func addDiffCmd(root *cobra.Command) {
+	var opts clientOptions
+	cmd := &cobra.Command{
+		Use:   "diff REV_A [REV_B]",
+		Short: "Show the values and files changing from one deployment to another",
+		Long: "Show the values and files changing from deployment REV_A to deployment REV_B.\n" +
+			"With REV_A only, show what REV_A changes compared with the deployment running\n" +
+			"before it, such as what a deployment awaiting approval would change.\n" +
+			"Files are compared as uploaded with the deployments, not as workers write them\n" +
+			"with secrets, and files over 1 MiB are only reported as changed.",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			id, against := args[0], ""
+			if len(args) == 2 {
+				id, against = args[1], args[0]
+			}
+			d, err := c.Diff(ctx, id, against)
+			if err != nil {
+				return err
+			}
+			if opts.output == "table" || opts.output == "" {
+				// A tabwriter would realign the tabs of the files
+				printDiff(os.Stdout, d)
+				return nil
+			}
+			return opts.print(os.Stdout, d, nil)
+		},
+	}
+	opts.addFlags(cmd)
+	root.AddCommand(cmd)
+}
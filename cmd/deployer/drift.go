@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+func driftTable(w io.Writer, list ...api.Drift) {
+	fmt.Fprintln(w, "WORKER\tTARGET\tENV\tEXPECTED\tOBSERVED\tDRIFTED\tSINCE\tDETAILS")
+	for _, d := range list {
+		since := ""
+		if d.Since != nil {
+			since = d.Since.Local().Format(time.RFC3339)
+		}
+		var details []string
+		for _, f := range d.Files {
+			details = append(details, f.Path+" "+f.Kind)
+		}
+		for _, c := range d.Checks {
+			details = append(details, c.Name+": "+c.Message)
+		}
+		if d.Reconciliation != "" {
+			details = append(details, "reconciled by "+d.Reconciliation)
+		}
+		if d.ReconcileError != "" {
+			details = append(details, "reconcile failed: "+d.ReconcileError)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\t%s\n", d.Worker, d.Target, d.Env, d.Expected, d.Observed,
+			d.Drifted, since, strings.Join(details, ", "))
+	}
+}
+
+func addDriftCmd(root *cobra.Command) {
+	var opts clientOptions
+	var drifted bool
+	cmd := &cobra.Command{
+		Use:          "drift",
+		Short:        "Show whether workers still hold what their last successful deployment left",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			list, err := c.Drift(ctx, drifted)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, list, func(w io.Writer) { driftTable(w, list...) })
+		},
+	}
+	opts.addFlags(cmd)
+	cmd.Flags().BoolVar(&drifted, "drifted", false, "Only show workers which drifted")
+	root.AddCommand(cmd)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+func locksTable(w io.Writer, locks ...api.Lock) {
+	fmt.Fprintln(w, "ENV\tOWNER\tMODE\tSINCE\tREASON")
+	for _, l := range locks {
+		mode := l.Mode
+		if mode == "" {
+			mode = api.LockHold
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", l.Env, l.Owner, mode, l.CreatedAt.Local().Format(time.RFC3339), l.Reason)
+	}
+}
+
+func addLockCmd(root *cobra.Command) {
+	var opts clientOptions
+	var lock api.Lock
+	cmd := &cobra.Command{
+		Use:          "lock",
+		Short:        "Lock an environment, only its owner may deploy to it until it is unlocked",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			created, err := c.Lock(ctx, lock)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, created, func(w io.Writer) { locksTable(w, *created) })
+		},
+	}
+	opts.addFlags(cmd)
+	flags := cmd.Flags()
+	flags.StringVarP(&lock.Env, "env", "e", "", "Environment to lock")
+	flags.StringVar(&lock.Reason, "reason", "", "Why the environment is locked")
+	flags.StringVar(&lock.Mode, "mode", api.LockHold, "hold keeps deployments pending until unlocked, refuse rejects them")
+	flags.StringVar(&lock.Owner, "owner", os.Getenv("USER"), "Owner of the lock, the server sets it when it authenticates callers")
+	root.AddCommand(cmd)
+}
+
+func addUnlockCmd(root *cobra.Command) {
+	var opts clientOptions
+	var env string
+	var force bool
+	cmd := &cobra.Command{
+		Use:          "unlock",
+		Short:        "Unlock an environment",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			return c.Unlock(ctx, env, os.Getenv("USER"), force)
+		},
+	}
+	opts.addConnectionFlags(cmd)
+	flags := cmd.Flags()
+	flags.StringVarP(&env, "env", "e", "", "Environment to unlock")
+	flags.BoolVar(&force, "force", false, "Unlock even if someone else owns the lock")
+	root.AddCommand(cmd)
+}
+
+func addLocksCmd(root *cobra.Command) {
+	var opts clientOptions
+	cmd := &cobra.Command{
+		Use:          "locks",
+		Short:        "List locked environments",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			locks, err := c.Locks(ctx)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, locks, func(w io.Writer) { locksTable(w, locks...) })
+		},
+	}
+	opts.addFlags(cmd)
+	root.AddCommand(cmd)
+}
+
+// parseSince reads a time either in RFC 3339 or as how long ago
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, expected a duration or an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+func auditTable(w io.Writer, entries ...api.AuditEntry) {
+	fmt.Fprintln(w, "TIME\tACTOR\tACTION\tSUBJECT\tDETAIL")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.RFC3339), e.Actor, e.Action, e.Subject, e.Detail)
+	}
+}
+
+func addAuditCmd(root *cobra.Command) {
+	var opts clientOptions
+	var since string
+	var limit int
+	cmd := &cobra.Command{
+		Use:          "audit",
+		Short:        "Show the audit log of locks, freezes and their overrides",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := parseSince(since)
+			if err != nil {
+				return err
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			entries, err := c.Audit(ctx, t, limit)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, entries, func(w io.Writer) { auditTable(w, entries...) })
+		},
+	}
+	opts.addFlags(cmd)
+	flags := cmd.Flags()
+	flags.StringVar(&since, "since", "", "Only show entries since this time, such as 24h or 2024-01-02T15:04:05Z")
+	flags.IntVar(&limit, "limit", 0, "Show at most this many of the last entries, up to 1000, the server picks if zero")
+	root.AddCommand(cmd)
+}
@@ -1,51 +1,132 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/beacon/deployer/pkg/blob"
 	"github.com/beacon/deployer/pkg/config"
 	"github.com/beacon/deployer/pkg/render"
+	"github.com/beacon/deployer/pkg/secrets"
 	"github.com/beacon/deployer/pkg/server"
+	"github.com/beacon/deployer/pkg/store"
 
 	"github.com/spf13/cobra"
 )
 
 var cfg *config.Config
 
+// reloadConfig applies the config layers to a running server, an invalid
+// config leaves the running one as it is
+func reloadConfig(srv *server.Server, l config.Layers) {
+	cfg, _, err := loadConfig(l)
+	if err != nil {
+		log.Println("Failed to reload config, keeping the running one:", err)
+		return
+	}
+	restart, err := srv.Reload(cfg)
+	if err != nil {
+		log.Println("Failed to reload config, keeping the running one:", err)
+		return
+	}
+	if len(restart) > 0 {
+		log.Println("Changes to", strings.Join(restart, ", "), "are not applied until the server restarts")
+	}
+}
+
 func addRunCmd(root *cobra.Command) {
-	var configFile string
+	var configOpts configOptions
+	var watch time.Duration
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Run deployer in server/worker mode",
+		Long:  layersHelp,
+		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.New(configFile)
+			layers, err := configOpts.layers(cmd)
 			if err != nil {
 				return err
 			}
-			flags := cmd.Flags()
-			flags.StringVar(&cfg.Addr, "addr", "", "Listen port")
-			if err := flags.Parse(args); err != nil {
-				return err
-			}
-			if err := config.Validate(cfg); err != nil {
+			cfg, _, err := loadConfig(layers)
+			if err != nil {
 				return err
 			}
 
-			ch := make(chan os.Signal)
+			ch := make(chan os.Signal, 1)
 			signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+			reload := make(chan struct{}, 1)
 			switch cfg.Mode {
 			case "server":
-				srv := server.New(cfg)
+				st, err := store.Open(cfg.DataDir)
+				if err != nil {
+					return err
+				}
+				opts := []server.Option{server.WithStore(st)}
+				if cfg.Secrets != nil {
+					key, err := secrets.LoadKey(cfg.Secrets.KeyFile)
+					if err != nil {
+						return err
+					}
+					box, err := secrets.NewBox(key)
+					if err != nil {
+						return err
+					}
+					opts = append(opts, server.WithSecrets(box))
+				}
+				if cfg.Blobs != nil {
+					dir := cfg.Blobs.Dir
+					if dir == "" && cfg.DataDir != "" {
+						dir = filepath.Join(cfg.DataDir, "blobs")
+					}
+					if dir == "" {
+						return fmt.Errorf("blobs need either blobs.dir or dataDir")
+					}
+					bs, err := blob.New(dir)
+					if err != nil {
+						return err
+					}
+					opts = append(opts, server.WithBlobs(bs))
+				}
+				srv := server.New(cfg, opts...)
 				go func() {
-					if srv.ListenAndServe(cfg); err != nil {
+					if err := srv.ListenAndServe(cfg); err != nil {
 						log.Println("Server closed:", err)
 					}
 				}()
 				defer srv.Shutdown()
+
+				// Reloading keeps streams to workers open, unlike restarting
+				hup := make(chan os.Signal, 1)
+				signal.Notify(hup, syscall.SIGHUP)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				go func() {
+					for {
+						select {
+						case <-ctx.Done():
+							return
+						case <-hup:
+							log.Println("Received SIGHUP, reloading config")
+						case <-reload:
+						}
+						reloadConfig(srv, layers)
+					}
+				}()
+				if watch > 0 && configOpts.file != "" {
+					go config.Watch(ctx, configOpts.file, watch, func() {
+						select {
+						case reload <- struct{}{}:
+						default:
+						}
+					})
+				}
 			case "worker":
 				// TODO: run worker
 			default:
@@ -55,8 +136,8 @@ func addRunCmd(root *cobra.Command) {
 			return nil
 		},
 	}
-	flags := cmd.Flags()
-	flags.StringVarP(&configFile, "config", "c", "", "Config file for deployer")
+	configOpts.addFlags(cmd)
+	cmd.Flags().DurationVar(&watch, "watch", 0, "Check the config file for changes this often and reload it, such as 5s; SIGHUP reloads it as well")
 	root.AddCommand(cmd)
 }
 
@@ -64,16 +145,58 @@ func addRenderCmd(root *cobra.Command) {
 	var output string
 	var input []string
 	var file string
+	var opts clientOptions
+	var project, env string
+	var upload bool
+	var specFile string
 	cmd := &cobra.Command{
 		Use:       "render",
 		Short:     "Render some files with given grammer",
 		ValidArgs: []string{"output", "input", "file"},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log.Println("Args:", args)
-			return render.Execute(nil, file, output, input...)
+			if specFile != "" {
+				if err := preRender(specFile); err != nil {
+					return err
+				}
+			}
+			if project == "" && !upload {
+				return render.Execute(nil, file, output, input...)
+			}
+			if project != "" && upload {
+				// Blobs are stored in clear, anyone may download them
+				return fmt.Errorf("files rendered with secrets are not uploaded, workers render them instead")
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			if upload {
+				if err := render.Execute(nil, file, output, input...); err != nil {
+					return err
+				}
+				files, err := uploadDir(ctx, c, output)
+				if err != nil {
+					return err
+				}
+				return printManifest(os.Stdout, files)
+			}
+			values, err := c.SecretValues(ctx, project, env)
+			if err != nil {
+				return err
+			}
+			return render.ExecuteWithSecrets(nil, values, file, output, input...)
 		},
 	}
+	opts.addConnectionFlags(cmd)
 	flags := cmd.Flags()
+	flags.StringVar(&project, "project", "", "Read secrets of this project from the server")
+	flags.StringVarP(&env, "env", "e", "", "Environment whose secrets are read")
+	flags.StringVar(&specFile, "spec", "", "Spec file whose pre-render hooks run before rendering")
+	flags.BoolVar(&upload, "upload", false, "Upload the rendered files to the server and print their digests, for deploy --files")
 	flags.StringArrayVarP(&input, "input", "i", nil, "Input files, can be either file or directory")
 	flags.StringVarP(&output, "output", "o", "", "Output dir for rendered files")
 	flags.StringVarP(&file, "file", "f", "", "File containing input values, should be either in JSON/YAML format")
@@ -86,6 +209,24 @@ func main() {
 	}
 	addRunCmd(rootCmd)
 	addRenderCmd(rootCmd)
+	addDeployCmd(rootCmd)
+	addStatusCmd(rootCmd)
+	addLogsCmd(rootCmd)
+	addCancelCmd(rootCmd)
+	addRollbackCmd(rootCmd)
+	addSecretsCmd(rootCmd)
+	addPipelinesCmd(rootCmd)
+	addPromoteCmd(rootCmd)
+	addBlobsCmd(rootCmd)
+	addDiffCmd(rootCmd)
+	addDriftCmd(rootCmd)
+	addSpecCmd(rootCmd)
+	addLockCmd(rootCmd)
+	addUnlockCmd(rootCmd)
+	addLocksCmd(rootCmd)
+	addAuditCmd(rootCmd)
+	addConfigCmd(rootCmd)
+	addCertsCmd(rootCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatalln("Failed to execute deployer:", err)
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+func pipelineTable(w io.Writer, pipelines ...api.Pipeline) {
+	fmt.Fprintln(w, "PIPELINE\tENV\tDEPLOYMENT\tSTATE\tARTIFACT\tSOAK\tBLOCKED")
+	for _, p := range pipelines {
+		for _, stage := range p.Stages {
+			artifact := stage.Artifact
+			if len(artifact) > 19 {
+				artifact = artifact[:19]
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.Name, stage.Env, stage.Deployment, stage.State,
+				artifact, stage.Soak, stage.Blocked)
+		}
+	}
+}
+
+func addPipelinesCmd(root *cobra.Command) {
+	var opts clientOptions
+	cmd := &cobra.Command{
+		Use:          "pipelines [NAME]",
+		Short:        "Show pipelines with what every stage runs",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			if len(args) == 1 {
+				p, err := c.Pipeline(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				return opts.print(os.Stdout, p, func(w io.Writer) { pipelineTable(w, *p) })
+			}
+			pipelines, err := c.Pipelines(ctx)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, pipelines, func(w io.Writer) { pipelineTable(w, pipelines...) })
+		},
+	}
+	opts.addFlags(cmd)
+	root.AddCommand(cmd)
+}
+
+func addPromoteCmd(root *cobra.Command) {
+	var opts clientOptions
+	var promotion api.Promotion
+	var wait bool
+	var override, lockReason string
+	cmd := &cobra.Command{
+		Use:          "promote PIPELINE",
+		Short:        "Deploy what a stage of a pipeline runs to the next stage",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (promotion.From == "") == (promotion.Deployment == "") {
+				return fmt.Errorf("either --from or --deployment is required")
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			promotion.FreezeOverride = freezeOverride(override)
+			promotion.LockOverride = lockOverride(lockReason)
+			d, err := c.Promote(ctx, args[0], promotion)
+			if err != nil {
+				return err
+			}
+			if err := opts.print(os.Stdout, d, func(w io.Writer) { deploymentTable(w, d) }); err != nil {
+				return err
+			}
+			if wait {
+				return waitDeployment(ctx, c, d)
+			}
+			return nil
+		},
+	}
+	opts.addFlags(cmd)
+	flags := cmd.Flags()
+	flags.StringVar(&promotion.From, "from", "", "Stage whose current deployment is promoted")
+	flags.StringVar(&promotion.Deployment, "deployment", "", "Deployment to promote")
+	flags.BoolVar(&wait, "wait", false, "Wait for the promoted deployment to end")
+	flags.StringVar(&override, "override-freeze", "", "Promote despite freezes, for the reason given")
+	flags.StringVar(&lockReason, "override-lock", "", "Promote despite the lock you own on the next stage, for the reason given")
+	root.AddCommand(cmd)
+}
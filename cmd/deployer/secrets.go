@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/secrets"
+)
+
+func addSecretsCmd(root *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage secrets the server keeps encrypted for projects",
+	}
+	addSecretsKeygenCmd(cmd)
+	addSecretsListCmd(cmd)
+	addSecretsSetCmd(cmd)
+	addSecretsDeleteCmd(cmd)
+	root.AddCommand(cmd)
+}
+
+func addSecretsKeygenCmd(root *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Print a new key for the secrets.keyFile of the server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := secrets.GenerateKey()
+			if err != nil {
+				return err
+			}
+			fmt.Println(key)
+			return nil
+		},
+	}
+	root.AddCommand(cmd)
+}
+
+func secretTable(w io.Writer, list ...api.Secret) {
+	fmt.Fprintln(w, "PROJECT\tENV\tNAME\tUPDATED BY\tUPDATED")
+	for _, s := range list {
+		env := s.Env
+		if env == "" {
+			env = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Project, env, s.Name, s.UpdatedBy, s.UpdatedAt.Local().Format(time.RFC3339))
+	}
+}
+
+func addSecretsListCmd(root *cobra.Command) {
+	var opts clientOptions
+	var env string
+	cmd := &cobra.Command{
+		Use:          "list PROJECT",
+		Short:        "List the secrets of a project, values are never shown",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			list, err := c.Secrets(ctx, args[0], env)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, list, func(w io.Writer) { secretTable(w, list...) })
+		},
+	}
+	opts.addFlags(cmd)
+	cmd.Flags().StringVarP(&env, "env", "e", "", "Only list secrets applying to this environment")
+	root.AddCommand(cmd)
+}
+
+func addSecretsSetCmd(root *cobra.Command) {
+	var opts clientOptions
+	var env, file string
+	cmd := &cobra.Command{
+		Use:   "set PROJECT NAME",
+		Short: "Set a secret, its value is read from --from-file or stdin",
+		Long: "Set a secret, its value is read from --from-file or stdin so that it stays out of\n" +
+			"the shell history. A secret without --env applies to every environment.",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw []byte
+			var err error
+			if file != "" {
+				raw, err = ioutil.ReadFile(file)
+			} else {
+				raw, err = ioutil.ReadAll(os.Stdin)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read secret value:%v", err)
+			}
+			value := string(raw)
+			if file == "" {
+				// echo adds a newline nobody means to keep
+				value = strings.TrimSuffix(value, "\n")
+			}
+			if value == "" {
+				return fmt.Errorf("secret value is empty")
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			secret, err := c.SetSecret(ctx, args[0], env, args[1], value)
+			if err != nil {
+				return err
+			}
+			return opts.print(os.Stdout, secret, func(w io.Writer) { secretTable(w, *secret) })
+		},
+	}
+	opts.addFlags(cmd)
+	flags := cmd.Flags()
+	flags.StringVarP(&env, "env", "e", "", "Environment the secret is for, every one if empty")
+	flags.StringVar(&file, "from-file", "", "Read the value from this file, kept as is")
+	root.AddCommand(cmd)
+}
+
+func addSecretsDeleteCmd(root *cobra.Command) {
+	var opts clientOptions
+	var env string
+	cmd := &cobra.Command{
+		Use:          "delete PROJECT NAME",
+		Short:        "Delete a secret",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			ctx, cancel := signalContext()
+			defer cancel()
+			return c.DeleteSecret(ctx, args[0], env, args[1])
+		},
+	}
+	opts.addConnectionFlags(cmd)
+	cmd.Flags().StringVarP(&env, "env", "e", "", "Environment of the secret")
+	root.AddCommand(cmd)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/spec"
+)
+
+// preRender runs the pre-render hooks of a spec file where files are
+// rendered
+func preRender(file string) error {
+	s, err := spec.Load(file)
+	if err != nil {
+		return err
+	}
+	if s.Hooks == nil || len(s.Hooks.PreRender) == 0 {
+		return nil
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+	runner := &spec.Runner{Executors: spec.DefaultExecutors(), Logf: log.Printf}
+	return runner.RunHooks(ctx, api.HookPreRender, s.Hooks.PreRender)
+}
+
+func addSpecCmd(root *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "spec",
+		Short: "Check the spec files declaring the steps of deployments",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:          "validate FILE",
+		Short:        "Validate a spec file and print the order its steps run in",
+		Long:         "Validate a spec file and print its steps by stage, the steps of a stage\nrun in parallel once the ones of the previous stages succeeded.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := spec.Load(args[0])
+			if err != nil {
+				return err
+			}
+			for i, names := range spec.Levels(s) {
+				fmt.Fprintf(os.Stdout, "%d: %s\n", i+1, strings.Join(names, ", "))
+			}
+			for _, phase := range spec.Phases(s.Hooks) {
+				if len(phase.Hooks) == 0 {
+					continue
+				}
+				names := make([]string, len(phase.Hooks))
+				for i, hook := range phase.Hooks {
+					names[i] = hook.Name
+				}
+				fmt.Fprintf(os.Stdout, "%s hooks: %s\n", phase.Name, strings.Join(names, ", "))
+			}
+			return nil
+		},
+	})
+	root.AddCommand(cmd)
+}
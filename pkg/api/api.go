@@ -0,0 +1,620 @@
+// Package api defines the resources exchanged over the deployer REST API
+package api
+
+import (
+	"time"
+
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+// DeploymentState is the lifecycle state of a deployment
+type DeploymentState string
+
+const (
+	DeploymentAwaitingApproval DeploymentState = "awaiting_approval"
+	DeploymentPending          DeploymentState = "pending"
+	DeploymentRunning          DeploymentState = "running"
+	DeploymentSucceeded        DeploymentState = "succeeded"
+	DeploymentFailed           DeploymentState = "failed"
+	DeploymentCancelled        DeploymentState = "cancelled"
+)
+
+// Terminal reports whether no further transition can happen
+func (s DeploymentState) Terminal() bool {
+	switch s {
+	case DeploymentSucceeded, DeploymentFailed, DeploymentCancelled:
+		return true
+	}
+	return false
+}
+
+// Deployment of a target to a set of workers
+type Deployment struct {
+	ID      string                 `json:"id"`
+	Target  string                 `json:"target"`
+	Env     string                 `json:"env,omitempty"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+	Workers []string               `json:"workers"`
+
+	State   DeploymentState `json:"state"`
+	Message string          `json:"message,omitempty"`
+	// Resources reported by each worker, keyed by worker then resource
+	Resources map[string]map[string]pb.ResourceState `json:"resources,omitempty"`
+
+	// RollbackOf is the deployment this one rolls back
+	RollbackOf string `json:"rollbackOf,omitempty"`
+	// ApprovedBy is who let a deployment requiring approval proceed
+	ApprovedBy string `json:"approvedBy,omitempty"`
+	// FreezeOverride lets the deployment proceed during a freeze
+	FreezeOverride *FreezeOverride `json:"freezeOverride,omitempty"`
+	// LockOverride lets the deployment proceed while its environment is
+	// locked
+	LockOverride *LockOverride `json:"lockOverride,omitempty"`
+
+	// Rollout and Waves are set for deployments rolled out in waves
+	Rollout *Rollout   `json:"rollout,omitempty"`
+	Waves   [][]string `json:"waves,omitempty"`
+	// Wave is the index of the wave in progress
+	Wave int `json:"wave,omitempty"`
+	// NextWaveAt is when Wave starts, it is unset once the wave is dispatched
+	NextWaveAt *time.Time `json:"nextWaveAt,omitempty"`
+	// Paused holds the next wave until the deployment is resumed
+	Paused bool `json:"paused,omitempty"`
+
+	// Verify checks every worker once it reports success
+	Verify *Verification `json:"verify,omitempty"`
+	// RolledBackBy is the deployment automatically rolling this one back,
+	// RollbackError why none could be created
+	RolledBackBy  string `json:"rolledBackBy,omitempty"`
+	RollbackError string `json:"rollbackError,omitempty"`
+
+	// Files of the deployment by path, each the digest of a blob workers
+	// download from the server. They are the bundle as rendered before the
+	// upload, workers do not render them again.
+	Files map[string]string `json:"files,omitempty"`
+	// Artifact is the digest of the target, files and spec, or of the values
+	// when there are no files: what ships apart from the environment.
+	// Promotions carry the files, so the artifact, unchanged.
+	Artifact string `json:"artifact,omitempty"`
+	// Overlay holds values of the environment merged over Values in the
+	// manifest workers get, files are not rendered with it. Promotions take
+	// it from the pipeline stage.
+	Overlay map[string]interface{} `json:"overlay,omitempty"`
+	// Spec declares the steps workers run, the outcome of each is the
+	// resource "step:<name>" of the worker
+	Spec *Spec `json:"spec,omitempty"`
+	// Steps reported by each worker, keyed by worker then step
+	Steps map[string]map[string]StepStatus `json:"steps,omitempty"`
+	// Hooks workers run, the ones of the environment around the ones of
+	// the spec, and HookResults what they reported of them
+	Hooks       *Hooks       `json:"hooks,omitempty"`
+	HookResults []HookResult `json:"hookResults,omitempty"`
+	// Pipeline and PromotedFrom are set on promoted deployments
+	Pipeline     string `json:"pipeline,omitempty"`
+	PromotedFrom string `json:"promotedFrom,omitempty"`
+
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+}
+
+// Actions accepted by POST /actions
+const (
+	ActionDeploy = "deploy"
+	// ActionRollback redeploys the last successful deployment of a target
+	// and env before the current one
+	ActionRollback = "rollback"
+)
+
+// Action is a request to change deployments
+type Action struct {
+	Action  string                 `json:"action" binding:"required"`
+	Target  string                 `json:"target"`
+	Env     string                 `json:"env,omitempty"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+	Workers []string               `json:"workers,omitempty"`
+	// Selector adds every worker having all of these labels
+	Selector map[string]string `json:"selector,omitempty"`
+	// Rollout deploys to workers in waves, all at once if nil
+	Rollout *Rollout `json:"rollout,omitempty"`
+	// Verify checks every worker once it reports success
+	Verify *Verification `json:"verify,omitempty"`
+	// Files maps paths to the digests of uploaded blobs
+	Files map[string]string `json:"files,omitempty"`
+	// Spec declares the steps of the deployment
+	Spec *Spec `json:"spec,omitempty"`
+	// FreezeOverride deploys despite freezes of the environment
+	FreezeOverride *FreezeOverride `json:"freezeOverride,omitempty"`
+	// LockOverride deploys despite a lock of the environment, only its
+	// owner may send one
+	LockOverride *LockOverride `json:"lockOverride,omitempty"`
+}
+
+// Rollout deploys to workers in successive waves
+type Rollout struct {
+	// Waves are the sizes of the waves, as a number of workers or a
+	// percentage of all of them such as ["1", "10%"]. Workers left after the
+	// last wave make up a final one.
+	Waves []string `json:"waves" binding:"required"`
+	// Pause between waves, such as "10m"
+	Pause string `json:"pause,omitempty"`
+	// MaxFailures is how many workers may fail before the rollout stops
+	MaxFailures int `json:"maxFailures,omitempty"`
+	// Manual waits for the deployment to be resumed after every wave
+	Manual bool `json:"manual,omitempty"`
+}
+
+// Verification probes every worker after it deployed successfully, the
+// outcome of each probe is the resource "verify:<name>" of the worker.
+// Probes run on the server rather than on workers, so addresses must be
+// reachable from the server, localhost being the server itself, and exec
+// probes run their commands on the server.
+type Verification struct {
+	Probes []Probe `json:"probes" binding:"required,dive"`
+	// AutoRollback rolls back to the previous successful deployment when
+	// the deployment fails
+	AutoRollback bool `json:"autoRollback,omitempty"`
+}
+
+// Probe checks a deployed worker, exactly one of HTTP, TCP and Exec is set.
+// Addresses, URLs and commands are templates, see verify.Vars.
+type Probe struct {
+	Name string     `json:"name" binding:"required"`
+	HTTP *HTTPProbe `json:"http,omitempty"`
+	TCP  *TCPProbe  `json:"tcp,omitempty"`
+	Exec *ExecProbe `json:"exec,omitempty"`
+
+	// Retries is how many times a failed attempt is repeated
+	Retries int `json:"retries,omitempty"`
+	// Interval between attempts, 5s if empty
+	Interval string `json:"interval,omitempty"`
+	// Timeout of a single attempt, 10s if empty
+	Timeout string `json:"timeout,omitempty"`
+	// Deadline bounds all attempts together, 1m if empty
+	Deadline string `json:"deadline,omitempty"`
+}
+
+// Spec declares the steps of a deployment, such as migrating a database,
+// deploying an app and warming a cache. Steps run in parallel unless ordered
+// by DependsOn.
+type Spec struct {
+	Steps []Step `json:"steps,omitempty" binding:"dive"`
+	// Hooks of the bundle, run inside the ones of the environment
+	Hooks *Hooks `json:"hooks,omitempty"`
+}
+
+// Hooks are run in order on every worker at fixed points of the lifecycle of
+// a deployment, such as taking a database snapshot before deploying. They
+// retry and fail like steps, but may not depend on other steps. The outcome
+// of each is the resource "hook:<phase>:<name>" of the worker.
+type Hooks struct {
+	// PreRender hooks run before files are rendered
+	PreRender []Step `json:"preRender,omitempty" binding:"dive"`
+	// PreDeploy hooks run before the steps
+	PreDeploy []Step `json:"preDeploy,omitempty" binding:"dive"`
+	// PostDeploy hooks run once the steps succeeded
+	PostDeploy []Step `json:"postDeploy,omitempty" binding:"dive"`
+	// OnFailure hooks run when anything before failed
+	OnFailure []Step `json:"onFailure,omitempty" binding:"dive"`
+}
+
+// Phases of the lifecycle hooks run at
+const (
+	HookPreRender  = "preRender"
+	HookPreDeploy  = "preDeploy"
+	HookPostDeploy = "postDeploy"
+	HookOnFailure  = "onFailure"
+)
+
+// HookResult is what a worker reported of a hook
+type HookResult struct {
+	Worker   string           `json:"worker" binding:"required"`
+	Phase    string           `json:"phase" binding:"required"`
+	Name     string           `json:"name" binding:"required"`
+	State    pb.ResourceState `json:"state"`
+	Attempts int              `json:"attempts,omitempty"`
+	// Message tells why the hook failed
+	Message string `json:"message,omitempty"`
+	// Output is what the hook printed, its end when too long
+	Output    string    `json:"output,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+}
+
+// Step is run by its executor with its inputs once every step it depends on
+// succeeded
+type Step struct {
+	Name     string `json:"name" binding:"required"`
+	Executor string `json:"executor" binding:"required"`
+	// Inputs are given to the executor, which defines them
+	Inputs    map[string]interface{} `json:"inputs,omitempty"`
+	DependsOn []string               `json:"dependsOn,omitempty"`
+
+	// Retries is how many times a failed attempt is repeated. The first
+	// retry waits Backoff, 1s if empty, and every next one twice as long up
+	// to a minute, each delay randomized by up to half of it.
+	Retries int    `json:"retries,omitempty"`
+	Backoff string `json:"backoff,omitempty"`
+	// Timeout bounds all attempts together, unbounded if empty
+	Timeout string `json:"timeout,omitempty"`
+	// OnFailure is what the failure of the step does, abort if empty
+	OnFailure string `json:"onFailure,omitempty"`
+	// Compensate undoes what the step did when it fails, with OnFailure
+	// compensate
+	Compensate *Compensation `json:"compensate,omitempty"`
+}
+
+// Failure handling modes of steps
+const (
+	// OnFailureAbort fails the deployment, steps not started yet are skipped
+	OnFailureAbort = "abort"
+	// OnFailureContinue ignores the failure, steps depending on the step
+	// run anyway
+	OnFailureContinue = "continue"
+	// OnFailureCompensate runs the compensation of the step, then aborts
+	OnFailureCompensate = "compensate"
+)
+
+// Compensation is run by its executor with its inputs, once
+type Compensation struct {
+	Executor string                 `json:"executor" binding:"required"`
+	Inputs   map[string]interface{} `json:"inputs,omitempty"`
+}
+
+// StepStatus is what a worker reported of a step
+type StepStatus struct {
+	State pb.ResourceState `json:"state"`
+	// Attempts made so far
+	Attempts int `json:"attempts,omitempty"`
+	// Message tells why the last attempt failed
+	Message string `json:"message,omitempty"`
+}
+
+// HTTPProbe expects a status and optionally a body
+type HTTPProbe struct {
+	URL    string `json:"url" binding:"required"`
+	Method string `json:"method,omitempty"`
+	// Status is the expected status code, any 2xx if zero
+	Status int `json:"status,omitempty"`
+	// Body is a regular expression the response body must match
+	Body string `json:"body,omitempty"`
+}
+
+// TCPProbe expects a connection to be accepted
+type TCPProbe struct {
+	Addr string `json:"addr" binding:"required"`
+}
+
+// ExecProbe runs a command on the server and expects an exit code, servers
+// only accept them when allowExecProbes is set in their config
+type ExecProbe struct {
+	Command []string `json:"command" binding:"required"`
+	// ExitCode expected, 0 by default
+	ExitCode int `json:"exitCode,omitempty"`
+}
+
+// Worker is a host executing deployments
+type Worker struct {
+	Name     string            `json:"name"`
+	Addr     string            `json:"addr" binding:"required"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	LastSeen time.Time         `json:"lastSeen"`
+}
+
+// Observation is what a worker found in the workspace of the deployment it
+// runs, workers report one periodically for the server to detect drift
+type Observation struct {
+	// Deployment is the deployment the workspace holds
+	Deployment string `json:"deployment" binding:"required"`
+	// Files are the digests of the files of the workspace by path
+	Files map[string]string `json:"files"`
+	// Checks are the outcome of the observe checks of the executor, such as
+	// whether the resources it created are still present
+	Checks []ObserveCheck `json:"checks,omitempty"`
+}
+
+// ObserveCheck is the outcome of one observe check
+type ObserveCheck struct {
+	Name    string `json:"name" binding:"required"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Drift tells how a worker departs from its last successful deployment of a
+// target to an environment
+type Drift struct {
+	Worker string `json:"worker"`
+	Target string `json:"target"`
+	Env    string `json:"env,omitempty"`
+	// Expected is the last successful deployment on the worker, Observed the
+	// one its workspace holds
+	Expected string `json:"expected"`
+	Observed string `json:"observed"`
+	Drifted  bool   `json:"drifted"`
+	// Files lists the files added, removed or modified since Expected
+	Files []DriftedFile `json:"files,omitempty"`
+	// Generated are the digests of the files the worker wrote besides the
+	// ones of Expected, such as the ones it rendered, as first observed
+	// holding Expected. Later changes to them are drift.
+	Generated map[string]string `json:"generated"`
+	// Checks lists the observe checks failing
+	Checks     []ObserveCheck `json:"checks,omitempty"`
+	ObservedAt time.Time      `json:"observedAt"`
+	// Since is when the drift was first observed
+	Since *time.Time `json:"since,omitempty"`
+	// Reconciliation is the deployment created to undo the drift,
+	// ReconcileError why none could be
+	Reconciliation string `json:"reconciliation,omitempty"`
+	ReconcileError string `json:"reconcileError,omitempty"`
+}
+
+// DriftedFile is a file of a workspace which is not as deployed
+type DriftedFile struct {
+	Path string `json:"path"`
+	// Kind is added, removed or modified
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Observed string `json:"observed,omitempty"`
+}
+
+// Review approves or rejects a deployment awaiting approval
+type Review struct {
+	// By is ignored when the server authenticates callers, the caller is used
+	By      string `json:"by,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// LogEntry is one line of a deployment log
+type LogEntry struct {
+	Time time.Time `json:"time"`
+	// Source is "server" or the name of the worker which sent the line
+	Source string `json:"source"`
+	Line   string `json:"line"`
+}
+
+// Schedule deploys a target on a cron schedule, schedules are defined in
+// the server config
+type Schedule struct {
+	Name     string                 `json:"name"`
+	Cron     string                 `json:"cron"`
+	Timezone string                 `json:"timezone,omitempty"`
+	CatchUp  string                 `json:"catchUp"`
+	Target   string                 `json:"target"`
+	Env      string                 `json:"env,omitempty"`
+	Values   map[string]interface{} `json:"values,omitempty"`
+	Workers  []string               `json:"workers"`
+
+	Paused   bool        `json:"paused"`
+	LastRun  *time.Time  `json:"lastRun,omitempty"`
+	NextRuns []time.Time `json:"nextRuns"`
+	// History lists the latest runs, newest last
+	History []ScheduleRun `json:"history,omitempty"`
+}
+
+// Outcomes of a scheduled run
+const (
+	ScheduleRunStarted = "started"
+	ScheduleRunSkipped = "skipped"
+	ScheduleRunFailed  = "failed"
+)
+
+// ScheduleRun is one firing of a schedule
+type ScheduleRun struct {
+	// Time the run was due at
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"`
+	// Deployment created by the run
+	Deployment string `json:"deployment,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// Freeze modes
+const (
+	// FreezeHold keeps deployments pending until the freeze ends
+	FreezeHold = "hold"
+	// FreezeRefuse rejects new deployments, pending ones are held
+	FreezeRefuse = "refuse"
+)
+
+// Blob is content stored once under its digest
+type Blob struct {
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Refs lists the retained deployments using the blob
+	Refs []string `json:"refs"`
+}
+
+// GCResult tells what a garbage collection of blobs removed
+type GCResult struct {
+	Removed []string `json:"removed"`
+	Freed   int64    `json:"freed"`
+}
+
+// Diff tells what changes when going from deployment From to deployment To
+type Diff struct {
+	// From is empty when nothing was deployed before To
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	// Values are the changes of the values workers get, overlay included
+	Values []ValueChange `json:"values"`
+	// Spec are the changes of the steps, by their index in the spec
+	Spec []ValueChange `json:"spec,omitempty"`
+	// Files lists the files added, removed or modified, sorted by path
+	Files []FileDiff `json:"files"`
+}
+
+// Kinds of ValueChange
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// ValueChange is a value added, removed or modified at Path, such as
+// "spec.containers[0].image"
+type ValueChange struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// FileDiff is the change of one file between two deployments
+type FileDiff struct {
+	Path string `json:"path"`
+	// Kind is added, removed or modified
+	Kind       string `json:"kind"`
+	FromDigest string `json:"fromDigest,omitempty"`
+	ToDigest   string `json:"toDigest,omitempty"`
+	// Unified is the unified diff of text files
+	Unified string `json:"unified,omitempty"`
+	Binary  bool   `json:"binary,omitempty"`
+	// TooLarge is set when a revision is too large to be compared
+	TooLarge bool `json:"tooLarge,omitempty"`
+	// Semantic is set when both revisions parse as YAML or JSON, Changes
+	// then lists what changed ignoring key order and formatting, it is
+	// empty if nothing but those did
+	Semantic bool          `json:"semantic,omitempty"`
+	Changes  []ValueChange `json:"changes,omitempty"`
+}
+
+// Pipeline is an ordered chain of environments a target is promoted through
+type Pipeline struct {
+	Name   string          `json:"name"`
+	Target string          `json:"target"`
+	Stages []PipelineStage `json:"stages"`
+}
+
+// PipelineStage is an environment of a pipeline with its current deployment
+type PipelineStage struct {
+	Env string `json:"env"`
+	// Soak is how long a deployment stays healthy before it is promoted
+	Soak string `json:"soak,omitempty"`
+	// Deployment is the current deployment of the stage and Artifact what
+	// it deployed
+	Deployment string          `json:"deployment,omitempty"`
+	Artifact   string          `json:"artifact,omitempty"`
+	State      DeploymentState `json:"state,omitempty"`
+	// SoakedAt is when the current deployment may be promoted
+	SoakedAt *time.Time `json:"soakedAt,omitempty"`
+	// Blocked tells why the current deployment may not be promoted
+	Blocked string `json:"blocked,omitempty"`
+}
+
+// Promotion deploys what a stage of a pipeline deployed to the next stage
+type Promotion struct {
+	// Deployment to promote, the current deployment of From if empty
+	Deployment string `json:"deployment,omitempty"`
+	From       string `json:"from,omitempty"`
+	// FreezeOverride promotes despite freezes of the next stage
+	FreezeOverride *FreezeOverride `json:"freezeOverride,omitempty"`
+	// LockOverride promotes despite a lock of the next stage
+	LockOverride *LockOverride `json:"lockOverride,omitempty"`
+}
+
+// Secret is a value the server keeps encrypted for the deployments of a
+// project, the target they deploy. A secret without an environment applies
+// to every environment of its project, unless the environment has its own
+// secret of the same name. The API never returns values.
+type Secret struct {
+	Project   string    `json:"project"`
+	Env       string    `json:"env,omitempty"`
+	Name      string    `json:"name"`
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SecretValue sets a secret
+type SecretValue struct {
+	Env   string `json:"env,omitempty"`
+	Value string `json:"value" binding:"required"`
+}
+
+// Freeze is a period no deployment to some environments may start. It is
+// either a single window from Start to End, or recurs every time Cron fires
+// and lasts Duration.
+type Freeze struct {
+	Name string `json:"name" binding:"required"`
+	// Envs lists the environments frozen, every environment if empty
+	Envs []string `json:"envs,omitempty"`
+	// Mode is hold or refuse, hold if empty
+	Mode   string `json:"mode,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+
+	Cron string `json:"cron,omitempty"`
+	// Duration of each recurrence, such as "63h"
+	Duration string `json:"duration,omitempty"`
+	// Timezone Cron is evaluated in, UTC if empty
+	Timezone string `json:"timezone,omitempty"`
+
+	// Source is "config" or "api"
+	Source    string `json:"source,omitempty"`
+	CreatedBy string `json:"createdBy,omitempty"`
+
+	// Active is set when listing freezes in effect, until the time in Until
+	Active bool       `json:"active,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+	// Next is when the freeze starts next, if it is not active
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// FreezeOverride is an audited exception to freezes
+type FreezeOverride struct {
+	// By is who overrode the freeze, the caller when the server
+	// authenticates callers
+	By     string `json:"by,omitempty"`
+	Reason string `json:"reason" binding:"required"`
+	// Freezes lists the freezes in effect when the deployment was created,
+	// the only ones the override bypasses. The server sets it, names sent
+	// are ignored.
+	Freezes []string `json:"freezes,omitempty"`
+}
+
+// Lock stops deployments to an environment, such as while an incident is
+// investigated, until it is unlocked. Only its owner may deploy through it.
+type Lock struct {
+	Env string `json:"env,omitempty"`
+	// Owner is who locked the environment, the caller when the server
+	// authenticates callers
+	Owner  string `json:"owner,omitempty"`
+	Reason string `json:"reason" binding:"required"`
+	// Mode is LockHold or LockRefuse, LockHold if empty
+	Mode      string    `json:"mode,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Lock modes
+const (
+	// LockHold keeps deployments pending until the lock is removed
+	LockHold = "hold"
+	// LockRefuse rejects new deployments but the ones of the owner, pending
+	// ones are held
+	LockRefuse = "refuse"
+)
+
+// LockOverride is an audited exception to a lock by its owner
+type LockOverride struct {
+	// By is who overrode the lock, the caller when the server authenticates
+	// callers
+	By     string `json:"by,omitempty"`
+	Reason string `json:"reason" binding:"required"`
+	// LockedAt is when the lock overridden was created, the server sets it.
+	// The override holds for that lock only, not for a later one.
+	LockedAt *time.Time `json:"lockedAt,omitempty"`
+}
+
+// AuditEntry records a change made to what may be deployed
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is who made the change, empty when unknown
+	Actor string `json:"actor,omitempty"`
+	// Action is what was done, such as lock or unlock
+	Action string `json:"action"`
+	// Subject is what the action applies to, such as an environment
+	Subject string `json:"subject,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
@@ -0,0 +1,200 @@
+// Package blob keeps content addressed blobs on the local filesystem, every
+// blob is stored once under the sha256 digest of its content
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for digests not in the store
+var ErrNotFound = errors.New("blob not found")
+
+// ErrMismatch is returned when content does not have the expected digest
+var ErrMismatch = errors.New("digest mismatch")
+
+const algorithm = "sha256"
+
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// ValidDigest reports whether digest reads "sha256:<64 hex digits>"
+func ValidDigest(digest string) bool {
+	return digestPattern.MatchString(digest)
+}
+
+// Digest returns the digest of data
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return algorithm + ":" + hex.EncodeToString(sum[:])
+}
+
+// Info describes a stored blob
+type Info struct {
+	Digest  string
+	Size    int64
+	ModTime time.Time
+}
+
+// Store keeps blobs under dir/sha256/<2 first digits>/<digest>
+type Store struct {
+	dir string
+}
+
+// New opens the store rooted at dir, creating it if needed
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, algorithm), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob dir %s:%v", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(digest string) string {
+	digits := strings.TrimPrefix(digest, algorithm+":")
+	return filepath.Join(s.dir, algorithm, digits[:2], digits)
+}
+
+// Put stores the content of r and returns its digest. If expected is not
+// empty the content must have that digest. Content already stored is kept
+// as is, only its modification time is refreshed.
+func (s *Store) Put(r io.Reader, expected string) (Info, error) {
+	if expected != "" && !ValidDigest(expected) {
+		return Info{}, fmt.Errorf("invalid digest %q", expected)
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(s.dir, algorithm), ".upload-")
+	if err != nil {
+		return Info{}, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	digest := sum(h)
+	if expected != "" && digest != expected {
+		return Info{}, fmt.Errorf("%w, content has digest %s instead of %s", ErrMismatch, digest, expected)
+	}
+	dst := s.path(digest)
+	now := time.Now()
+	if _, err := os.Stat(dst); err == nil {
+		// Refreshing the time keeps a blob uploaded again from being
+		// collected before it is referenced
+		return Info{Digest: digest, Size: size, ModTime: now}, os.Chtimes(dst, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return Info{}, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return Info{}, err
+	}
+	return Info{Digest: digest, Size: size, ModTime: now}, nil
+}
+
+func sum(h hash.Hash) string {
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Open returns the content of a blob, it supports seeking for range reads
+func (s *Store) Open(digest string) (*os.File, Info, error) {
+	if !ValidDigest(digest) {
+		return nil, Info{}, ErrNotFound
+	}
+	f, err := os.Open(s.path(digest))
+	if os.IsNotExist(err) {
+		return nil, Info{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Info{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Info{}, err
+	}
+	return f, Info{Digest: digest, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Stat describes a blob
+func (s *Store) Stat(digest string) (Info, error) {
+	if !ValidDigest(digest) {
+		return Info{}, ErrNotFound
+	}
+	fi, err := os.Stat(s.path(digest))
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Digest: digest, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Touch refreshes the modification time of a blob, as uploading it again
+// would, so that it is not collected before it is referenced
+func (s *Store) Touch(digest string) (Info, error) {
+	if !ValidDigest(digest) {
+		return Info{}, ErrNotFound
+	}
+	now := time.Now()
+	err := os.Chtimes(s.path(digest), now, now)
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return s.Stat(digest)
+}
+
+// Delete removes a blob, it is not an error if it does not exist
+func (s *Store) Delete(digest string) error {
+	if !ValidDigest(digest) {
+		return nil
+	}
+	err := os.Remove(s.path(digest))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List describes every blob sorted by digest
+func (s *Store) List() ([]Info, error) {
+	var infos []Info
+	root := filepath.Join(s.dir, algorithm)
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			return nil
+		}
+		digest := algorithm + ":" + fi.Name()
+		if ValidDigest(digest) {
+			infos = append(infos, Info{Digest: digest, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Digest < infos[j].Digest })
+	return infos, nil
+}
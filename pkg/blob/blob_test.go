@@ -0,0 +1,80 @@
+package blob
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := Digest([]byte("hello"))
+	if !ValidDigest(digest) || ValidDigest("sha256:abc") || ValidDigest("md5:"+digest[7:]) {
+		t.Errorf("unexpected digest validation")
+	}
+	info, err := s.Put(strings.NewReader("hello"), digest)
+	if err != nil || info.Digest != digest || info.Size != 5 {
+		t.Fatalf("unexpected put %v %v", info, err)
+	}
+	if _, err := s.Put(strings.NewReader("hullo"), digest); !errors.Is(err, ErrMismatch) {
+		t.Errorf("expected a digest mismatch, got %v", err)
+	}
+
+	// Storing again keeps a single copy with a fresh time
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(s.path(digest), old, old)
+	if info, err = s.Put(strings.NewReader("hello"), ""); err != nil || info.Digest != digest {
+		t.Fatalf("unexpected put %v %v", info, err)
+	}
+	if info, _ := s.Stat(digest); info.ModTime.Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("expected the time to be refreshed, got %v", info.ModTime)
+	}
+	os.Chtimes(s.path(digest), old, old)
+	if info, err := s.Touch(digest); err != nil || info.ModTime.Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("expected touching to refresh the time, got %v %v", info, err)
+	}
+	infos, err := s.List()
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("expected a single blob, got %v %v", infos, err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "sha256", ".upload-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("expected temporary files to be removed, got %v", leftovers)
+	}
+
+	f, _, err := s.Open(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(raw) != "hello" {
+		t.Errorf("unexpected content %q", raw)
+	}
+
+	if err := s.Delete(digest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(digest); err != ErrNotFound {
+		t.Errorf("expected the blob to be deleted, got %v", err)
+	}
+	if _, err := s.Touch(digest); err != ErrNotFound {
+		t.Errorf("expected a deleted blob not to be touched, got %v", err)
+	}
+	if _, _, err := s.Open("../../etc/passwd"); err != ErrNotFound {
+		t.Errorf("expected invalid digests not to be found, got %v", err)
+	}
+}
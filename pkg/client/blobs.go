@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+func blobDigest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// UploadBlob stores data on the server and returns its digest. Data already
+// stored is not kept twice, uploading it again keeps it from being collected
+// before a deployment references it.
+func (c *Client) UploadBlob(ctx context.Context, data []byte) (*api.Blob, error) {
+	h := sha256.New()
+	h.Write(data)
+	var b api.Blob
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	if err := c.send(ctx, http.MethodPut, "/blobs/"+blobDigest(h), header, data, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// DownloadBlob writes the content of a blob to w. A download cut short is
+// resumed where it stopped, and the content is checked against its digest.
+func (c *Client) DownloadBlob(ctx context.Context, digest string, w io.Writer) error {
+	h := sha256.New()
+	var n int64
+	err := c.retry.do(ctx, func() (bool, time.Duration, error) {
+		header := http.Header{}
+		if n > 0 {
+			header.Set("Range", "bytes="+strconv.FormatInt(n, 10)+"-")
+		}
+		resp, err := c.request(ctx, http.MethodGet, "/blobs/"+digest, nil, header)
+		if err != nil {
+			return true, 0, err
+		}
+		defer resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusOK && n == 0, resp.StatusCode == http.StatusPartialContent:
+		case resp.StatusCode == http.StatusOK:
+			return false, 0, fmt.Errorf("server does not resume the download of %s", digest)
+		default:
+			var e struct {
+				Error string `json:"error"`
+			}
+			json.NewDecoder(resp.Body).Decode(&e)
+			retry, wait := retryableStatus(resp, true)
+			return retry, wait, &Error{StatusCode: resp.StatusCode, Message: e.Error}
+		}
+		written, err := io.Copy(io.MultiWriter(w, h), resp.Body)
+		n += written
+		if err != nil {
+			return true, 0, fmt.Errorf("failed to download %s:%v", digest, err)
+		}
+		return false, 0, nil
+	})
+	if err != nil {
+		return err
+	}
+	if got := blobDigest(h); got != digest {
+		return fmt.Errorf("downloaded content has digest %s instead of %s", got, digest)
+	}
+	return nil
+}
+
+// Blobs lists stored blobs with the deployments referencing them
+func (c *Client) Blobs(ctx context.Context) ([]api.Blob, error) {
+	var blobs []api.Blob
+	if err := c.do(ctx, http.MethodGet, "/blobs", nil, &blobs); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// CollectBlobs removes the blobs no retained deployment references
+func (c *Client) CollectBlobs(ctx context.Context) (*api.GCResult, error) {
+	var result api.GCResult
+	if err := c.do(ctx, http.MethodPost, "/blobs/gc", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
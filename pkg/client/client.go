@@ -0,0 +1,268 @@
+// Package client talks to a deployer server over its REST and grpc APIs
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/beacon/deployer/pkg/config"
+)
+
+// Config tells the client where the server is and how to authenticate
+type Config struct {
+	// Server is the host:port of the deployer server
+	Server string `json:"server" validate:"required"`
+	// Token is sent as bearer token when set
+	Token string `json:"token,omitempty"`
+	// TLS is used when set, the server is reached in plain text otherwise
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// Timeout bounds a single request, retries excluded
+	Timeout config.Duration `json:"timeout,omitempty"`
+	// Retry decides how failed requests are retried
+	Retry *RetryPolicy `json:"retry,omitempty"`
+}
+
+// TLSConfig mirrors config.TLSConfig from the client side
+type TLSConfig struct {
+	// CertFile and KeyFile are a client certificate, for servers verifying clients
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// CAFile verifies the server certificate, system roots are used if empty
+	CAFile string `json:"caFile,omitempty"`
+	// ServerName overrides the name expected in the server certificate
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// Error is a failed REST request
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is a REST 404
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// Client of a deployer server, safe for concurrent use
+type Client struct {
+	cfg     Config
+	scheme  string
+	tls     *tls.Config
+	http    *http.Client
+	timeout time.Duration
+	retry   RetryPolicy
+
+	mu   sync.Mutex
+	conn *grpc.ClientConn
+}
+
+const defaultTimeout = 30 * time.Second
+
+// IdempotencyHeader carries the idempotency key of a submitted action
+const IdempotencyHeader = "Idempotency-Key"
+
+// New creates a client, connections are made lazily
+func New(cfg Config) (*Client, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("server address is required")
+	}
+	c := &Client{
+		cfg:     cfg,
+		scheme:  "http",
+		timeout: time.Duration(cfg.Timeout),
+		retry:   defaultRetry,
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+	if cfg.Retry != nil {
+		c.retry = *cfg.Retry
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if cfg.TLS != nil {
+		tlsCfg, err := loadTLS(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		c.tls = tlsCfg
+		c.scheme = "https"
+		transport.TLSClientConfig = tlsCfg
+	}
+	c.http = &http.Client{Transport: transport}
+	return c, nil
+}
+
+func loadTLS(cfg *TLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{ServerName: cfg.ServerName}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate:%v", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFile != "" {
+		ca, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s:%v", cfg.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
+
+// Close releases the grpc connection if any
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// tokenCredentials sends the bearer token with every grpc call
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return t.secure
+}
+
+// dial connects to addr with the TLS settings and token of the client
+func (c *Client) dial(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{}
+	if c.tls != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(c.tls.Clone())))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if c.cfg.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{token: c.cfg.Token, secure: c.tls != nil}))
+	}
+	return grpc.DialContext(ctx, addr, opts...)
+}
+
+// grpcConn returns the shared connection to the server
+func (c *Client) grpcConn(ctx context.Context) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn, nil
+	}
+	conn, err := c.dial(ctx, c.cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+// request sends one REST request, without retries
+func (c *Client) request(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.scheme+"://"+c.cfg.Server+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+	return c.http.Do(req)
+}
+
+// do sends a REST request with in as JSON body and decodes the response into
+// out, requests are retried according to the retry policy
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	return c.doWithHeader(ctx, method, path, nil, in, out)
+}
+
+func (c *Client) doWithHeader(ctx context.Context, method, path string, header http.Header, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = raw
+	}
+	return c.send(ctx, method, path, header, body, out)
+}
+
+// send sends body as is, see do
+func (c *Client) send(ctx context.Context, method, path string, header http.Header, body []byte, out interface{}) error {
+	// Requests which are not idempotent are only retried when the server
+	// tells it did not process them, unless they carry an idempotency key
+	idempotent := method != http.MethodPost || header.Get(IdempotencyHeader) != ""
+	return c.retry.do(ctx, func() (bool, time.Duration, error) {
+		reqCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+		resp, err := c.request(reqCtx, method, path, body, header)
+		if err != nil {
+			return idempotent, 0, err
+		}
+		defer resp.Body.Close()
+		raw, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return idempotent, 0, err
+		}
+		if resp.StatusCode >= 300 {
+			var e struct {
+				Error string `json:"error"`
+			}
+			json.Unmarshal(raw, &e)
+			if e.Error == "" {
+				e.Error = strings.TrimSpace(string(raw))
+			}
+			retry, wait := retryableStatus(resp, idempotent)
+			return retry, wait, &Error{StatusCode: resp.StatusCode, Message: e.Error}
+		}
+		if out != nil && len(raw) > 0 {
+			if err := json.Unmarshal(raw, out); err != nil {
+				return false, 0, fmt.Errorf("failed to decode response of %s %s:%v", method, path, err)
+			}
+		}
+		return false, 0, nil
+	})
+}
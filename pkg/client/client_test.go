@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/server"
+)
+
+// newServer runs a deployer server speaking REST and h2c grpc on a test
+// listener and returns its address
+func newServer(t *testing.T, cfg *config.Config) string {
+	s := server.New(cfg)
+	ts := httptest.NewServer(h2c.NewHandler(s, &http2.Server{}))
+	t.Cleanup(ts.Close)
+	return ts.Listener.Addr().String()
+}
+
+func TestClient(t *testing.T) {
+	addr := newServer(t, &config.Config{
+		RequireApproval: []string{"prod"},
+		Auth: &config.AuthConfig{Tokens: []config.TokenConfig{
+			{Name: "alice", Token: "secret"},
+		}},
+	})
+	ctx := context.Background()
+
+	anonymous, err := New(Config{Server: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer anonymous.Close()
+	if _, err := anonymous.Deployments(ctx); err == nil || err.(*Error).StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %v", err)
+	}
+	if _, err := anonymous.UpdateDeployStatus(ctx, &pb.DeployStatus{Id: "x"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected grpc call without token to be unauthenticated, got %v", err)
+	}
+
+	c, err := New(Config{Server: addr, Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.RegisterWorker(ctx, api.Worker{Name: "w1", Addr: "w1:9001"}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.Deploy(ctx, api.Action{Target: "web", Env: "prod", Workers: []string{"w1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.State != api.DeploymentAwaitingApproval {
+		t.Fatalf("expected deployment to await approval, got %s", d.State)
+	}
+	// The reviewer is whoever owns the token
+	if d, err = c.Approve(ctx, d.ID, api.Review{By: "mallory"}); err != nil {
+		t.Fatal(err)
+	}
+	if d.ApprovedBy != "alice" {
+		t.Errorf("expected approval by alice, got %q", d.ApprovedBy)
+	}
+	if _, err := c.Deployment(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	reply, err := c.UpdateDeployStatus(ctx, &pb.DeployStatus{Id: d.ID, Worker: "w1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Code != http.StatusOK {
+		t.Errorf("unexpected reply %+v", reply)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":"no leader available"}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer ts.Close()
+	c, _ := New(Config{
+		Server: strings.TrimPrefix(ts.URL, "http://"),
+		Retry:  &RetryPolicy{Attempts: 3, InitialBackoff: config.Duration(time.Millisecond)},
+	})
+	if _, err := c.Workers(context.Background()); err != nil {
+		t.Fatalf("expected retries to succeed, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+
+	// A failed POST which may have been processed is not sent again
+	calls = 0
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	if _, err := c.Deploy(context.Background(), api.Action{Target: "web"}); err == nil {
+		t.Error("expected deploy to fail")
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt, got %d", calls)
+	}
+
+	// Unless its idempotency key keeps the server from processing it twice
+	calls = 0
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(IdempotencyHeader) != "ci-42" {
+			t.Errorf("expected idempotency key, got %q", r.Header.Get(IdempotencyHeader))
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":"d1"}`)
+	})
+	d, err := c.SubmitWithKey(context.Background(), "ci-42", api.Action{Action: api.ActionDeploy, Target: "web"})
+	if err != nil || d.ID != "d1" || calls != 3 {
+		t.Errorf("expected keyed submission to be retried, got %v after %d attempts", err, calls)
+	}
+}
+
+func TestFollowLogs(t *testing.T) {
+	var streams int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first stream drops after one entry, the second one resumes
+		if atomic.AddInt32(&streams, 1) == 1 {
+			fmt.Fprint(w, "event:log\ndata:{\"source\":\"server\",\"line\":\"one\"}\n\n")
+			return
+		}
+		if from := r.URL.Query().Get("from"); from != "1" {
+			t.Errorf("expected stream to resume from 1, got %s", from)
+		}
+		fmt.Fprint(w, "event:log\ndata:{\"source\":\"w1\",\"line\":\"two\"}\n\nevent:end\ndata:\n\n")
+	}))
+	defer ts.Close()
+	c, _ := New(Config{
+		Server: strings.TrimPrefix(ts.URL, "http://"),
+		Retry:  &RetryPolicy{Attempts: 2, InitialBackoff: config.Duration(time.Millisecond)},
+	})
+	var lines []string
+	err := c.FollowLogs(context.Background(), "d1", func(e api.LogEntry) error {
+		lines = append(lines, e.Line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, ",") != "one,two" {
+		t.Errorf("unexpected lines %v", lines)
+	}
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultConfigFile is where command line clients look for their config,
+// ~/.deployer/client.yaml
+func DefaultConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".deployer", "client.yaml")
+}
+
+// LoadConfig reads a client config file in YAML or JSON
+func LoadConfig(file string) (*Config, error) {
+	cfg := &Config{}
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client config file %s:%v", file, err)
+	}
+	if err := yaml.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse client config file %s:%v", file, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,319 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// Deploy submits a deploy action
+func (c *Client) Deploy(ctx context.Context, action api.Action) (*api.Deployment, error) {
+	action.Action = api.ActionDeploy
+	return c.Submit(ctx, action)
+}
+
+// Rollback deploys target in env again as its previous successful deployment
+func (c *Client) Rollback(ctx context.Context, target, env string) (*api.Deployment, error) {
+	return c.Submit(ctx, api.Action{Action: api.ActionRollback, Target: target, Env: env})
+}
+
+// Submit sends any action
+func (c *Client) Submit(ctx context.Context, action api.Action) (*api.Deployment, error) {
+	return c.SubmitWithKey(ctx, "", action)
+}
+
+// SubmitWithKey sends an action under an idempotency key, submitting it
+// again with the same key returns the deployment it created the first time
+// until the key expires on the server. Failed attempts are retried then, as
+// they cannot deploy twice.
+func (c *Client) SubmitWithKey(ctx context.Context, key string, action api.Action) (*api.Deployment, error) {
+	var d api.Deployment
+	var header http.Header
+	if key != "" {
+		header = http.Header{IdempotencyHeader: {key}}
+	}
+	if err := c.doWithHeader(ctx, http.MethodPost, "/actions", header, action, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Deployment gets a deployment by id
+func (c *Client) Deployment(ctx context.Context, id string) (*api.Deployment, error) {
+	var d api.Deployment
+	if err := c.do(ctx, http.MethodGet, "/deployments/"+url.PathEscape(id), nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Deployments lists deployments, newest first
+func (c *Client) Deployments(ctx context.Context) ([]api.Deployment, error) {
+	var ds []api.Deployment
+	if err := c.do(ctx, http.MethodGet, "/deployments", nil, &ds); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// Approve approves a deployment awaiting approval. by is ignored by servers
+// with auth enabled, which use the name of the token instead.
+func (c *Client) Approve(ctx context.Context, id string, review api.Review) (*api.Deployment, error) {
+	return c.review(ctx, id, "approve", review)
+}
+
+// Reject rejects a deployment awaiting approval
+func (c *Client) Reject(ctx context.Context, id string, review api.Review) (*api.Deployment, error) {
+	return c.review(ctx, id, "reject", review)
+}
+
+func (c *Client) review(ctx context.Context, id, verb string, review api.Review) (*api.Deployment, error) {
+	var d api.Deployment
+	if err := c.do(ctx, http.MethodPost, "/deployments/"+url.PathEscape(id)+"/"+verb, review, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Logs returns the log of a deployment from entry number from on
+func (c *Client) Logs(ctx context.Context, id string, from int) ([]api.LogEntry, error) {
+	var entries []api.LogEntry
+	path := "/deployments/" + url.PathEscape(id) + "/logs?from=" + strconv.Itoa(from)
+	if err := c.do(ctx, http.MethodGet, path, nil, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Diff compares deployment id with deployment against, or with the one
+// running before it if against is empty
+func (c *Client) Diff(ctx context.Context, id, against string) (*api.Diff, error) {
+	var d api.Diff
+	path := "/deployments/" + url.PathEscape(id) + "/diff"
+	if against != "" {
+		path += "?against=" + url.QueryEscape(against)
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// AppendLogs adds entries to the log of a deployment
+func (c *Client) AppendLogs(ctx context.Context, id string, entries []api.LogEntry) error {
+	return c.do(ctx, http.MethodPost, "/deployments/"+url.PathEscape(id)+"/logs", entries, nil)
+}
+
+// ReportHook records the result of a hook a worker ran for deployment id
+func (c *Client) ReportHook(ctx context.Context, id string, result api.HookResult) error {
+	return c.do(ctx, http.MethodPost, "/deployments/"+url.PathEscape(id)+"/hooks", result, nil)
+}
+
+// Workers lists registered workers
+func (c *Client) Workers(ctx context.Context) ([]api.Worker, error) {
+	var ws []api.Worker
+	if err := c.do(ctx, http.MethodGet, "/workers", nil, &ws); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// RegisterWorker registers w, or refreshes its registration
+func (c *Client) RegisterWorker(ctx context.Context, w api.Worker) (*api.Worker, error) {
+	var registered api.Worker
+	if err := c.do(ctx, http.MethodPut, "/workers/"+url.PathEscape(w.Name), w, &registered); err != nil {
+		return nil, err
+	}
+	return &registered, nil
+}
+
+// ReportObservation sends what worker observed of its deployment workspace,
+// the drift found is nil while a deployment to the worker is in flight
+func (c *Client) ReportObservation(ctx context.Context, worker string, o api.Observation) (*api.Drift, error) {
+	var drift *api.Drift
+	if err := c.do(ctx, http.MethodPost, "/workers/"+url.PathEscape(worker)+"/observations", o, &drift); err != nil {
+		return nil, err
+	}
+	return drift, nil
+}
+
+// Drift lists the last observation of every worker, only the workers which
+// drifted if drifted is set
+func (c *Client) Drift(ctx context.Context, drifted bool) ([]api.Drift, error) {
+	var list []api.Drift
+	path := "/drift"
+	if drifted {
+		path += "?drifted=true"
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Leader returns which replica holds the leader lease
+func (c *Client) Leader(ctx context.Context) (map[string]interface{}, error) {
+	var leader map[string]interface{}
+	if err := c.do(ctx, http.MethodGet, "/leader", nil, &leader); err != nil {
+		return nil, err
+	}
+	return leader, nil
+}
+
+// Cancel stops a deployment which has not ended yet
+func (c *Client) Cancel(ctx context.Context, id string, review api.Review) (*api.Deployment, error) {
+	return c.review(ctx, id, "cancel", review)
+}
+
+// Schedules lists schedules with their next runs
+func (c *Client) Schedules(ctx context.Context) ([]api.Schedule, error) {
+	var schedules []api.Schedule
+	if err := c.do(ctx, http.MethodGet, "/schedules", nil, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// Schedule gets a schedule with its history
+func (c *Client) Schedule(ctx context.Context, name string) (*api.Schedule, error) {
+	return c.scheduleCall(ctx, http.MethodGet, "/schedules/"+url.PathEscape(name))
+}
+
+// PauseSchedule stops a schedule from firing
+func (c *Client) PauseSchedule(ctx context.Context, name string) (*api.Schedule, error) {
+	return c.scheduleCall(ctx, http.MethodPost, "/schedules/"+url.PathEscape(name)+"/pause")
+}
+
+// ResumeSchedule lets a paused schedule fire again
+func (c *Client) ResumeSchedule(ctx context.Context, name string) (*api.Schedule, error) {
+	return c.scheduleCall(ctx, http.MethodPost, "/schedules/"+url.PathEscape(name)+"/resume")
+}
+
+func (c *Client) scheduleCall(ctx context.Context, method, path string) (*api.Schedule, error) {
+	var sched api.Schedule
+	if err := c.do(ctx, method, path, nil, &sched); err != nil {
+		return nil, err
+	}
+	return &sched, nil
+}
+
+// Freezes lists freezes, the ones in effect first
+func (c *Client) Freezes(ctx context.Context) ([]api.Freeze, error) {
+	var freezes []api.Freeze
+	if err := c.do(ctx, http.MethodGet, "/freezes", nil, &freezes); err != nil {
+		return nil, err
+	}
+	return freezes, nil
+}
+
+// CreateFreeze defines a freeze
+func (c *Client) CreateFreeze(ctx context.Context, f api.Freeze) (*api.Freeze, error) {
+	var created api.Freeze
+	if err := c.do(ctx, http.MethodPost, "/freezes", f, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// DeleteFreeze removes a freeze created through the API
+func (c *Client) DeleteFreeze(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/freezes/"+url.PathEscape(name), nil, nil)
+}
+
+// Pause holds the next wave of a rollout
+func (c *Client) Pause(ctx context.Context, id string) (*api.Deployment, error) {
+	var d api.Deployment
+	if err := c.do(ctx, http.MethodPost, "/deployments/"+url.PathEscape(id)+"/pause", nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Resume continues a paused rollout
+func (c *Client) Resume(ctx context.Context, id string) (*api.Deployment, error) {
+	var d api.Deployment
+	if err := c.do(ctx, http.MethodPost, "/deployments/"+url.PathEscape(id)+"/resume", nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func secretsPath(project string, elem ...string) string {
+	path := "/secrets/" + url.PathEscape(project)
+	for _, e := range elem {
+		path += "/" + url.PathEscape(e)
+	}
+	return path
+}
+
+func envQuery(env string) string {
+	if env == "" {
+		return ""
+	}
+	return "?" + url.Values{"env": {env}}.Encode()
+}
+
+// Secrets lists the secrets of a project applying to env, every one of them
+// if env is empty. Values are not returned.
+func (c *Client) Secrets(ctx context.Context, project, env string) ([]api.Secret, error) {
+	var list []api.Secret
+	if err := c.do(ctx, http.MethodGet, secretsPath(project)+envQuery(env), nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// SecretValues gets the secret values of a project in env, the token needs
+// to be allowed to read secrets
+func (c *Client) SecretValues(ctx context.Context, project, env string) (map[string]string, error) {
+	var values map[string]string
+	if err := c.do(ctx, http.MethodGet, secretsPath(project, "values")+envQuery(env), nil, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// SetSecret sets a secret of a project, for every environment if env is
+// empty
+func (c *Client) SetSecret(ctx context.Context, project, env, name, value string) (*api.Secret, error) {
+	var secret api.Secret
+	if err := c.do(ctx, http.MethodPut, secretsPath(project, name), api.SecretValue{Env: env, Value: value}, &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// DeleteSecret deletes a secret of a project
+func (c *Client) DeleteSecret(ctx context.Context, project, env, name string) error {
+	return c.do(ctx, http.MethodDelete, secretsPath(project, name)+envQuery(env), nil, nil)
+}
+
+// Pipelines lists pipelines with the current deployment of every stage
+func (c *Client) Pipelines(ctx context.Context) ([]api.Pipeline, error) {
+	var pipelines []api.Pipeline
+	if err := c.do(ctx, http.MethodGet, "/pipelines", nil, &pipelines); err != nil {
+		return nil, err
+	}
+	return pipelines, nil
+}
+
+// Pipeline gets a pipeline with the current deployment of every stage
+func (c *Client) Pipeline(ctx context.Context, name string) (*api.Pipeline, error) {
+	var p api.Pipeline
+	if err := c.do(ctx, http.MethodGet, "/pipelines/"+url.PathEscape(name), nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Promote deploys what a stage of a pipeline deployed to its next stage
+func (c *Client) Promote(ctx context.Context, pipeline string, promotion api.Promotion) (*api.Deployment, error) {
+	var d api.Deployment
+	if err := c.do(ctx, http.MethodPost, "/pipelines/"+url.PathEscape(pipeline)+"/promote", promotion, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
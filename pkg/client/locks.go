@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// Locks lists locked environments
+func (c *Client) Locks(ctx context.Context) ([]api.Lock, error) {
+	var locks []api.Lock
+	if err := c.do(ctx, http.MethodGet, "/locks", nil, &locks); err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// Lock locks an environment, the server sets the owner when it
+// authenticates callers
+func (c *Client) Lock(ctx context.Context, lock api.Lock) (*api.Lock, error) {
+	var created api.Lock
+	if err := c.do(ctx, http.MethodPost, "/locks", lock, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Unlock unlocks env on behalf of by, force unlocks it even if by does not
+// own the lock
+func (c *Client) Unlock(ctx context.Context, env, by string, force bool) error {
+	q := url.Values{}
+	if env != "" {
+		q.Set("env", env)
+	}
+	if by != "" {
+		q.Set("by", by)
+	}
+	if force {
+		q.Set("force", "true")
+	}
+	path := "/locks"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// Audit lists at most limit entries of the audit log recorded since then,
+// oldest first. The server picks the limit if zero.
+func (c *Client) Audit(ctx context.Context, since time.Time, limit int) ([]api.AuditEntry, error) {
+	q := url.Values{}
+	if !since.IsZero() {
+		q.Set("since", since.Format(time.RFC3339))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/audit"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var entries []api.AuditEntry
+	if err := c.do(ctx, http.MethodGet, path, nil, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/beacon/deployer/pkg/config"
+)
+
+// RetryPolicy retries failed requests with exponential backoff and jitter
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, 1 disables retries
+	Attempts int `json:"attempts,omitempty"`
+	// InitialBackoff is the wait before the first retry, it doubles after
+	InitialBackoff config.Duration `json:"initialBackoff,omitempty"`
+	// MaxBackoff caps the wait between attempts
+	MaxBackoff config.Duration `json:"maxBackoff,omitempty"`
+}
+
+var defaultRetry = RetryPolicy{
+	Attempts:       4,
+	InitialBackoff: config.Duration(200 * time.Millisecond),
+	MaxBackoff:     config.Duration(5 * time.Second),
+}
+
+// backoff returns the wait before retry number n, counting from 0
+func (p RetryPolicy) backoff(n int) time.Duration {
+	wait := time.Duration(p.InitialBackoff)
+	if wait <= 0 {
+		wait = time.Duration(defaultRetry.InitialBackoff)
+	}
+	max := time.Duration(p.MaxBackoff)
+	if max <= 0 {
+		max = time.Duration(defaultRetry.MaxBackoff)
+	}
+	for i := 0; i < n && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	// Full jitter on the upper half spreads clients retrying together
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// do calls fn until it succeeds, tells not to retry, or attempts run out.
+// fn may ask for a minimum wait, as servers do with Retry-After.
+func (p RetryPolicy) do(ctx context.Context, fn func() (retry bool, wait time.Duration, err error)) error {
+	attempts := p.Attempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	var err error
+	for n := 0; n < attempts; n++ {
+		var retry bool
+		var wait time.Duration
+		retry, wait, err = fn()
+		if err == nil || !retry || n == attempts-1 {
+			return err
+		}
+		if b := p.backoff(n); b > wait {
+			wait = b
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return err
+}
+
+// retryableStatus decides whether a REST failure is worth retrying
+func retryableStatus(resp *http.Response, idempotent bool) (bool, time.Duration) {
+	var wait time.Duration
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		wait = time.Duration(secs) * time.Second
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		// Rejected before being processed
+		return true, wait
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent, wait
+	}
+	return false, 0
+}
+
+// retryableCode decides whether a grpc failure is worth retrying
+func retryableCode(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+// UpdateDeployStatus reports the status of a deployment through grpc, as
+// workers do
+func (c *Client) UpdateDeployStatus(ctx context.Context, status *pb.DeployStatus) (*pb.Reply, error) {
+	conn, err := c.grpcConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var reply *pb.Reply
+	err = c.retry.do(ctx, func() (bool, time.Duration, error) {
+		callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+		var err error
+		reply, err = pb.NewServerClient(conn).UpdateDeployStatus(callCtx, status)
+		return retryableCode(err), 0, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// WorkerClient calls the grpc service of a worker directly
+type WorkerClient struct {
+	c    *Client
+	addr string
+}
+
+// Worker returns a client of the worker listening on addr, it uses the TLS
+// settings and token of c
+func (c *Client) Worker(addr string) *WorkerClient {
+	return &WorkerClient{c: c, addr: addr}
+}
+
+// SendFiles streams files of deployment id to the worker
+func (w *WorkerClient) SendFiles(ctx context.Context, files ...*pb.File) (*pb.FileStatus, error) {
+	conn, err := w.c.dial(ctx, w.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stream, err := pb.NewWorkerClient(conn).SendDeployFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if err := stream.Send(f); err != nil {
+			return nil, fmt.Errorf("failed to send %s:%v", f.Path, err)
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+// DeployStatus asks the worker where it is with deployment id
+func (w *WorkerClient) DeployStatus(ctx context.Context, id string) (*pb.DeployStatus, error) {
+	conn, err := w.c.dial(ctx, w.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var status *pb.DeployStatus
+	err = w.c.retry.do(ctx, func() (bool, time.Duration, error) {
+		callCtx, cancel := context.WithTimeout(ctx, w.c.timeout)
+		defer cancel()
+		var err error
+		status, err = pb.NewWorkerClient(conn).GetDeployStatus(callCtx, &pb.DeployStatusRequest{Id: id})
+		return retryableCode(err), 0, err
+	})
+	return status, err
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// WatchInterval is how often WatchDeployment polls the server
+var WatchInterval = time.Second
+
+// WatchDeployment calls fn every time deployment id changes, until it ends,
+// fn returns an error or ctx is done. The last state is returned.
+func (c *Client) WatchDeployment(ctx context.Context, id string, fn func(*api.Deployment) error) (*api.Deployment, error) {
+	var last time.Time
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	for {
+		d, err := c.Deployment(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !d.UpdatedAt.Equal(last) {
+			last = d.UpdatedAt
+			if fn != nil {
+				if err := fn(d); err != nil {
+					return d, err
+				}
+			}
+		}
+		if d.State.Terminal() {
+			return d, nil
+		}
+		select {
+		case <-ctx.Done():
+			return d, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// errEnd tells the log stream was closed by the server at the end of the
+// deployment
+var errEnd = fmt.Errorf("end of log")
+
+// FollowLogs calls fn with every log entry of deployment id, including the
+// existing ones, until the deployment ends. Dropped streams are resumed
+// where they stopped.
+func (c *Client) FollowLogs(ctx context.Context, id string, fn func(api.LogEntry) error) error {
+	from := 0
+	failures := 0
+	var fnErr error
+	call := func(entry api.LogEntry) error {
+		fnErr = fn(entry)
+		return fnErr
+	}
+	for {
+		n, err := c.followLogs(ctx, id, from, call)
+		from += n
+		if err == errEnd {
+			return nil
+		}
+		if fnErr != nil {
+			return fnErr
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if e, ok := err.(*Error); ok && e.StatusCode < 500 && e.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+		if err != nil && n == 0 {
+			// Only consecutive failures count against the retry policy
+			failures++
+			if failures >= c.retry.Attempts {
+				return err
+			}
+		} else {
+			failures = 0
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.retry.backoff(failures)):
+		}
+	}
+}
+
+// followLogs reads one event stream, returning how many entries it passed to
+// fn
+func (c *Client) followLogs(ctx context.Context, id string, from int, fn func(api.LogEntry) error) (int, error) {
+	path := "/deployments/" + url.PathEscape(id) + "/logs?follow=true&from=" + strconv.Itoa(from)
+	resp, err := c.request(ctx, http.MethodGet, path, nil, http.Header{"Accept": {"text/event-stream"}})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return 0, &Error{StatusCode: resp.StatusCode, Message: e.Error}
+	}
+
+	n := 0
+	var event, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			switch event {
+			case "log":
+				var entry api.LogEntry
+				if err := json.Unmarshal([]byte(data), &entry); err != nil {
+					return n, fmt.Errorf("failed to decode log entry:%v", err)
+				}
+				if err := fn(entry); err != nil {
+					return n, err
+				}
+				n++
+			case "end":
+				return n, errEnd
+			case "error":
+				return n, fmt.Errorf("server failed to read log: %s", data)
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+	return n, fmt.Errorf("log stream closed")
+}
@@ -0,0 +1,430 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator"
+
+	"github.com/beacon/deployer/pkg/cron"
+	"github.com/beacon/deployer/pkg/spec"
+)
+
+// Problem is something wrong with a config
+type Problem struct {
+	// Path is the field at fault, such as schedules[0].cron, empty when the
+	// problem is with the whole file
+	Path string `json:"path,omitempty"`
+	// Line is where the field is in the config file, 0 if unknown
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	s := p.Message
+	if p.Path != "" {
+		s = p.Path + " " + s
+	}
+	if p.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", p.Line, s)
+	}
+	return s
+}
+
+// Problems is an error listing every problem found at once
+type Problems []Problem
+
+func (p Problems) Error() string {
+	list := make([]string, len(p))
+	for i, problem := range p {
+		list[i] = problem.String()
+	}
+	return strings.Join(list, "; ")
+}
+
+// Validate checks the fields of a config, every problem is returned as
+// Problems
+func Validate(cfg *Config) error {
+	if problems := validate(cfg); len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func validate(cfg *Config) Problems {
+	v := validator.New()
+	v.RegisterTagNameFunc(fieldName)
+	v.RegisterValidation("cron", func(fl validator.FieldLevel) bool {
+		_, err := cron.Parse(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("timezone", func(fl validator.FieldLevel) bool {
+		_, err := time.LoadLocation(fl.Field().String())
+		return err == nil
+	})
+	var problems Problems
+	if err := v.Struct(cfg); err != nil {
+		errs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			return Problems{{Message: err.Error()}}
+		}
+		for _, fe := range errs {
+			// Namespaces start with the name of the Config type
+			path := fe.Namespace()
+			if i := strings.IndexByte(path, '.'); i >= 0 {
+				path = path[i+1:]
+			}
+			problems = append(problems, Problem{Path: path, Message: validationMessage(fe)})
+		}
+	}
+	// A freeze is either a single window or a recurring one
+	for i, f := range cfg.Freezes {
+		if f.Cron == "" {
+			continue
+		}
+		if f.Start != nil {
+			problems = append(problems, Problem{Path: fmt.Sprintf("freezes[%d].start", i), Message: "cannot be combined with cron"})
+		}
+		if f.End != nil {
+			problems = append(problems, Problem{Path: fmt.Sprintf("freezes[%d].end", i), Message: "cannot be combined with cron"})
+		}
+	}
+	// Validation tags do not apply to nested structs
+	for i, env := range cfg.Environments {
+		if err := spec.ValidateHooks(env.Hooks); err != nil {
+			problems = append(problems, Problem{Path: fmt.Sprintf("environments[%d].hooks", i), Message: err.Error()})
+		}
+	}
+	return problems
+}
+
+// validationMessage words the validation tags the config uses
+func validationMessage(fe validator.FieldError) string {
+	param := fe.Param()
+	if param != "" && (fe.Tag() == "required_with" || fe.Tag() == "required_without") {
+		// Parameters name Go fields
+		param = strings.ToLower(param[:1]) + param[1:]
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_with":
+		return "is required with " + param
+	case "required_without":
+		return "is required without " + param
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "gte":
+		return "must be at least " + param
+	case "min":
+		if k := fe.Kind(); k == reflect.Slice || k == reflect.Map {
+			return "needs at least " + param + " items"
+		}
+		return "must be at least " + param
+	case "cron":
+		return "is not a valid cron expression"
+	case "timezone":
+		return "is not a known time zone"
+	}
+	return fmt.Sprintf("fails the %s check", fe.Tag())
+}
+
+// Check reads a config from its layers as Load does and reports every
+// problem found rather than the first: fields of the file which are not part
+// of the config or do not decode, variables and flags which do not parse and
+// fields failing validation. Problems with fields of the file have the line
+// of the field, as far as it can be found. The error is about reading the
+// file.
+func Check(l Layers) (Problems, error) {
+	var raw []byte
+	var values map[string]interface{}
+	var problems Problems
+	if l.File != "" {
+		var err error
+		if raw, err = ioutil.ReadFile(l.File); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s:%v", l.File, err)
+		}
+		if values, err = readFile(l.File); err != nil {
+			return Problems{{Line: errorLine(err), Message: err.Error()}}, nil
+		}
+		problems = checkValues(values, reflect.TypeOf(Config{}), "")
+		for i := range problems {
+			problems[i].Line = lineOf(raw, problems[i].Path)
+		}
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	}
+	cfg, sources, loadProblems, err := load(l, values)
+	if err != nil {
+		return append(problems, Problem{Message: err.Error()}), nil
+	}
+	problems = append(problems, loadProblems...)
+	for _, p := range validate(cfg) {
+		path := p.Path
+		if p.Message == "is required" {
+			// Missing fields are pointed at by their parent
+			path = ""
+			if i := strings.LastIndexByte(p.Path, '.'); i >= 0 {
+				path = p.Path[:i]
+			}
+		}
+		if path != "" && fromFile(sources, path) {
+			p.Line = lineOf(raw, path)
+		}
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
+
+// errorLine finds the line parsers mention in their errors, 0 if none
+func errorLine(err error) int {
+	m := regexp.MustCompile(`line (\d+)`).FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// fromFile reports whether the config file set the field at path, the list
+// holding it or fields of the struct it is
+func fromFile(sources Sources, path string) bool {
+	for field, source := range sources {
+		if source != SourceFile {
+			continue
+		}
+		if path == field || strings.HasPrefix(path, field+".") || strings.HasPrefix(path, field+"[") ||
+			strings.HasPrefix(field, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// checkValues reports the values of a file which are not fields of t or do
+// not decode into them, and removes them so that the rest still loads
+func checkValues(values map[string]interface{}, t reflect.Type, path string) Problems {
+	var problems Problems
+	for key, value := range values {
+		p := key
+		if path != "" {
+			p = path + "." + key
+		}
+		sf, ok := findField(t, key)
+		if !ok {
+			message := "is not a known field"
+			if name := suggest(t, key); name != "" {
+				message += fmt.Sprintf(", did you mean %s?", name)
+			}
+			problems = append(problems, Problem{Path: p, Message: message})
+			delete(values, key)
+			continue
+		}
+		if !checkValue(value, sf.Type, p, &problems) {
+			delete(values, key)
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems
+}
+
+// checkValue reports whether value decodes into type t, structs, lists and
+// maps are checked item by item
+func checkValue(value interface{}, t reflect.Type, path string, problems *Problems) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch {
+		case t.Kind() == reflect.Struct && t != timeType:
+			*problems = append(*problems, checkValues(v, t, path)...)
+			return true
+		case t.Kind() == reflect.Map:
+			ok := true
+			for key, item := range v {
+				ok = checkValue(item, t.Elem(), path+"."+key, problems) && ok
+			}
+			return ok
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice {
+			ok := true
+			for i, item := range v {
+				ok = checkValue(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems) && ok
+			}
+			return ok
+		}
+	case []map[string]interface{}:
+		// Arrays of tables in TOML
+		if t.Kind() == reflect.Slice {
+			ok := true
+			for i, item := range v {
+				ok = checkValue(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems) && ok
+			}
+			return ok
+		}
+	}
+	raw, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(raw, reflect.New(t).Interface())
+	}
+	if err != nil {
+		message := err.Error()
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			message = fmt.Sprintf("must be %s, not %s", typeName(t), te.Value)
+		}
+		*problems = append(*problems, Problem{Path: path, Message: message})
+		return false
+	}
+	return true
+}
+
+// typeName names the type of values in config files
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	}
+	return "an object"
+}
+
+// findField finds the field of struct t named key, regardless of case as
+// when decoding
+func findField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		if sf.Anonymous && sf.Tag.Get("json") == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f, ok := findField(ft, key); ok {
+				return f, true
+			}
+			continue
+		}
+		if name := fieldName(sf); name != "-" && strings.EqualFold(name, key) {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// suggest returns the field of t closest to a mistyped key, if one is close
+func suggest(t reflect.Type, key string) string {
+	best, distance := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := fieldName(sf)
+		if sf.PkgPath != "" || name == "-" {
+			continue
+		}
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < distance {
+			best, distance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minOf(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minOf(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// lineOf finds the line of a field in a YAML, JSON or TOML file by looking
+// for the keys of its path one after the other and counting the items of
+// lists, 0 if the first key is not found. Keys are not matched against the
+// structure of the file, so lines are a good guess rather than exact.
+func lineOf(raw []byte, path string) int {
+	text := string(raw)
+	pos, line := 0, 0
+	for _, part := range strings.Split(path, ".") {
+		key, index := part, -1
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			key = part[:i]
+			fmt.Sscanf(part[i:], "[%d]", &index)
+		}
+		pattern := regexp.MustCompile(`(?im)(^|[\s{,."'\[])` + regexp.QuoteMeta(key) + `["']?(\s*[:=]|\]\]?)`)
+		loc := pattern.FindStringIndex(text[pos:])
+		if loc == nil {
+			return line
+		}
+		header := strings.HasSuffix(text[pos:pos+loc[1]], "]]")
+		pos += loc[1]
+		line = 1 + strings.Count(text[:pos], "\n")
+		if index < 0 {
+			continue
+		}
+		// Items are TOML tables repeating the header, YAML entries starting
+		// with a dash at the indent of the first or JSON objects
+		item, n := pattern, index
+		if !header {
+			first := regexp.MustCompile(`(?m)^([ \t]*)-\s|\{`).FindStringSubmatchIndex(text[pos:])
+			if first == nil {
+				return line
+			}
+			if first[2] >= 0 {
+				item = regexp.MustCompile(`(?m)^` + text[pos+first[2]:pos+first[3]] + `-\s`)
+			} else {
+				item = regexp.MustCompile(`\{`)
+			}
+			pos += first[1]
+		}
+		for i := 0; i < n; i++ {
+			loc := item.FindStringIndex(text[pos:])
+			if loc == nil {
+				return line
+			}
+			pos += loc[1]
+		}
+		line = 1 + strings.Count(text[:pos], "\n")
+	}
+	return line
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "deployer.yaml")
+	err := ioutil.WriteFile(file, []byte(`mode: server
+limits:
+  burts: 5
+  maxBodyBytes: lots
+ha:
+  leaseTTL: 5s
+schedules:
+  - name: nightly
+    cron: "0 3 * * *"
+    target: web
+    workers: [a]
+  - name: broken
+    cron: "not a cron"
+    target: web
+freezes:
+  - name: weekends
+    cron: "0 0 * * 6"
+    duration: 48h
+    start: 2020-05-15T00:00:00Z
+    end: 2020-05-16T00:00:00Z
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Check(Layers{File: file, Env: []string{"DEPLOYER_LIMITS_BURST=many"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{
+		"limits.burts":         3,
+		"limits.maxBodyBytes":  4,
+		"limits.burst":         0,
+		"ha.advertiseAddr":     5,
+		"schedules[1].cron":    13,
+		"schedules[1].workers": 12,
+		"freezes[0].start":     19,
+		"freezes[0].end":       20,
+	}
+	for _, p := range problems {
+		line, ok := expected[p.Path]
+		if !ok {
+			t.Errorf("unexpected problem %s", p)
+			continue
+		}
+		if p.Line != line {
+			t.Errorf("expected %s at line %d, got %d", p.Path, line, p.Line)
+		}
+		delete(expected, p.Path)
+	}
+	if len(expected) > 0 {
+		t.Errorf("expected problems with %v, got %v", expected, problems)
+	}
+
+	if err := Validate(Defaults()); err != nil {
+		t.Errorf("expected the defaults to be valid, got %v", err)
+	}
+}
@@ -1,40 +1,251 @@
 package config
 
 import (
-	"fmt"
-	"io/ioutil"
+	"time"
 
-	"github.com/go-playground/validator"
-	"sigs.k8s.io/yaml"
+	"github.com/beacon/deployer/pkg/api"
 )
 
 type Config struct {
 	Mode string `json:"mode,omitempty" validate:"oneof=server worker"`
 	Addr string `json:"addr,omitempty"`
 
+	// LogLevel is info, the default, or debug which logs every request
+	// received as well
+	LogLevel string `json:"logLevel,omitempty" validate:"omitempty,oneof=debug info"`
+
 	TLS *TLSConfig `json:"tls,omitempty"`
+
+	Limits *LimitsConfig `json:"limits,omitempty"`
+
+	// DataDir keeps server state across restarts, state is kept in memory if empty
+	DataDir string `json:"dataDir,omitempty"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	ShutdownTimeout Duration `json:"shutdownTimeout,omitempty"`
+
+	Recovery *RecoveryConfig `json:"recovery,omitempty"`
+
+	HA *HAConfig `json:"ha,omitempty"`
+
+	// RequireApproval lists environments whose deployments wait for approval
+	RequireApproval []string `json:"requireApproval,omitempty"`
+
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	Secrets *SecretsConfig `json:"secrets,omitempty"`
+
+	Blobs *BlobsConfig `json:"blobs,omitempty"`
+
+	Drift *DriftConfig `json:"drift,omitempty"`
+
+	Schedules []ScheduleConfig `json:"schedules,omitempty" validate:"dive"`
+
+	Freezes []FreezeConfig `json:"freezes,omitempty" validate:"dive"`
+
+	Pipelines []PipelineConfig `json:"pipelines,omitempty" validate:"dive"`
+
+	Environments []EnvironmentConfig `json:"environments,omitempty" validate:"dive"`
+
+	// IdempotencyKeyTTL is how long the server remembers the Idempotency-Key
+	// of submitted actions, 24h if zero
+	IdempotencyKeyTTL Duration `json:"idempotencyKeyTTL,omitempty"`
+
+	// AllowExecProbes lets deployments verify workers with commands run on
+	// the server, anyone allowed to deploy can then run commands on it.
+	// Probes are not run on workers.
+	AllowExecProbes bool `json:"allowExecProbes,omitempty"`
+}
+
+// Log levels
+const (
+	LogDebug = "debug"
+	LogInfo  = "info"
+)
+
+// BlobsConfig enables the blob store keeping files deployments reference by
+// digest. Replicas sharing a store must share the blob dir as well.
+type BlobsConfig struct {
+	// Dir holds the blobs, "blobs" under the data dir if empty
+	Dir string `json:"dir,omitempty"`
+	// Retain is how many deployments of every target and environment keep
+	// their blobs from garbage collection, 10 if zero
+	Retain int `json:"retain,omitempty" validate:"gte=0"`
+	// GCInterval is how often unused blobs are removed, hourly if zero
+	GCInterval Duration `json:"gcInterval,omitempty"`
+	// GracePeriod keeps blobs uploaded recently, which deployments may not
+	// reference yet, an hour if zero
+	GracePeriod Duration `json:"gracePeriod,omitempty"`
+}
+
+// DriftConfig decides what happens when workers report a workspace which is
+// no longer what their last successful deployment left
+type DriftConfig struct {
+	// Reconcile deploys the last successful deployment again on workers
+	// which drifted, once per drift
+	Reconcile bool `json:"reconcile,omitempty"`
+}
+
+// EnvironmentConfig holds what every deployment to an environment gets
+type EnvironmentConfig struct {
+	Name string `json:"name" validate:"required"`
+	// Hooks run around the ones deployments declare in their spec
+	Hooks *api.Hooks `json:"hooks,omitempty"`
+}
+
+// PipelineConfig is an ordered chain of environments a target is promoted
+// through, the values deployed to a stage move on unchanged to the next one
+type PipelineConfig struct {
+	Name   string        `json:"name" validate:"required"`
+	Target string        `json:"target" validate:"required"`
+	Stages []StageConfig `json:"stages" validate:"min=2,dive"`
 }
 
+// StageConfig is an environment of a pipeline
+type StageConfig struct {
+	Env string `json:"env" validate:"required"`
+	// Workers and Selector pick the workers deployments promoted to the
+	// stage run on
+	Workers  []string          `json:"workers,omitempty"`
+	Selector map[string]string `json:"selector,omitempty"`
+	// Overlay values are merged over the promoted values in this stage only.
+	// Promoted files are not rendered again, the overlay only reaches what
+	// reads values on workers.
+	Overlay map[string]interface{} `json:"overlay,omitempty"`
+	// Soak is how long a deployment must stay healthy in this stage before
+	// it may be promoted to the next one
+	Soak Duration `json:"soak,omitempty"`
+}
+
+// FreezeConfig is a period deployments to some environments may not start,
+// either a single window from Start to End, or a recurring one starting every
+// time Cron fires and lasting Duration
+type FreezeConfig struct {
+	Name string `json:"name" validate:"required"`
+	// Envs lists the environments frozen, every environment if empty
+	Envs []string `json:"envs,omitempty"`
+	// Mode is hold, keeping deployments pending, or refuse, rejecting new
+	// ones. hold if empty.
+	Mode   string `json:"mode,omitempty" validate:"omitempty,oneof=hold refuse"`
+	Reason string `json:"reason,omitempty"`
+
+	Start *time.Time `json:"start,omitempty" validate:"required_without=Cron"`
+	End   *time.Time `json:"end,omitempty" validate:"required_with=Start"`
+
+	Cron     string   `json:"cron,omitempty" validate:"omitempty,cron"`
+	Duration Duration `json:"duration,omitempty" validate:"required_with=Cron"`
+	// Timezone Cron is evaluated in, UTC if empty
+	Timezone string `json:"timezone,omitempty" validate:"omitempty,timezone"`
+}
+
+// Catch-up policies for scheduled runs missed while no server was running
+const (
+	// CatchUpSkip records missed runs as skipped
+	CatchUpSkip = "skip"
+	// CatchUpOnce fires a single run in place of all the missed ones
+	CatchUpOnce = "once"
+	// CatchUpAll fires every missed run, up to the last five
+	CatchUpAll = "all"
+)
+
+// ScheduleConfig deploys a target on a cron schedule
+type ScheduleConfig struct {
+	Name string `json:"name" validate:"required"`
+	// Cron is a five field cron expression, or a macro such as @daily
+	Cron string `json:"cron" validate:"required,cron"`
+	// Timezone the expression is evaluated in, UTC if empty
+	Timezone string `json:"timezone,omitempty" validate:"omitempty,timezone"`
+	// CatchUp is the policy for missed runs, once if empty
+	CatchUp string `json:"catchUp,omitempty" validate:"omitempty,oneof=skip once all"`
+
+	Target  string                 `json:"target" validate:"required"`
+	Env     string                 `json:"env,omitempty"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+	Workers []string               `json:"workers" validate:"required"`
+}
+
+// AuthConfig requires clients to present one of the tokens, as a bearer
+// token on REST and as authorization metadata on grpc
+type AuthConfig struct {
+	Tokens []TokenConfig `json:"tokens" validate:"dive"`
+}
+
+// TokenConfig is a token and the identity it stands for
+type TokenConfig struct {
+	Name  string `json:"name" validate:"required"`
+	Token string `json:"token" validate:"required" secret:"true"`
+	// Secrets lets the token read secret values, for rendering outside of
+	// workers. Values cannot be read at all without auth.
+	Secrets bool `json:"secrets,omitempty"`
+}
+
+// SecretsConfig enables the secrets store
+type SecretsConfig struct {
+	// KeyFile holds the base64 encoded 32 bytes key secrets are encrypted
+	// with, see "deployer secrets keygen"
+	KeyFile string `json:"keyFile" validate:"required"`
+}
+
+// HAConfig lets several servers share a store, only the one holding the
+// leader lease runs the scheduler and the others forward writes to it
+type HAConfig struct {
+	// ID names this replica, a random one is picked if empty
+	ID string `json:"id,omitempty"`
+	// AdvertiseAddr is the host:port other replicas reach this one at
+	AdvertiseAddr string `json:"advertiseAddr" validate:"required"`
+	// LeaseTTL is how long the leader lease lasts without renewal
+	LeaseTTL Duration `json:"leaseTTL,omitempty"`
+}
+
+// TLSConfig is the certificate the server serves and presents to workers and
+// other replicas, see "deployer certs init"
 type TLSConfig struct {
-	CertFile string
-	KeyFile  string
+	CertFile string `json:"certFile" validate:"required"`
+	KeyFile  string `json:"keyFile" validate:"required"`
+	// CAFile verifies the certificates of workers and other replicas, system
+	// roots are used if empty
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// LimitsConfig bounds what a single client may ask of the server.
+// Zero values disable the corresponding limit. Limits are on by default,
+// with the defaults below, set a limit to 0 to turn it off.
+type LimitsConfig struct {
+	// MaxBodyBytes is the largest REST request body accepted, 10MiB by
+	// default
+	MaxBodyBytes int64 `json:"maxBodyBytes,omitempty" validate:"gte=0"`
+	// MaxBlobBytes is the largest blob uploaded, it replaces MaxBodyBytes
+	// for blob uploads. 1GiB by default.
+	MaxBlobBytes int64 `json:"maxBlobBytes,omitempty" validate:"gte=0"`
+	// MaxMsgBytes is the largest gRPC message accepted, 4MiB by default
+	MaxMsgBytes int `json:"maxMsgBytes,omitempty" validate:"gte=0"`
+	// RatePerSecond is the sustained request rate allowed per identity, 20
+	// by default
+	RatePerSecond float64 `json:"ratePerSecond,omitempty" validate:"gte=0"`
+	// Burst is the number of requests an identity may send at once, 40 by
+	// default
+	Burst int `json:"burst,omitempty" validate:"gte=0"`
+}
+
+// Recovery policies for deployments no worker can account for after a restart
+const (
+	// RecoveryResume keeps waiting for workers to report, until StaleAfter
+	RecoveryResume = "resume"
+	// RecoveryFail marks the deployment failed
+	RecoveryFail = "fail"
+	// RecoveryRequeue dispatches the deployment to its workers again
+	RecoveryRequeue = "requeue"
+)
+
+// RecoveryConfig decides what happens to in-flight deployments after a restart
+type RecoveryConfig struct {
+	Policy string `json:"policy,omitempty" validate:"omitempty,oneof=resume fail requeue"`
+	// StaleAfter fails running deployments which received no update for this long
+	StaleAfter Duration `json:"staleAfter,omitempty"`
 }
 
+// New reads a config file over the defaults, see Load for environment
+// variables and flags
 func New(file string) (*Config, error) {
-	// Provide default values
-	cfg := &Config{
-		Addr: ":9000",
-	}
-	raw, err := ioutil.ReadFile(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file %s:%v", file, err)
-	}
-	if err := yaml.Unmarshal(raw, cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file %s:%v", file, err)
-	}
-	return cfg, nil
-}
-
-func Validate(cfg *Config) error {
-	return validator.New().Struct(cfg)
+	cfg, _, err := Load(Layers{File: file})
+	return cfg, err
 }
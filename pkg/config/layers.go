@@ -0,0 +1,366 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"sigs.k8s.io/yaml"
+)
+
+// Sources of config values, from the lowest to the highest precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// EnvPrefix starts the environment variables setting config fields
+const EnvPrefix = "DEPLOYER_"
+
+// Layers are where a config is read from. The config file overrides the
+// defaults, DEPLOYER_* environment variables override the file and flags
+// override everything else.
+type Layers struct {
+	// File is a YAML, JSON or TOML config file, TOML if it ends in .toml.
+	// There is none if empty.
+	File string
+	// Env lists environment variables as KEY=value, as os.Environ does.
+	// Variables naming no field are ignored, the environment holds others.
+	Env []string
+	// Flags sets fields by path, such as limits.burst
+	Flags map[string]string
+}
+
+// Sources tells which layer set every field, by path. Fields missing were
+// left to their default.
+type Sources map[string]string
+
+// Field is a config field layers may set. Values of structs nested in the
+// config are fields of their own, lists and maps are set as a whole.
+type Field struct {
+	// Path names the field in config files, such as limits.burst
+	Path string
+	// Env is the environment variable setting the field, such as
+	// DEPLOYER_LIMITS_BURST
+	Env   string
+	index []int
+}
+
+// Value is a field of an effective config and the layer which set it
+type Value struct {
+	Path   string      `json:"path"`
+	Env    string      `json:"env"`
+	Value  interface{} `json:"value,omitempty"`
+	Source string      `json:"source"`
+}
+
+// Defaults is the config before any layer applies
+func Defaults() *Config {
+	return &Config{
+		Mode: "server",
+		Addr: ":9000",
+		Limits: &LimitsConfig{
+			MaxBodyBytes:  10 << 20,
+			MaxBlobBytes:  1 << 30,
+			MaxMsgBytes:   4 << 20,
+			RatePerSecond: 20,
+			Burst:         40,
+		},
+		ShutdownTimeout: Duration(30 * time.Second),
+		Recovery: &RecoveryConfig{
+			Policy:     RecoveryRequeue,
+			StaleAfter: Duration(time.Hour),
+		},
+	}
+}
+
+// Load applies the layers over the defaults, the config is not validated.
+// Variables and flags which do not parse are reported together as Problems.
+func Load(l Layers) (*Config, Sources, error) {
+	var values map[string]interface{}
+	if l.File != "" {
+		var err error
+		if values, err = readFile(l.File); err != nil {
+			return nil, nil, err
+		}
+	}
+	cfg, sources, problems, err := load(l, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(problems) > 0 {
+		return nil, nil, problems
+	}
+	return cfg, sources, nil
+}
+
+// load applies the values read from the file and the other layers over the
+// defaults, the error is about values failing to decode
+func load(l Layers, values map[string]interface{}) (*Config, Sources, Problems, error) {
+	cfg := Defaults()
+	sources := make(Sources)
+	fields := Fields()
+	if values != nil {
+		raw, err := json.Marshal(values)
+		if err == nil {
+			err = yaml.Unmarshal(raw, cfg)
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse config file %s:%v", l.File, err)
+		}
+		for _, f := range fields {
+			if lookup(values, strings.Split(f.Path, ".")) {
+				sources[f.Path] = SourceFile
+			}
+		}
+	}
+	byEnv := make(map[string]Field, len(fields))
+	byPath := make(map[string]Field, len(fields))
+	for _, f := range fields {
+		byEnv[f.Env] = f
+		byPath[f.Path] = f
+	}
+	var problems Problems
+	for _, kv := range l.Env {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || !strings.HasPrefix(kv, EnvPrefix) {
+			continue
+		}
+		f, ok := byEnv[kv[:i]]
+		if !ok {
+			continue
+		}
+		if err := f.set(cfg, kv[i+1:]); err != nil {
+			problems = append(problems, Problem{Path: f.Path, Message: fmt.Sprintf("invalid %s:%v", f.Env, err)})
+			continue
+		}
+		sources[f.Path] = SourceEnv
+	}
+	paths := make([]string, 0, len(l.Flags))
+	for path := range l.Flags {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		f, ok := byPath[path]
+		if !ok {
+			problems = append(problems, Problem{Path: path, Message: "unknown config field"})
+			continue
+		}
+		if err := f.set(cfg, l.Flags[path]); err != nil {
+			problems = append(problems, Problem{Path: path, Message: fmt.Sprintf("invalid flag:%v", err)})
+			continue
+		}
+		sources[f.Path] = SourceFlag
+	}
+	return cfg, sources, problems, nil
+}
+
+// readFile parses a config file into generic values, so that the fields it
+// sets can be told apart from the defaults
+func readFile(file string) (map[string]interface{}, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s:%v", file, err)
+	}
+	values := make(map[string]interface{})
+	if strings.EqualFold(filepath.Ext(file), ".toml") {
+		err = toml.Unmarshal(raw, &values)
+	} else {
+		err = yaml.Unmarshal(raw, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s:%v", file, err)
+	}
+	return values, nil
+}
+
+// lookup tells whether values hold path, keys match regardless of case as
+// when decoding them
+func lookup(values map[string]interface{}, path []string) bool {
+	for k, v := range values {
+		if !strings.EqualFold(k, path[0]) {
+			continue
+		}
+		if len(path) == 1 {
+			return true
+		}
+		if nested, ok := v.(map[string]interface{}); ok && lookup(nested, path[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields lists the fields of the config in the order they are declared
+func Fields() []Field {
+	return fields(reflect.TypeOf(Config{}), nil, nil)
+}
+
+func fields(t reflect.Type, path []string, index []int) []Field {
+	var list []Field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := fieldName(sf)
+		if sf.PkgPath != "" || name == "-" {
+			continue
+		}
+		p := append(append([]string(nil), path...), name)
+		idx := append(append([]int(nil), index...), i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			list = append(list, fields(ft, p, idx)...)
+			continue
+		}
+		list = append(list, Field{Path: strings.Join(p, "."), Env: envName(p), index: idx})
+	}
+	return list
+}
+
+// fieldName is the name of a field in config files
+func fieldName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(sf.Name[:1]) + sf.Name[1:]
+}
+
+// envName spells a path as an environment variable, limits.maxBodyBytes
+// becoming DEPLOYER_LIMITS_MAX_BODY_BYTES
+func envName(path []string) string {
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+	for i, name := range path {
+		if i > 0 {
+			b.WriteByte('_')
+		}
+		runes := []rune(name)
+		for j, r := range runes {
+			// Words start with an upper case letter after a lower case one,
+			// or before a lower case one as in leaseTTLValue
+			if j > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[j-1]) ||
+				j+1 < len(runes) && unicode.IsLower(runes[j+1]) && unicode.IsUpper(runes[j-1])) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// value returns the field of cfg, nil if a struct holding it is not set
+func (f Field) value(cfg *Config) (reflect.Value, bool) {
+	v := reflect.ValueOf(cfg).Elem()
+	for n, i := range f.index {
+		v = v.Field(i)
+		if n < len(f.index)-1 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+	}
+	return v, true
+}
+
+// set parses value into the field of cfg, creating the structs holding it.
+// Lists of strings may be comma separated, other lists and maps are written
+// in YAML or JSON.
+func (f Field) set(cfg *Config, value string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for n, i := range f.index {
+		v = v.Field(i)
+		if n < len(f.index)-1 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String &&
+		!strings.HasPrefix(strings.TrimSpace(value), "["):
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = reflect.Append(list, reflect.ValueOf(s).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(list)
+		return nil
+	}
+	parsed := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+		return err
+	}
+	v.Set(parsed.Elem())
+	return nil
+}
+
+// redactedValue replaces secrets in the values described
+const redactedValue = "*****"
+
+// Describe lists the fields of cfg with the layer which set them, secrets
+// are redacted
+func Describe(cfg *Config, sources Sources) []Value {
+	var values []Value
+	for _, f := range Fields() {
+		source := sources[f.Path]
+		if source == "" {
+			source = SourceDefault
+		}
+		value := Value{Path: f.Path, Env: f.Env, Source: source}
+		// Booleans are shown either way, false is as telling as true
+		if v, ok := f.value(cfg); ok && (!v.IsZero() || v.Kind() == reflect.Bool) {
+			value.Value = redact(v).Interface()
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// redact copies v masking the strings of the fields tagged secret:"true"
+func redact(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redact(v.Index(i)))
+		}
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+			if sf.Tag.Get("secret") == "true" && sf.Type.Kind() == reflect.String && v.Field(i).Len() > 0 {
+				out.Field(i).SetString(redactedValue)
+				continue
+			}
+			out.Field(i).Set(redact(v.Field(i)))
+		}
+		return out
+	}
+	return v
+}
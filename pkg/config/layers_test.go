@@ -0,0 +1,93 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "deployer.toml")
+	err := ioutil.WriteFile(file, []byte(`
+addr = ":7000"
+dataDir = "/var/lib/deployer"
+
+[limits]
+burst = 5
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, sources, err := Load(Layers{
+		File: file,
+		Env: []string{
+			"DEPLOYER_DATA_DIR=/data",
+			"DEPLOYER_HA_LEASE_TTL=5s",
+			// Limits are on by default, 0 turns one off
+			"DEPLOYER_LIMITS_MAX_BODY_BYTES=0",
+			"DEPLOYER_HA_ADVERTISE_ADDR=deployer-0:9000",
+			`DEPLOYER_AUTH_TOKENS=[{"name":"ci","token":"hunter2"}]`,
+			// Probes get variables of their own
+			"DEPLOYER_ENV=prod",
+			"HOME=/root",
+		},
+		Flags: map[string]string{"addr": ":8000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":8000" || cfg.DataDir != "/data" || cfg.Limits.Burst != 5 || cfg.Limits.RatePerSecond != 20 || cfg.Limits.MaxBodyBytes != 0 {
+		t.Errorf("unexpected config %+v %+v", cfg, cfg.Limits)
+	}
+	if cfg.HA == nil || time.Duration(cfg.HA.LeaseTTL) != 5*time.Second || len(cfg.Auth.Tokens) != 1 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	expected := map[string]string{
+		"mode":         SourceDefault,
+		"addr":         SourceFlag,
+		"dataDir":      SourceEnv,
+		"limits.burst": SourceFile,
+		"ha.leaseTTL":  SourceEnv,
+	}
+	for _, v := range Describe(cfg, sources) {
+		if source, ok := expected[v.Path]; ok && v.Source != source {
+			t.Errorf("expected %s from %s, got %s", v.Path, source, v.Source)
+		}
+		if v.Path == "auth.tokens" && v.Value.([]TokenConfig)[0].Token != redactedValue {
+			t.Errorf("expected tokens to be redacted, got %+v", v.Value)
+		}
+	}
+	if cfg.Auth.Tokens[0].Token != "hunter2" {
+		t.Error("expected redacting not to change the config")
+	}
+
+	if _, _, err := Load(Layers{Env: []string{"DEPLOYER_LIMITS_BURST=many"}}); err == nil {
+		t.Error("expected an invalid variable to fail")
+	}
+	if _, _, err := Load(Layers{Flags: map[string]string{"limits.rate": "1"}}); err == nil {
+		t.Error("expected an unknown field to fail")
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for path, expected := range map[string]string{
+		"limits.maxBodyBytes": "DEPLOYER_LIMITS_MAX_BODY_BYTES",
+		"ha.leaseTTL":         "DEPLOYER_HA_LEASE_TTL",
+		"idempotencyKeyTTL":   "DEPLOYER_IDEMPOTENCY_KEY_TTL",
+		"tls.certFile":        "DEPLOYER_TLS_CERT_FILE",
+	} {
+		var env string
+		for _, f := range Fields() {
+			if f.Path == path {
+				env = f.Env
+			}
+		}
+		if env != expected {
+			t.Errorf("expected %s for %s, got %q", expected, path, env)
+		}
+	}
+}
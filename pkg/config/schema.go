@@ -0,0 +1,20 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/beacon/deployer/pkg/schema"
+)
+
+// Schema is the JSON Schema of config files, for editors to complete fields
+// and CI to lint them. Files written in TOML follow it as well once decoded.
+func Schema() schema.Schema {
+	g := schema.New("#/$defs/")
+	root := g.For(reflect.TypeOf(Config{}))
+	return schema.Schema{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "deployer config",
+		"$ref":    root["$ref"],
+		"$defs":   g.Definitions,
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// Watch calls changed whenever the content of file changes, until ctx is
+// done. The file is polled every interval, editors replacing the file
+// rather than writing it in place are noticed as well.
+func Watch(ctx context.Context, file string, interval time.Duration, changed func()) {
+	sum := func() []byte {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			// Editors may remove the file for a moment, wait for it
+			return nil
+		}
+		s := sha256.Sum256(raw)
+		return s[:]
+	}
+	last := sum()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := sum()
+		if current == nil || bytes.Equal(current, last) {
+			continue
+		}
+		last = current
+		log.Println("Config file", file, "changed")
+		changed()
+	}
+}
@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	from := time.Date(2020, 5, 15, 10, 30, 20, 0, time.UTC) // a Friday
+	cases := []struct {
+		expr string
+		next string
+	}{
+		{"* * * * *", "2020-05-15T10:31:00Z"},
+		{"*/15 * * * *", "2020-05-15T10:45:00Z"},
+		{"0 2 * * *", "2020-05-16T02:00:00Z"},
+		{"@daily", "2020-05-16T00:00:00Z"},
+		{"0 9 * * mon-fri", "2020-05-18T09:00:00Z"},
+		{"0 0 * * 7", "2020-05-17T00:00:00Z"},
+		{"30 4 1,15 * *", "2020-06-01T04:30:00Z"},
+		{"0 0 1 jan *", "2021-01-01T00:00:00Z"},
+		// Either day field matches when both are restricted
+		{"0 0 20 * mon", "2020-05-18T00:00:00Z"},
+		{"0 0 29 2 *", "2024-02-29T00:00:00Z"},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if got := s.Next(from).Format(time.RFC3339); got != c.next {
+			t.Errorf("%s: expected %s, got %s", c.expr, c.next, got)
+		}
+	}
+
+	s, _ := Parse("0 0 30 2 *")
+	if next := s.Next(from); !next.IsZero() {
+		t.Errorf("expected February 30th never to fire, got %s", next)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "* * * * funday"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}
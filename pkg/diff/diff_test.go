@@ -0,0 +1,128 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// lcs is the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] > dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestLineEdits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		var gotA, gotB []string
+		kept := 0
+		for _, e := range lineEdits(a, b) {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+			if e.op == ' ' {
+				kept++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("edits of %v and %v do not rebuild them: %v %v", a, b, gotA, gotB)
+		}
+		if want := lcs(a, b); kept != want {
+			t.Fatalf("edits of %v and %v keep %d lines instead of %d", a, b, kept, want)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	want := `--- a/f
++++ b/f
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+`
+	if got := Unified("a/f", "b/f", a, b, DefaultContext); got != want {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+	want = "--- /dev/null\n+++ b/f\n@@ -0,0 +1 @@\n+x\n"
+	if got := Unified("/dev/null", "b/f", "", "x\n", DefaultContext); got != want {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+	if got := Unified("a/f", "b/f", a, a, DefaultContext); got != "" {
+		t.Errorf("expected no diff, got:\n%s", got)
+	}
+}
+
+func TestValues(t *testing.T) {
+	a, err := Parse("app.yaml", []byte("kind: Deployment\nspec:\n  replicas: 2\n  image: web:1\n  ports: [80]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Key order and formatting do not matter
+	b, err := Parse("app.json", []byte(`{"spec":{"ports":[80,443],"image":"web:2","replicas":2},"kind":"Deployment","my.key":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []api.ValueChange{
+		{Path: `["my.key"]`, Kind: api.ChangeAdded, To: true},
+		{Path: "spec.image", Kind: api.ChangeModified, From: "web:1", To: "web:2"},
+		{Path: "spec.ports[1]", Kind: api.ChangeAdded, To: float64(443)},
+	}
+	if got := Values(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected changes %v", got)
+	}
+	if got := Values(a, a); len(got) != 0 {
+		t.Errorf("expected no change, got %v", got)
+	}
+
+	docs, err := Parse("all.yml", []byte("---\na: 1\n---\n# empty\n---\nb: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, ok := docs.([]interface{}); !ok || len(list) != 2 {
+		t.Errorf("expected 2 documents, got %v", docs)
+	}
+	if _, err := Parse("bad.json", []byte("{")); err == nil {
+		t.Error("expected invalid JSON to fail")
+	}
+}
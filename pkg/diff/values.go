@@ -0,0 +1,140 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// Values lists what changes from a to b, both holding decoded JSON such as
+// maps, slices and scalars. Map keys are visited in order, list items by
+// position.
+func Values(a, b interface{}) []api.ValueChange {
+	changes := []api.ValueChange{}
+	compare("", a, b, &changes)
+	return changes
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func keyPath(prefix, key string) string {
+	if !identifier.MatchString(key) {
+		return fmt.Sprintf("%s[%q]", prefix, key)
+	}
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func compare(p string, a, b interface{}, changes *[]api.ValueChange) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		*changes = append(*changes, api.ValueChange{Path: p, Kind: api.ChangeAdded, To: b})
+		return
+	case b == nil:
+		*changes = append(*changes, api.ValueChange{Path: p, Kind: api.ChangeRemoved, From: a})
+		return
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			compare(keyPath(p, k), av[k], bv[k], changes)
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			var ai, bi interface{}
+			if i < len(av) {
+				ai = av[i]
+			}
+			if i < len(bv) {
+				bi = bv[i]
+			}
+			compare(fmt.Sprintf("%s[%d]", p, i), ai, bi, changes)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, api.ValueChange{Path: p, Kind: api.ChangeModified, From: a, To: b})
+	}
+}
+
+// Structured reports whether the file at name holds YAML or JSON, from its
+// extension
+func Structured(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// Parse decodes the documents of a YAML or JSON file. A single document is
+// returned as is, several ones as a list. Empty documents are skipped.
+func Parse(name string, data []byte) (interface{}, error) {
+	if strings.ToLower(path.Ext(name)) == ".json" {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("failed to parse %s:%v", name, err)
+		}
+		return v, nil
+	}
+	var docs []interface{}
+	for i, raw := range splitDocuments(string(data)) {
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(raw), &v); err != nil {
+			return nil, fmt.Errorf("failed to parse document %d of %s:%v", i+1, name, err)
+		}
+		if v != nil {
+			docs = append(docs, v)
+		}
+	}
+	if len(docs) == 1 {
+		return docs[0], nil
+	}
+	return docs, nil
+}
+
+// splitDocuments splits a YAML stream on its "---" separators
+func splitDocuments(s string) []string {
+	var docs []string
+	var doc strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if trimmed := strings.TrimRight(line, " \t\r\n"); trimmed == "---" || strings.HasPrefix(trimmed, "--- ") {
+			docs = append(docs, doc.String())
+			doc.Reset()
+			continue
+		}
+		doc.WriteString(line)
+	}
+	return append(docs, doc.String())
+}
@@ -0,0 +1,108 @@
+// Package observe lets workers report what the workspace of the deployment
+// they run holds, for the server to detect drift from what was deployed
+package observe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// Observer is an executor specific check of what a deployment set up, such
+// as the resources it created still being present
+type Observer interface {
+	Observe(ctx context.Context, deployment, dir string) []api.ObserveCheck
+}
+
+// ObserverFunc adapts a function to Observer
+type ObserverFunc func(ctx context.Context, deployment, dir string) []api.ObserveCheck
+
+// Observe calls f
+func (f ObserverFunc) Observe(ctx context.Context, deployment, dir string) []api.ObserveCheck {
+	return f(ctx, deployment, dir)
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashDir returns the digests of the files under dir by slash separated
+// relative path, digests are the ones of the blob store
+func HashDir(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		digest, err := hashFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s:%v", path, err)
+		}
+		files[filepath.ToSlash(rel)] = digest
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Workspace hashes the workspace dir of deployment and runs the observers
+func Workspace(ctx context.Context, deployment, dir string, observers ...Observer) (*api.Observation, error) {
+	files, err := HashDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	o := &api.Observation{Deployment: deployment, Files: files}
+	for _, observer := range observers {
+		o.Checks = append(o.Checks, observer.Observe(ctx, deployment, dir)...)
+	}
+	return o, nil
+}
+
+// Run observes the active workspace every interval until ctx is done.
+// active returns the deployment the worker runs and its workspace dir, ok
+// is false while there is none. Failures are logged, the next round tries
+// again.
+func Run(ctx context.Context, interval time.Duration, active func() (deployment, dir string, ok bool),
+	report func(context.Context, *api.Observation) error, observers ...Observer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if deployment, dir, ok := active(); ok {
+			o, err := Workspace(ctx, deployment, dir, observers...)
+			if err == nil {
+				err = report(ctx, o)
+			}
+			if err != nil {
+				log.Println("Failed to observe deployment", deployment, ":", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package observe
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/blob"
+)
+
+func TestWorkspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "app.yaml"), []byte("replicas: 2\n"), 0644)
+
+	present := ObserverFunc(func(ctx context.Context, deployment, dir string) []api.ObserveCheck {
+		return []api.ObserveCheck{{Name: "service", OK: deployment == "d1"}}
+	})
+	o, err := Workspace(context.Background(), "d1", dir, present)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Files) != 1 || o.Files["conf/app.yaml"] != blob.Digest([]byte("replicas: 2\n")) {
+		t.Errorf("expected the digest of the blob store, got %v", o.Files)
+	}
+	if len(o.Checks) != 1 || !o.Checks[0].OK {
+		t.Errorf("unexpected checks %v", o.Checks)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reports := 0
+	Run(ctx, time.Millisecond, func() (string, string, bool) { return "d1", dir, true },
+		func(ctx context.Context, o *api.Observation) error {
+			if reports++; reports == 3 {
+				cancel()
+			}
+			return nil
+		})
+	if reports != 3 {
+		t.Errorf("expected 3 reports, got %d", reports)
+	}
+}
@@ -0,0 +1,279 @@
+// Package pki runs a development certificate authority, issuing the
+// certificates servers and workers present to each other
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Files of the CA in its directory
+const (
+	CACertFile = "ca.crt"
+	CAKeyFile  = "ca.key"
+)
+
+// Default validity of certificates
+const (
+	DefaultCAValidity   = 10 * 365 * 24 * time.Hour
+	DefaultCertValidity = 365 * 24 * time.Hour
+)
+
+// organization is set on every certificate, to tell them from others
+const organization = "deployer development CA"
+
+// CA signs certificates from a directory holding its certificate and key,
+// certificates it issues are written next to them
+type CA struct {
+	Dir  string
+	Cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// Request describes a certificate to issue
+type Request struct {
+	// Name is the common name, files are named after it
+	Name string
+	// Hosts are the DNS names and IP addresses the certificate is valid for
+	Hosts []string
+	// Validity is how long the certificate lasts, DefaultCertValidity if zero.
+	// It never outlasts the CA.
+	Validity time.Duration
+}
+
+// Issued is a certificate written by a CA
+type Issued struct {
+	CertFile string
+	KeyFile  string
+	Cert     *x509.Certificate
+}
+
+// Init creates a CA in dir, an existing CA is only replaced with force since
+// certificates it issued are no longer trusted afterwards
+func Init(dir string, validity time.Duration, force bool) (*CA, error) {
+	if !force {
+		if _, err := os.Stat(filepath.Join(dir, CACertFile)); err == nil {
+			return nil, fmt.Errorf("a CA already exists in %s", dir)
+		}
+	}
+	if validity <= 0 {
+		validity = DefaultCAValidity
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: organization, Organization: []string{organization}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFiles(filepath.Join(dir, CACertFile), filepath.Join(dir, CAKeyFile), der, key); err != nil {
+		return nil, err
+	}
+	return &CA{Dir: dir, Cert: cert, key: key}, nil
+}
+
+// Load reads the CA of dir
+func Load(dir string) (*CA, error) {
+	cert, err := ReadCert(filepath.Join(dir, CACertFile))
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(dir, CAKeyFile)
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key %s:%v", file, err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("no key found in %s", file)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key %s:%v", file, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("CA key %s cannot sign", file)
+	}
+	return &CA{Dir: dir, Cert: cert, key: signer}, nil
+}
+
+// Issue signs a certificate for r and writes it as <name>.crt and <name>.key
+// in the directory of the CA, replacing the previous ones. Certificates are
+// good for both ends of a connection: servers dial workers with the
+// certificate they serve and workers report to servers with theirs.
+func (ca *CA) Issue(r Request) (*Issued, error) {
+	if !validName(r.Name) {
+		return nil, fmt.Errorf("invalid certificate name %q", r.Name)
+	}
+	validity := r.Validity
+	if validity <= 0 {
+		validity = DefaultCertValidity
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: r.Name, Organization: []string{organization}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if template.NotAfter.After(ca.Cert.NotAfter) {
+		template.NotAfter = ca.Cert.NotAfter
+	}
+	for _, host := range r.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	issued := &Issued{
+		CertFile: filepath.Join(ca.Dir, r.Name+".crt"),
+		KeyFile:  filepath.Join(ca.Dir, r.Name+".key"),
+		Cert:     cert,
+	}
+	if err := writeFiles(issued.CertFile, issued.KeyFile, der, key); err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// Renew issues again the certificates of the CA expiring before deadline,
+// with the same names and hosts and a new key. Certificates the CA did not
+// sign are left alone.
+func (ca *CA) Renew(deadline time.Time, validity time.Duration) ([]*Issued, error) {
+	files, err := filepath.Glob(filepath.Join(ca.Dir, "*.crt"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var renewed []*Issued
+	for _, file := range files {
+		if filepath.Base(file) == CACertFile {
+			continue
+		}
+		cert, err := ReadCert(file)
+		if err != nil {
+			return renewed, err
+		}
+		if cert.CheckSignatureFrom(ca.Cert) != nil || cert.NotAfter.After(deadline) {
+			continue
+		}
+		issued, err := ca.Issue(Request{
+			Name:     strings.TrimSuffix(filepath.Base(file), ".crt"),
+			Hosts:    Hosts(cert),
+			Validity: validity,
+		})
+		if err != nil {
+			return renewed, err
+		}
+		renewed = append(renewed, issued)
+	}
+	return renewed, nil
+}
+
+// Hosts lists the DNS names and IP addresses of a certificate
+func Hosts(cert *x509.Certificate) []string {
+	hosts := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
+
+// ReadCert reads the first certificate of a PEM file
+func ReadCert(file string) (*x509.Certificate, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate %s:%v", file, err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s:%v", file, err)
+	}
+	return cert, nil
+}
+
+// validName keeps names usable as file names
+func validName(name string) bool {
+	if name == "" || name == "ca" || strings.HasPrefix(name, ".") {
+		return false
+	}
+	return !strings.ContainsAny(name, `/\`)
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// writeFiles writes a certificate and its key as PEM, the key readable by
+// its owner only
+func writeFiles(certFile, keyFile string, der []byte, key crypto.Signer) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
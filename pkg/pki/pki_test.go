@@ -0,0 +1,60 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := Init(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Init(dir, 0, false); err == nil {
+		t.Error("expected an existing CA not to be replaced")
+	}
+	issued, err := ca.Issue(Request{Name: "worker-a", Hosts: []string{"worker-a", "10.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.LoadX509KeyPair(issued.CertFile, issued.KeyFile); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(loaded.Cert)
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		for _, host := range []string{"worker-a", "10.0.0.1"} {
+			_, err := issued.Cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: host, KeyUsages: []x509.ExtKeyUsage{usage}})
+			if err != nil {
+				t.Errorf("expected certificate valid for %s with usage %v, got %v", host, usage, err)
+			}
+		}
+	}
+	if _, err := ca.Issue(Request{Name: "../ca"}); err == nil {
+		t.Error("expected a name out of the CA directory to fail")
+	}
+
+	if _, err := loaded.Issue(Request{Name: "server", Hosts: []string{"localhost"}, Validity: 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := loaded.Renew(time.Now().Add(48*time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renewed) != 1 || renewed[0].Cert.Subject.CommonName != "server" {
+		t.Fatalf("expected server to be renewed, got %v", renewed)
+	}
+	if hosts := Hosts(renewed[0].Cert); len(hosts) != 1 || hosts[0] != "localhost" {
+		t.Errorf("expected hosts to be kept, got %v", hosts)
+	}
+	if renewed[0].Cert.NotAfter.Before(time.Now().Add(48 * time.Hour)) {
+		t.Errorf("expected renewal to extend validity, got %v", renewed[0].Cert.NotAfter)
+	}
+}
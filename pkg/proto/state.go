@@ -0,0 +1,18 @@
+package proto
+
+import "fmt"
+
+// MarshalText encodes the state by name, so REST payloads stay readable
+func (x ResourceState) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText decodes a state from its name
+func (x *ResourceState) UnmarshalText(text []byte) error {
+	v, ok := ResourceState_value[string(text)]
+	if !ok {
+		return fmt.Errorf("unknown resource state %q", text)
+	}
+	*x = ResourceState(v)
+	return nil
+}
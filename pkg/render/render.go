@@ -2,6 +2,7 @@ package render
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -12,6 +13,8 @@ import (
 	"text/template"
 
 	"sigs.k8s.io/yaml" // Avoid map[interface{}]interface{} to break json
+
+	"github.com/beacon/deployer/pkg/secrets"
 )
 
 // ConfigMap is typically a map of config
@@ -19,6 +22,28 @@ type ConfigMap map[string]interface{}
 
 // Execute render given files using specified data
 func Execute(config ConfigMap, file, outputDir string, inputs ...string) error {
+	return ExecuteWithSecrets(config, nil, file, outputDir, inputs...)
+}
+
+// ExecuteWithSecrets renders like Execute, templates read secrets with
+// {{ secret "name" }}. Secret values are masked in log lines and errors.
+func ExecuteWithSecrets(config ConfigMap, values map[string]string, file, outputDir string, inputs ...string) error {
+	masker := secrets.NewMasker(secretValues(values)...)
+	if err := execute(config, values, masker, file, outputDir, inputs...); err != nil {
+		return errors.New(masker.Mask(err.Error()))
+	}
+	return nil
+}
+
+func secretValues(values map[string]string) []string {
+	list := make([]string, 0, len(values))
+	for _, v := range values {
+		list = append(list, v)
+	}
+	return list
+}
+
+func execute(config ConfigMap, values map[string]string, masker *secrets.Masker, file, outputDir string, inputs ...string) error {
 	rawConfig, err := ioutil.ReadFile(file)
 	if err != nil {
 		return fmt.Errorf("Failed to parse config from file %s:%v", file, err)
@@ -45,7 +70,7 @@ func Execute(config ConfigMap, file, outputDir string, inputs ...string) error {
 					return nil
 				}
 				dstPath := path.Join(outputDir, input, strings.TrimPrefix(filePath, input))
-				if err := renderFile(filePath, dstPath, config); err != nil {
+				if err := renderFile(filePath, dstPath, config, values, masker); err != nil {
 					return fmt.Errorf("Failed to render file %s -> %s: %v", filePath, dstPath, err)
 				}
 				return nil
@@ -55,7 +80,7 @@ func Execute(config ConfigMap, file, outputDir string, inputs ...string) error {
 			}
 		} else {
 			dstPath := path.Join(outputDir, input)
-			if err := renderFile(input, dstPath, config); err != nil {
+			if err := renderFile(input, dstPath, config, values, masker); err != nil {
 				return fmt.Errorf("Failed to render file %s -> %s: %v", input, dstPath, err)
 			}
 		}
@@ -63,7 +88,7 @@ func Execute(config ConfigMap, file, outputDir string, inputs ...string) error {
 	return nil
 }
 
-func renderFile(srcFile, dstFile string, config ConfigMap) error {
+func renderFile(srcFile, dstFile string, config ConfigMap, values map[string]string, masker *secrets.Masker) error {
 	dstDir := path.Dir(dstFile)
 	if err := os.MkdirAll(dstDir, 0777); err != nil {
 		return fmt.Errorf("Failed to create dir %s:%v", dstDir, err)
@@ -72,7 +97,15 @@ func renderFile(srcFile, dstFile string, config ConfigMap) error {
 	if err != nil {
 		return fmt.Errorf("failed to load config %s:%v", srcFile, err)
 	}
-	tmpl, err := template.New(srcFile).Funcs(funcMap()).Parse(string(content))
+	funcs := funcMap()
+	funcs["secret"] = func(name string) (string, error) {
+		value, ok := values[name]
+		if !ok {
+			return "", fmt.Errorf("secret %s is not set", name)
+		}
+		return value, nil
+	}
+	tmpl, err := template.New(srcFile).Funcs(funcs).Parse(string(content))
 	if err != nil {
 		return fmt.Errorf("Failed to parse file %s as template:%v", srcFile, err)
 	}
@@ -83,6 +116,6 @@ func renderFile(srcFile, dstFile string, config ConfigMap) error {
 	if err := ioutil.WriteFile(dstFile, buf.Bytes(), 0644); err != nil {
 		return fmt.Errorf("Failed to write file %s:%v", dstFile, err)
 	}
-	log.Println("Parsed file", srcFile, "->", dstFile)
+	log.Println("Parsed file", masker.Mask(srcFile), "->", masker.Mask(dstFile))
 	return nil
 }
@@ -0,0 +1,37 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecuteWithSecrets(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile("values.yaml", []byte("user: app\n"), 0644)
+	ioutil.WriteFile("db.conf", []byte(`{{ .user }}:{{ secret "password" }}`), 0644)
+	ioutil.WriteFile("missing.conf", []byte(`{{ secret "token" }}`), 0644)
+	ioutil.WriteFile("leak.conf", []byte(`{{ fail (secret "password") }}`), 0644)
+
+	secrets := map[string]string{"password": "hunter2"}
+	if err := ExecuteWithSecrets(nil, secrets, "values.yaml", "out", "db.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := ioutil.ReadFile(filepath.Join("out", "db.conf")); string(raw) != "app:hunter2" {
+		t.Errorf("unexpected output %q", raw)
+	}
+	if err := ExecuteWithSecrets(nil, secrets, "values.yaml", "out", "missing.conf"); err == nil || !strings.Contains(err.Error(), "secret token is not set") {
+		t.Errorf("expected missing secrets to fail, got %v", err)
+	}
+	err := ExecuteWithSecrets(nil, secrets, "values.yaml", "out", "leak.conf")
+	if err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("expected the error to mask the secret, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+// Package schema derives JSON Schema documents from Go types, following the
+// same json tags encoding/json does
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema object
+type Schema map[string]interface{}
+
+// Generator builds schemas, named struct types are collected as definitions
+// and referred to by RefPrefix + name
+type Generator struct {
+	// RefPrefix is "#/components/schemas/" for OpenAPI, "#/$defs/" for JSON Schema
+	RefPrefix string
+	// Definitions collects the schema of every named struct type seen
+	Definitions map[string]Schema
+	// Descriptions are attached to properties, keyed by "Type.field"
+	Descriptions map[string]string
+	// Enums lists the values of string types
+	Enums map[reflect.Type][]string
+}
+
+// New creates a generator referring to definitions with refPrefix
+func New(refPrefix string) *Generator {
+	return &Generator{
+		RefPrefix:    refPrefix,
+		Definitions:  make(map[string]Schema),
+		Descriptions: make(map[string]string),
+		Enums:        make(map[reflect.Type][]string),
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// For returns the schema of values of type t
+func (g *Generator) For(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if values, ok := g.Enums[t]; ok {
+		return Schema{"type": "string", "enum": values}
+	}
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t.Implements(textMarshalerType), reflect.PtrTo(t).Implements(textMarshalerType),
+		t.Implements(jsonMarshalerType), reflect.PtrTo(t).Implements(jsonMarshalerType):
+		// Custom encodings are strings in every type of this repo
+		return Schema{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "format": "byte"}
+		}
+		return Schema{"type": "array", "items": g.For(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.For(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := t.Name()
+		if _, ok := g.Definitions[name]; !ok {
+			// Register first so that recursive types terminate
+			g.Definitions[name] = Schema{}
+			g.Definitions[name] = g.object(t)
+		}
+		return Schema{"$ref": g.RefPrefix + name}
+	}
+	return Schema{}
+}
+
+func (g *Generator) object(t reflect.Type) Schema {
+	properties := Schema{}
+	var required []string
+	g.fields(t, properties, &required)
+	s := Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *Generator) fields(t reflect.Type, properties Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := parseTag(tag)
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, properties, required)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := g.For(f.Type)
+		if desc, ok := g.Descriptions[t.Name()+"."+name]; ok {
+			if _, isRef := s["$ref"]; isRef {
+				s = Schema{"allOf": []Schema{s}, "description": desc}
+			} else {
+				s["description"] = desc
+			}
+		}
+		if values := oneOf(f); values != nil && s["type"] == "string" {
+			s["enum"] = values
+		}
+		properties[name] = s
+		if isRequired(f) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func parseTag(tag string) string {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// isRequired follows the binding tags of gin and validate tags of validator
+func isRequired(f reflect.StructField) bool {
+	for _, key := range []string{"binding", "validate"} {
+		for _, rule := range strings.Split(f.Tag.Get(key), ",") {
+			if rule == "required" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// oneOf returns the values a oneof binding or validate tag allows
+func oneOf(f reflect.StructField) []string {
+	for _, key := range []string{"binding", "validate"} {
+		for _, rule := range strings.Split(f.Tag.Get(key), ",") {
+			if strings.HasPrefix(rule, "oneof=") {
+				return strings.Fields(strings.TrimPrefix(rule, "oneof="))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Value float64 `json:"value"`
+}
+
+type outer struct {
+	Name    string            `json:"name" validate:"required"`
+	Count   int               `json:"count,omitempty"`
+	Mode    string            `json:"mode,omitempty" validate:"omitempty,oneof=fast slow"`
+	Tags    []string          `json:"tags,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	At      time.Time         `json:"at"`
+	Inner   *inner            `json:"inner,omitempty"`
+	Ignored string            `json:"-"`
+	hidden  string
+}
+
+func TestFor(t *testing.T) {
+	g := New("#/$defs/")
+	g.Descriptions["outer.name"] = "Name of the thing"
+	s := g.For(reflect.TypeOf(&outer{}))
+	if s["$ref"] != "#/$defs/outer" {
+		t.Fatalf("expected reference to outer, got %v", s)
+	}
+	def := g.Definitions["outer"]
+	props := def["properties"].(Schema)
+	if len(props) != 7 {
+		t.Errorf("expected 7 properties, got %v", props)
+	}
+	if !reflect.DeepEqual(def["required"], []string{"name"}) {
+		t.Errorf("expected name to be required, got %v", def["required"])
+	}
+	if props["name"].(Schema)["description"] != "Name of the thing" {
+		t.Errorf("expected description, got %v", props["name"])
+	}
+	if !reflect.DeepEqual(props["mode"].(Schema)["enum"], []string{"fast", "slow"}) {
+		t.Errorf("expected mode to be an enum, got %v", props["mode"])
+	}
+	if props["at"].(Schema)["format"] != "date-time" {
+		t.Errorf("expected time as date-time, got %v", props["at"])
+	}
+	if props["inner"].(Schema)["$ref"] != "#/$defs/inner" {
+		t.Errorf("expected reference to inner, got %v", props["inner"])
+	}
+	if props["labels"].(Schema)["additionalProperties"].(Schema)["type"] != "string" {
+		t.Errorf("expected map of strings, got %v", props["labels"])
+	}
+}
@@ -0,0 +1,137 @@
+// Package secrets encrypts secret values at rest and masks them in text
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// KeySize is the size of keys in bytes, selecting AES-256
+const KeySize = 32
+
+// GenerateKey returns a new random key encoded the way LoadKey reads it
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadKey reads a base64 encoded key from file
+func LoadKey(file string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets key %s:%v", file, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("secrets key %s must hold %d base64 encoded bytes", file, KeySize)
+	}
+	return key, nil
+}
+
+// Box seals values with AES-GCM
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox returns a box sealing with key
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts value, scope is authenticated along so that a sealed value
+// only opens under the scope it was sealed for
+func (b *Box) Seal(value, scope string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(value), []byte(scope))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed for scope
+func (b *Box) Open(sealed, scope string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	n := b.aead.NonceSize()
+	if len(raw) < n {
+		return "", fmt.Errorf("sealed value is too short")
+	}
+	value, err := b.aead.Open(nil, raw[:n], raw[n:], []byte(scope))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret, the key may have changed:%v", err)
+	}
+	return string(value), nil
+}
+
+// Mask replaces secret values in text
+const Mask = "******"
+
+// minLineMask is the shortest line of a multi-line secret masked on its own
+const minLineMask = 4
+
+// Masker hides secret values in text
+type Masker struct {
+	replacer *strings.Replacer
+}
+
+// NewMasker masks every one of values. The lines of multi-line values are
+// masked on their own too since logs are written line by line.
+func NewMasker(values ...string) *Masker {
+	var hidden []string
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		hidden = append(hidden, v)
+		if strings.Contains(v, "\n") {
+			for _, line := range strings.Split(v, "\n") {
+				if line = strings.TrimSpace(line); len(line) >= minLineMask {
+					hidden = append(hidden, line)
+				}
+			}
+		}
+	}
+	if len(hidden) == 0 {
+		return &Masker{}
+	}
+	// The replacer tries old strings in order, longer ones go first so that
+	// a secret containing another is masked whole
+	sort.Slice(hidden, func(i, j int) bool { return len(hidden[i]) > len(hidden[j]) })
+	pairs := make([]string, 0, 2*len(hidden))
+	for _, v := range hidden {
+		pairs = append(pairs, v, Mask)
+	}
+	return &Masker{replacer: strings.NewReplacer(pairs...)}
+}
+
+// Mask returns s with secret values replaced, a nil Masker masks nothing
+func (m *Masker) Mask(s string) string {
+	if m == nil || m.replacer == nil {
+		return s
+	}
+	return m.replacer.Replace(s)
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestBox(t *testing.T) {
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "key")
+	if err := ioutil.WriteFile(file, []byte(encoded+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadKey(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := NewBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal("hunter2", "web/prod/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := box.Open(sealed, "web/prod/db"); err != nil || value != "hunter2" {
+		t.Fatalf("expected hunter2, got %q %v", value, err)
+	}
+	if _, err := box.Open(sealed, "web/dev/db"); err == nil {
+		t.Error("expected a value sealed for another scope not to open")
+	}
+
+	other, _ := NewBox(make([]byte, KeySize))
+	if _, err := other.Open(sealed, "web/prod/db"); err == nil {
+		t.Error("expected a value sealed with another key not to open")
+	}
+	if _, err := NewBox([]byte(base64.StdEncoding.EncodeToString(key))); err == nil {
+		t.Error("expected a key of the wrong size to be rejected")
+	}
+}
+
+func TestMasker(t *testing.T) {
+	m := NewMasker("pass", "password1", "", "-----BEGIN KEY-----\nabcdef\n-----END KEY-----")
+	tests := map[string]string{
+		"login with password1":  "login with " + Mask,
+		"pass and pass":         Mask + " and " + Mask,
+		"key line abcdef":       "key line " + Mask,
+		"nothing secret here":   "nothing secret here",
+		"-----END KEY----- end": Mask + " end",
+	}
+	for in, expected := range tests {
+		if out := m.Mask(in); out != expected {
+			t.Errorf("masking %q: expected %q, got %q", in, expected, out)
+		}
+	}
+	var none *Masker
+	if none.Mask("pass") != "pass" {
+		t.Error("expected a nil masker to mask nothing")
+	}
+}
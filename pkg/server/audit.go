@@ -0,0 +1,101 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindAudit = "audit"
+
+// Actions recorded in the audit log
+const (
+	auditLock           = "lock"
+	auditUnlock         = "unlock"
+	auditOverrideLock   = "override-lock"
+	auditFreeze         = "freeze"
+	auditUnfreeze       = "unfreeze"
+	auditOverrideFreeze = "override-freeze"
+)
+
+// defaultAuditLimit is how many entries are listed unless asked otherwise,
+// maxAuditLimit the most listed at once
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// audit records an entry in the audit log, failing to record it does not
+// fail what is audited
+func (s *Server) audit(actor, action, subject, detail string) {
+	e := &api.AuditEntry{Time: time.Now().UTC(), Actor: actor, Action: action, Subject: subject, Detail: detail}
+	log.Println("Audit:", action, subject, "by", actor, ":", detail)
+	// Keys sort by time, the ID tells entries of the same instant apart
+	key := e.Time.Format("20060102T150405.000000000") + "-" + newID()
+	if err := s.store.Put(kindAudit, key, e); err != nil {
+		log.Println("Failed to record audit entry", action, subject, ":", err)
+	}
+}
+
+// listAudit returns the last limit entries recorded since then, oldest first
+func (s *Server) listAudit(since time.Time, limit int) ([]*api.AuditEntry, error) {
+	keys, err := s.store.List(kindAudit)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*api.AuditEntry{}
+	for i := len(keys) - 1; i >= 0 && len(entries) < limit; i-- {
+		e := &api.AuditEntry{}
+		if err := s.store.Get(kindAudit, keys[i], e); err == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if e.Time.Before(since) {
+			break
+		}
+		entries = append(entries, e)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// listAuditHandler lists the audit log, since=<RFC3339 time> and limit=<n>
+// narrow it down. Limits above maxAuditLimit are lowered to it.
+func (s *Server) listAuditHandler(c *gin.Context) {
+	var since time.Time
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since, expected an RFC 3339 time"})
+			return
+		}
+		since = t
+	}
+	limit := defaultAuditLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = n
+		if limit > maxAuditLimit {
+			limit = maxAuditLimit
+		}
+	}
+	entries, err := s.listAudit(since, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/beacon/deployer/pkg/config"
+)
+
+// identityKey holds the name of the authenticated caller in gin contexts
+const identityKey = "identity"
+
+type identityCtxKey struct{}
+
+// authenticate returns who presented authorization, it is always
+// "anonymous" when auth is not configured
+func authenticate(auth *config.AuthConfig, authorization string) (string, bool) {
+	if auth == nil {
+		return "anonymous", true
+	}
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if token == "" || token == authorization {
+		return "", false
+	}
+	for _, t := range auth.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return t.Name, true
+		}
+	}
+	return "", false
+}
+
+// public reports routes anyone may read, so that the dashboard can load
+func public(method, path string) bool {
+	return method == http.MethodGet && (path == "/" || path == "/openapi.json" || strings.HasPrefix(path, "/ui/"))
+}
+
+func (s *Server) restfulAuth(c *gin.Context) {
+	if public(c.Request.Method, c.FullPath()) {
+		c.Next()
+		return
+	}
+	authorization := c.GetHeader("Authorization")
+	if token := c.Query("access_token"); authorization == "" && token != "" {
+		// EventSource in browsers cannot set headers
+		authorization = "Bearer " + token
+	}
+	name, ok := authenticate(s.config().Auth, authorization)
+	if !ok {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	c.Set(identityKey, name)
+	c.Next()
+}
+
+func (s *Server) rpcAuthenticate(ctx context.Context) (context.Context, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+	name, ok := authenticate(s.config().Auth, authorization)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return context.WithValue(ctx, identityCtxKey{}, name), nil
+}
+
+func (s *Server) authUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.rpcAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authedStream carries the authenticated context into stream handlers
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *Server) authStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.rpcAuthenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+}
+
+// caller returns who sent a REST request
+func caller(c *gin.Context) string {
+	return c.GetString(identityKey)
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/blob"
+	"github.com/beacon/deployer/pkg/config"
+)
+
+const (
+	defaultRetain      = 10
+	defaultGCInterval  = time.Hour
+	defaultGracePeriod = time.Hour
+)
+
+func (s *Server) blobsConfig() config.BlobsConfig {
+	var bc config.BlobsConfig
+	if cfg := s.config(); cfg.Blobs != nil {
+		bc = *cfg.Blobs
+	}
+	if bc.Retain == 0 {
+		bc.Retain = defaultRetain
+	}
+	if bc.GCInterval == 0 {
+		bc.GCInterval = config.Duration(defaultGCInterval)
+	}
+	if bc.GracePeriod == 0 {
+		bc.GracePeriod = config.Duration(defaultGracePeriod)
+	}
+	return bc
+}
+
+// checkFiles makes sure the files of a deployment are stored blobs under
+// relative paths workers may write to. Blobs are touched so that garbage
+// collection keeps them until the deployment referencing them is saved.
+func (s *Server) checkFiles(files map[string]string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if s.blobs == nil {
+		return fmt.Errorf("files need the blob store, which is not configured on the server")
+	}
+	for p, digest := range files {
+		if p == manifestPath || p == secretsPath {
+			return fmt.Errorf("file path %s is reserved", p)
+		}
+		if clean := path.Clean(p); clean != p || path.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("file path %q must be relative and clean", p)
+		}
+		s.blobMu.Lock()
+		_, err := s.blobs.Touch(digest)
+		s.blobMu.Unlock()
+		if err == blob.ErrNotFound {
+			return fmt.Errorf("file %s refers to %s which was not uploaded", p, digest)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blobRefs maps digests to the retained deployments referencing them. The
+// latest deployments of every target and environment are retained, along
+// with every deployment which has not ended.
+func (s *Server) blobRefs() (map[string][]string, error) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		return nil, err
+	}
+	retain := s.blobsConfig().Retain
+	kept := make(map[string]int)
+	refs := make(map[string][]string)
+	for _, d := range deployments {
+		key := d.Target + "/" + d.Env
+		if kept[key] >= retain && d.State.Terminal() {
+			continue
+		}
+		kept[key]++
+		for _, digest := range d.Files {
+			refs[digest] = append(refs[digest], d.ID)
+		}
+	}
+	return refs, nil
+}
+
+// collectBlobs removes blobs no retained deployment references, once they
+// are older than the grace period
+func (s *Server) collectBlobs(now time.Time) (*api.GCResult, error) {
+	result := &api.GCResult{Removed: []string{}}
+	refs, err := s.blobRefs()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := s.blobs.List()
+	if err != nil {
+		return nil, err
+	}
+	grace := time.Duration(s.blobsConfig().GracePeriod)
+	for _, info := range infos {
+		if len(refs[info.Digest]) > 0 || now.Sub(info.ModTime) < grace {
+			continue
+		}
+		removed, err := s.removeBlob(info.Digest, now, grace)
+		if err != nil {
+			return result, err
+		}
+		if !removed {
+			continue
+		}
+		result.Removed = append(result.Removed, info.Digest)
+		result.Freed += info.Size
+	}
+	if len(result.Removed) > 0 {
+		log.Println("Removed", len(result.Removed), "unused blobs, freed", result.Freed, "bytes")
+	}
+	return result, nil
+}
+
+// removeBlob deletes a blob unless it was touched within the grace period
+// since it was listed, by a deployment referencing it or an upload
+func (s *Server) removeBlob(digest string, now time.Time, grace time.Duration) (bool, error) {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+	info, err := s.blobs.Stat(digest)
+	if err == blob.ErrNotFound {
+		return false, nil
+	}
+	if err != nil || now.Sub(info.ModTime) < grace {
+		return false, err
+	}
+	return true, s.blobs.Delete(digest)
+}
+
+// maybeCollectBlobs runs garbage collection from the scheduler once every
+// interval
+func (s *Server) maybeCollectBlobs(now time.Time) {
+	if s.blobs == nil || now.Sub(s.lastGC) < time.Duration(s.blobsConfig().GCInterval) {
+		return
+	}
+	s.lastGC = now
+	if _, err := s.collectBlobs(now); err != nil {
+		log.Println("Failed to collect blobs:", err)
+	}
+}
+
+func (s *Server) blobsEnabled(c *gin.Context) bool {
+	if s.blobs == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the blob store is not configured on the server"})
+		return false
+	}
+	return true
+}
+
+func (s *Server) listBlobsHandler(c *gin.Context) {
+	if !s.blobsEnabled(c) {
+		return
+	}
+	refs, err := s.blobRefs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	infos, err := s.blobs.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	blobs := make([]api.Blob, 0, len(infos))
+	for _, info := range infos {
+		blobs = append(blobs, blobOf(info, refs[info.Digest]))
+	}
+	c.JSON(http.StatusOK, blobs)
+}
+
+func blobOf(info blob.Info, refs []string) api.Blob {
+	if refs == nil {
+		refs = []string{}
+	}
+	return api.Blob{Digest: info.Digest, Size: info.Size, UpdatedAt: info.ModTime, Refs: refs}
+}
+
+// getBlobHandler serves the content of a blob, with range requests and HEAD
+func (s *Server) getBlobHandler(c *gin.Context) {
+	if !s.blobsEnabled(c) {
+		return
+	}
+	digest := c.Param("digest")
+	f, info, err := s.blobs.Open(digest)
+	if err == blob.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "blob not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	// Content never changes, the digest is a strong validator
+	c.Header("ETag", `"`+digest+`"`)
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime, f)
+}
+
+// putBlobHandler stores a blob under the digest given, content with
+// another digest is refused
+func (s *Server) putBlobHandler(c *gin.Context) {
+	if !s.blobsEnabled(c) {
+		return
+	}
+	digest := c.Param("digest")
+	if !blob.ValidDigest(digest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid digest %q", digest)})
+		return
+	}
+	_, err := s.blobs.Stat(digest)
+	existed := err == nil
+	s.storeBlob(c, digest, existed)
+}
+
+// postBlobHandler stores a blob under the digest of its content
+func (s *Server) postBlobHandler(c *gin.Context) {
+	if !s.blobsEnabled(c) {
+		return
+	}
+	s.storeBlob(c, "", false)
+}
+
+func (s *Server) storeBlob(c *gin.Context, digest string, existed bool) {
+	info, err := s.blobs.Put(c.Request.Body, digest)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, blob.ErrMismatch):
+			status = http.StatusBadRequest
+		case strings.Contains(err.Error(), "request body too large"):
+			// Set by the MaxBytesReader of the limits middleware
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	refs, err := s.blobRefs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusCreated
+	if existed {
+		status = http.StatusOK
+	}
+	log.Println("Blob", info.Digest, "of", info.Size, "bytes uploaded by", caller(c))
+	c.JSON(status, blobOf(info, refs[info.Digest]))
+}
+
+func (s *Server) gcBlobsHandler(c *gin.Context) {
+	if !s.blobsEnabled(c) {
+		return
+	}
+	result, err := s.collectBlobs(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Println("Blobs collected by", caller(c))
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/blob"
+)
+
+func newBlobsServer(t *testing.T, workers *fakeWorkers) *Server {
+	s := newRolloutServer(t, workers)
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	st, err := blob.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithBlobs(st)(s)
+	return s
+}
+
+func TestBlobs(t *testing.T) {
+	s := newBlobsServer(t, &fakeWorkers{})
+	content := "kind: Deployment\n"
+	digest := blob.Digest([]byte(content))
+
+	var b api.Blob
+	if code := call(t, s, "PUT", "/blobs/"+digest, content, &b); code != http.StatusCreated || b.Digest != digest {
+		t.Fatalf("expected the blob to be created, got %d %v", code, b)
+	}
+	if code := call(t, s, "POST", "/blobs", content, &b); code != http.StatusCreated || b.Digest != digest {
+		t.Errorf("expected the blob to be stored under its digest, got %d %v", code, b)
+	}
+	if code := call(t, s, "PUT", "/blobs/"+digest, content, nil); code != http.StatusOK {
+		t.Errorf("expected 200 uploading again, got %d", code)
+	}
+	if code := call(t, s, "PUT", "/blobs/"+digest, "tampered", nil); code != http.StatusBadRequest {
+		t.Errorf("expected a digest mismatch to be refused, got %d", code)
+	}
+
+	req := httptest.NewRequest("GET", "/blobs/"+digest, nil)
+	req.Header.Set("Range", "bytes=6-")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != content[6:] {
+		t.Errorf("expected the range to be served, got %d %q", w.Code, w.Body)
+	}
+	if code := call(t, s, "HEAD", "/blobs/"+blob.Digest([]byte("missing")), "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+
+	// Deployments may only reference stored blobs
+	body := `{"action":"deploy","target":"web","workers":["w1"],"files":{"app.yaml":"` + digest + `"}}`
+	var d api.Deployment
+	if code := call(t, s, "POST", "/actions", body, &d); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	for _, files := range []string{
+		`{"app.yaml":"` + blob.Digest([]byte("missing")) + `"}`,
+		`{"../app.yaml":"` + digest + `"}`,
+		`{"` + manifestPath + `":"` + digest + `"}`,
+	} {
+		body := `{"action":"deploy","target":"web","workers":["w1"],"files":` + files + `}`
+		if code := call(t, s, "POST", "/actions", body, nil); code != http.StatusBadRequest {
+			t.Errorf("expected files %s to be refused, got %d", files, code)
+		}
+	}
+
+	var blobs []api.Blob
+	call(t, s, "GET", "/blobs", "", &blobs)
+	if len(blobs) != 1 || len(blobs[0].Refs) != 1 || blobs[0].Refs[0] != d.ID {
+		t.Errorf("expected the blob to be referenced by %s, got %v", d.ID, blobs)
+	}
+}
+
+func TestBlobsGC(t *testing.T) {
+	s := newBlobsServer(t, &fakeWorkers{})
+	put := func(content string) string {
+		var b api.Blob
+		if code := call(t, s, "POST", "/blobs", content, &b); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", code)
+		}
+		return b.Digest
+	}
+	used, unused := put("used"), put("unused")
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"files":{"a":"`+used+`"}}`, &d)
+
+	// Blobs uploaded recently may be about to be referenced
+	var result api.GCResult
+	if code := call(t, s, "POST", "/blobs/gc", "", &result); code != http.StatusOK || len(result.Removed) != 0 {
+		t.Errorf("expected the grace period to keep every blob, got %d %v", code, result)
+	}
+
+	s.maybeCollectBlobs(time.Now().Add(2 * defaultGracePeriod))
+	for digest, kept := range map[string]bool{used: true, unused: false} {
+		if _, err := s.blobs.Stat(digest); (err == nil) != kept {
+			t.Errorf("expected %s kept %v, got %v", digest, kept, err)
+		}
+	}
+	if s.lastGC.IsZero() {
+		t.Error("expected the collection to be recorded")
+	}
+
+	if code := call(t, newRolloutServer(t, &fakeWorkers{}), "GET", "/blobs", "", nil); code != http.StatusNotImplemented {
+		t.Errorf("expected blobs to be disabled without a store, got %d", code)
+	}
+}
+
+func TestBlobsGCKeepsChecked(t *testing.T) {
+	s := newRolloutServer(t, &fakeWorkers{})
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := blob.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithBlobs(st)(s)
+	info, err := st.Put(strings.NewReader("late"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * defaultGracePeriod)
+	files, _ := filepath.Glob(filepath.Join(dir, "sha256", "*", "*"))
+	for _, f := range files {
+		os.Chtimes(f, old, old)
+	}
+
+	// A deployment about to reference the blob keeps it from collection
+	// until it is saved
+	if err := s.checkFiles(map[string]string{"a": info.Digest}); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := s.collectBlobs(time.Now()); err != nil || len(result.Removed) != 0 {
+		t.Errorf("expected the checked blob to be kept, got %v %v", result, err)
+	}
+
+}
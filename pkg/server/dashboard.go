@@ -0,0 +1,25 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardFiles is a single page UI built on top of the REST API
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+func (s *Server) routeDashboard() {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	s.restful.StaticFS("/ui", http.FS(files))
+	s.restful.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/ui/")
+	})
+}
@@ -0,0 +1,356 @@
+// Dashboard for the deployer, everything goes through the REST API.
+(function () {
+  'use strict';
+
+  var refreshInterval = 3000;
+  var logSource = null;
+  var tokenKey = 'deployer.token';
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function text(value) {
+    return document.createTextNode(value === undefined || value === null ? '' : String(value));
+  }
+
+  function cell(row, content) {
+    var td = document.createElement('td');
+    td.appendChild(typeof content === 'object' ? content : text(content));
+    row.appendChild(td);
+    return td;
+  }
+
+  function badge(state) {
+    var span = document.createElement('span');
+    span.className = 'state ' + state;
+    span.appendChild(text(state));
+    return span;
+  }
+
+  function button(label, onClick) {
+    var b = document.createElement('button');
+    b.appendChild(text(label));
+    b.addEventListener('click', function (e) {
+      e.stopPropagation();
+      onClick();
+    });
+    return b;
+  }
+
+  function time(value) {
+    return value ? new Date(value).toLocaleString() : '';
+  }
+
+  function showError(message) {
+    var el = $('error');
+    el.textContent = message;
+    el.hidden = false;
+    setTimeout(function () { el.hidden = true; }, 5000);
+  }
+
+  function token() {
+    return window.localStorage.getItem(tokenKey) || '';
+  }
+
+  function request(method, path, body) {
+    var opts = { method: method, headers: {} };
+    if (token()) {
+      opts.headers.Authorization = 'Bearer ' + token();
+    }
+    if (body !== undefined) {
+      opts.headers['Content-Type'] = 'application/json';
+      opts.body = JSON.stringify(body);
+    }
+    return fetch(path, opts).then(function (resp) {
+      if (resp.status === 401) {
+        var entered = window.prompt('Access token');
+        if (entered) {
+          window.localStorage.setItem(tokenKey, entered);
+          return request(method, path, body);
+        }
+      }
+      return resp.text().then(function (raw) {
+        var data = raw ? JSON.parse(raw) : null;
+        if (!resp.ok) {
+          throw new Error((data && data.error) || resp.statusText);
+        }
+        return data;
+      });
+    });
+  }
+
+  function reviewer() {
+    return window.prompt('Your name');
+  }
+
+  function renderDeployments(deployments) {
+    var rows = $('deployment-rows');
+    var approvals = $('approval-rows');
+    rows.innerHTML = '';
+    approvals.innerHTML = '';
+    var pending = 0;
+    deployments.forEach(function (d) {
+      var tr = document.createElement('tr');
+      tr.className = 'clickable';
+      tr.addEventListener('click', function () { showDeployment(d.id); });
+      cell(tr, d.id);
+      cell(tr, d.target);
+      cell(tr, d.env);
+      cell(tr, badge(d.state));
+      cell(tr, (d.workers || []).join(', '));
+      cell(tr, time(d.updatedAt));
+      var actions = cell(tr, '');
+      if (d.state === 'succeeded') {
+        actions.appendChild(button('Roll back', function () {
+          if (window.confirm('Roll ' + d.target + '/' + d.env + ' back to its previous deployment?')) {
+            request('POST', '/actions', { action: 'rollback', target: d.target, env: d.env })
+              .then(refresh, function (e) { showError(e.message); });
+          }
+        }));
+      }
+      if (d.waves && ['pending', 'running'].indexOf(d.state) >= 0) {
+        var verb = d.paused ? 'resume' : 'pause';
+        actions.appendChild(button(d.paused ? 'Resume' : 'Pause', function () {
+          request('POST', '/deployments/' + d.id + '/' + verb)
+            .then(refresh, function (e) { showError(e.message); });
+        }));
+      }
+      if (['awaiting_approval', 'pending', 'running'].indexOf(d.state) >= 0) {
+        actions.appendChild(button('Cancel', function () {
+          if (window.confirm('Cancel deployment ' + d.id + '?')) {
+            request('POST', '/deployments/' + d.id + '/cancel', {})
+              .then(refresh, function (e) { showError(e.message); });
+          }
+        }));
+      }
+      rows.appendChild(tr);
+
+      if (d.state === 'awaiting_approval') {
+        pending++;
+        var ar = document.createElement('tr');
+        cell(ar, d.id);
+        cell(ar, d.target);
+        cell(ar, d.env);
+        cell(ar, time(d.createdAt));
+        var review = cell(ar, '');
+        ['approve', 'reject'].forEach(function (verb) {
+          review.appendChild(button(verb.charAt(0).toUpperCase() + verb.slice(1), function () {
+            var by = reviewer();
+            if (by) {
+              request('POST', '/deployments/' + d.id + '/' + verb, { by: by })
+                .then(refresh, function (e) { showError(e.message); });
+            }
+          }));
+        });
+        approvals.appendChild(ar);
+      }
+    });
+    $('approval-count').textContent = pending ? '(' + pending + ')' : '';
+  }
+
+  function renderWorkers(workers) {
+    var rows = $('worker-rows');
+    rows.innerHTML = '';
+    workers.forEach(function (w) {
+      var tr = document.createElement('tr');
+      cell(tr, w.name);
+      cell(tr, w.addr);
+      cell(tr, Object.keys(w.labels || {}).map(function (k) { return k + '=' + w.labels[k]; }).join(', '));
+      cell(tr, time(w.lastSeen));
+      rows.appendChild(tr);
+    });
+  }
+
+  function renderLocks(locks) {
+    var rows = $('lock-rows');
+    rows.innerHTML = '';
+    locks.forEach(function (l) {
+      var tr = document.createElement('tr');
+      cell(tr, l.env || '-');
+      cell(tr, l.owner);
+      cell(tr, l.mode || 'hold');
+      cell(tr, time(l.createdAt));
+      cell(tr, l.reason);
+      cell(tr, button('Unlock', function () {
+        if (window.confirm('Unlock ' + (l.env || 'the default environment') + ', locked by ' + l.owner + '?')) {
+          var query = '?env=' + encodeURIComponent(l.env || '') + '&force=true';
+          request('DELETE', '/locks' + query).then(refresh, function (e) { showError(e.message); });
+        }
+      }));
+      rows.appendChild(tr);
+    });
+    $('lock-count').textContent = locks.length ? '(' + locks.length + ')' : '';
+  }
+
+  function renderAudit(entries) {
+    var rows = $('audit-rows');
+    rows.innerHTML = '';
+    // Newest first, the API lists them oldest first
+    entries.slice().reverse().forEach(function (e) {
+      var tr = document.createElement('tr');
+      cell(tr, time(e.time));
+      cell(tr, e.actor);
+      cell(tr, e.action);
+      cell(tr, e.subject);
+      cell(tr, e.detail);
+      rows.appendChild(tr);
+    });
+  }
+
+  function renderResources(d) {
+    $('detail-id').textContent = d.id;
+    $('detail-summary').textContent = d.target + '/' + (d.env || '-') + ' is ' + d.state +
+      (d.message ? ': ' + d.message : '') +
+      (d.rolledBackBy ? ', rolled back by ' + d.rolledBackBy : '') +
+      (d.rollbackError ? ', rollback failed: ' + d.rollbackError : '');
+    var rows = $('resource-rows');
+    rows.innerHTML = '';
+    Object.keys(d.resources || {}).forEach(function (worker) {
+      var resources = d.resources[worker];
+      var steps = (d.steps || {})[worker] || {};
+      Object.keys(resources).forEach(function (name) {
+        var tr = document.createElement('tr');
+        var step = name.indexOf('step:') === 0 ? steps[name.slice(5)] : null;
+        cell(tr, worker);
+        cell(tr, step && step.attempts > 1 ? name + ' (' + step.attempts + ' attempts)' : name);
+        cell(tr, badge(resources[name]));
+        if (step && step.message) {
+          tr.title = step.message;
+        }
+        (d.hookResults || []).forEach(function (r) {
+          if (r.worker === worker && name === 'hook:' + r.phase + ':' + r.name) {
+            tr.title = (r.message ? r.message + '\n' : '') + (r.output || '');
+          }
+        });
+        rows.appendChild(tr);
+      });
+    });
+  }
+
+  function diffLine(pre, line) {
+    var span = document.createElement('span');
+    if (line.charAt(0) === '+' || line.charAt(0) === '-') {
+      span.className = line.charAt(0) === '+' ? 'add' : 'del';
+    }
+    span.textContent = line + '\n';
+    pre.appendChild(span);
+  }
+
+  function changeLines(changes) {
+    return (changes || []).map(function (c) {
+      var path = c.path || '.';
+      if (c.kind === 'added') {
+        return '+ ' + path + ': ' + JSON.stringify(c.to);
+      }
+      if (c.kind === 'removed') {
+        return '- ' + path + ': ' + JSON.stringify(c.from);
+      }
+      return '~ ' + path + ': ' + JSON.stringify(c.from) + ' -> ' + JSON.stringify(c.to);
+    });
+  }
+
+  // renderDiff shows what a deployment changes, reviewers check it before
+  // approving
+  function renderDiff(diff) {
+    var pre = $('diff');
+    pre.innerHTML = '';
+    $('diff-from').textContent = diff.from ? 'since ' + diff.from : '';
+    var lines = changeLines(diff.values);
+    if (diff.spec && diff.spec.length) {
+      lines.push('', 'spec');
+      lines = lines.concat(changeLines(diff.spec).map(function (l) { return '  ' + l; }));
+    }
+    (diff.files || []).forEach(function (f) {
+      lines.push('', f.kind + ' ' + f.path);
+      if (f.binary) {
+        lines.push('binary file');
+      } else if (f.unified) {
+        lines = lines.concat(f.unified.replace(/\n$/, '').split('\n'));
+      }
+      if (f.semantic && f.changes) {
+        lines = lines.concat(changeLines(f.changes).map(function (l) { return '  ' + l; }));
+      }
+    });
+    if (!lines.length) {
+      lines.push('No changes');
+    }
+    lines.forEach(function (line) { diffLine(pre, line); });
+  }
+
+  function showDeployment(id) {
+    $('detail').hidden = false;
+    $('logs').textContent = '';
+    $('diff').textContent = '';
+    request('GET', '/deployments/' + id + '/diff').then(renderDiff, function (e) { showError(e.message); });
+    if (logSource) {
+      logSource.close();
+    }
+    request('GET', '/deployments/' + id).then(renderResources, function (e) { showError(e.message); });
+    logSource = new EventSource('/deployments/' + id + '/logs?follow=true&access_token=' +
+      encodeURIComponent(token()));
+    logSource.addEventListener('log', function (e) {
+      var entry = JSON.parse(e.data);
+      var logs = $('logs');
+      logs.textContent += time(entry.time) + ' [' + entry.source + '] ' + entry.line + '\n';
+      logs.scrollTop = logs.scrollHeight;
+    });
+    logSource.addEventListener('end', function () {
+      logSource.close();
+      request('GET', '/deployments/' + id).then(renderResources);
+    });
+    $('detail').scrollIntoView();
+  }
+
+  function refresh() {
+    request('GET', '/deployments').then(renderDeployments, function (e) { showError(e.message); });
+    request('GET', '/workers').then(renderWorkers, function (e) { showError(e.message); });
+    request('GET', '/locks').then(renderLocks, function (e) { showError(e.message); });
+    request('GET', '/audit?limit=20').then(renderAudit, function (e) { showError(e.message); });
+  }
+
+  $('lock-form').addEventListener('submit', function (e) {
+    e.preventDefault();
+    var form = e.target;
+    var fields = form.elements;
+    var lock = {
+      env: fields.namedItem('env').value,
+      owner: fields.namedItem('owner').value,
+      reason: fields.namedItem('reason').value,
+      mode: fields.namedItem('mode').value
+    };
+    request('POST', '/locks', lock).then(function () {
+      form.reset();
+      refresh();
+    }, function (err) { showError(err.message); });
+  });
+
+  $('deploy-form').addEventListener('submit', function (e) {
+    e.preventDefault();
+    var form = e.target;
+    // form.target is the form attribute, so inputs are looked up explicitly
+    var fields = form.elements;
+    var action = {
+      action: 'deploy',
+      target: fields.namedItem('target').value,
+      env: fields.namedItem('env').value,
+      workers: fields.namedItem('workers').value.split(',').map(function (w) { return w.trim(); }).filter(Boolean)
+    };
+    try {
+      if (fields.namedItem('values').value.trim()) {
+        action.values = JSON.parse(fields.namedItem('values').value);
+      }
+    } catch (err) {
+      showError('Values must be JSON: ' + err.message);
+      return;
+    }
+    request('POST', '/actions', action).then(function (d) {
+      form.reset();
+      refresh();
+      showDeployment(d.id);
+    }, function (err) { showError(err.message); });
+  });
+
+  refresh();
+  setInterval(refresh, refreshInterval);
+})();
@@ -0,0 +1,584 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/spec"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindDeployments = "deployments"
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *Server) getDeployment(id string) (*api.Deployment, error) {
+	d := &api.Deployment{}
+	if err := s.store.Get(kindDeployments, id, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *Server) saveDeployment(d *api.Deployment) error {
+	d.UpdatedAt = time.Now()
+	if d.State.Terminal() && d.EndedAt == nil {
+		d.EndedAt = &d.UpdatedAt
+	}
+	return s.store.Put(kindDeployments, d.ID, d)
+}
+
+// updateDeployment applies fn to the stored deployment and saves the result,
+// nothing is saved if fn fails
+func (s *Server) updateDeployment(id string, fn func(d *api.Deployment) error) (*api.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.getDeployment(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(d); err != nil {
+		return nil, err
+	}
+	if err := s.saveDeployment(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// listDeployments returns all deployments, newest first
+func (s *Server) listDeployments() ([]*api.Deployment, error) {
+	ids, err := s.store.List(kindDeployments)
+	if err != nil {
+		return nil, err
+	}
+	deployments := make([]*api.Deployment, 0, len(ids))
+	for _, id := range ids {
+		d, err := s.getDeployment(id)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, d)
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].CreatedAt.After(deployments[j].CreatedAt)
+	})
+	return deployments, nil
+}
+
+// recordStatus merges resources and steps reported by a worker and derives
+// the deployment state from what every worker reported so far. Workers which
+// succeeded are verified first when the deployment has probes.
+func recordStatus(d *api.Deployment, worker string, resources map[string]pb.ResourceState, steps []*pb.StepStatus) {
+	if worker == "" && len(d.Workers) == 1 {
+		worker = d.Workers[0]
+	}
+	if d.Resources == nil {
+		d.Resources = make(map[string]map[string]pb.ResourceState)
+	}
+	if len(steps) > 0 {
+		if d.Steps == nil {
+			d.Steps = make(map[string]map[string]api.StepStatus)
+		}
+		if d.Steps[worker] == nil {
+			d.Steps[worker] = make(map[string]api.StepStatus)
+		}
+		for _, step := range steps {
+			d.Steps[worker][step.Name] = api.StepStatus{State: step.State, Attempts: int(step.Attempts), Message: step.Message}
+		}
+	}
+	reported := make(map[string]pb.ResourceState, len(resources))
+	for k, v := range resources {
+		reported[k] = v
+	}
+	for _, step := range steps {
+		if _, ok := reported[spec.Resource(step.Name)]; !ok {
+			reported[spec.Resource(step.Name)] = step.State
+		}
+	}
+	// Workers may report steps as they end, the ones missing keep their
+	// last state. Workers which never reported a step do not run the spec,
+	// their steps are not waited for.
+	if d.Spec != nil && reportsSteps(d.Resources[worker], reported) {
+		for _, step := range d.Spec.Steps {
+			name := spec.Resource(step.Name)
+			if _, ok := reported[name]; ok {
+				continue
+			}
+			if last, ok := d.Resources[worker][name]; ok {
+				reported[name] = last
+			} else {
+				reported[name] = pb.ResourceState_RES_PENDING
+			}
+		}
+	}
+	keepHooks(d, worker, reported)
+	// Probe outcomes are recorded by the server, workers do not report them
+	verified := false
+	for k, v := range d.Resources[worker] {
+		if isProbeResource(k) {
+			reported[k] = v
+			verified = true
+		}
+	}
+	if d.Verify != nil && !verified && workerState(reported) == pb.ResourceState_RES_SUCCESS {
+		for _, p := range d.Verify.Probes {
+			reported[probeResource(p.Name)] = pb.ResourceState_RES_PENDING
+		}
+	}
+	d.Resources[worker] = reported
+	evaluate(d)
+}
+
+// reportsSteps tells whether a worker reported any step so far
+func reportsSteps(resources ...map[string]pb.ResourceState) bool {
+	for _, r := range resources {
+		for k := range r {
+			if spec.IsResource(k) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evaluate derives the deployment state from the resources of its workers.
+// Deployments in waves move on to the next wave once every worker of the
+// current one ended.
+func evaluate(d *api.Deployment) {
+	var failed []string
+	for _, w := range d.Workers {
+		if workerState(d.Resources[w]) == pb.ResourceState_RES_ERROR {
+			failed = append(failed, w)
+		}
+	}
+	if len(failed) > maxFailures(d) {
+		d.State = api.DeploymentFailed
+		if d.Rollout == nil {
+			d.Message = fmt.Sprintf("worker %s reported an error", failed[0])
+		} else {
+			d.Message = fmt.Sprintf("rollout stopped, workers %v failed and at most %d may", failed, maxFailures(d))
+		}
+		return
+	}
+	if d.NextWaveAt != nil {
+		return
+	}
+	for _, w := range dispatchedWorkers(d) {
+		if workerState(d.Resources[w]) == pb.ResourceState_RES_PENDING {
+			return
+		}
+	}
+	if d.Wave < len(d.Waves)-1 {
+		nextWave(d)
+		return
+	}
+	d.State = api.DeploymentSucceeded
+	d.Message = ""
+	if len(failed) > 0 {
+		d.Message = fmt.Sprintf("workers %v failed", failed)
+	}
+}
+
+// workerState summarizes the resources of one worker. RES_OTHER marks
+// resources which ended without failing the worker, such as steps skipped or
+// whose failure is ignored.
+func workerState(resources map[string]pb.ResourceState) pb.ResourceState {
+	if len(resources) == 0 {
+		return pb.ResourceState_RES_PENDING
+	}
+	state := pb.ResourceState_RES_SUCCESS
+	for _, r := range resources {
+		switch r {
+		case pb.ResourceState_RES_ERROR:
+			return r
+		case pb.ResourceState_RES_SUCCESS, pb.ResourceState_RES_OTHER:
+		default:
+			state = pb.ResourceState_RES_PENDING
+		}
+	}
+	return state
+}
+
+func (s *Server) postAction(c *gin.Context) {
+	var action api.Action
+	if err := c.ShouldBindJSON(&action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Retries must match what was sent, before the server completes it
+	digest := actionDigest(&action)
+	if o := action.FreezeOverride; o != nil && (s.config().Auth != nil || o.By == "") {
+		o.By = caller(c)
+	}
+	if o := action.LockOverride; o != nil && (s.config().Auth != nil || o.By == "") {
+		o.By = caller(c)
+	}
+	switch action.Action {
+	case api.ActionDeploy, api.ActionRollback:
+		var key string
+		if k := c.GetHeader(idempotencyHeader); k != "" {
+			if len(k) > maxIdempotencyKey {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is longer than %d bytes", idempotencyHeader, maxIdempotencyKey)})
+				return
+			}
+			key = submissionKey(caller(c), k)
+			s.keyMu.Lock()
+			defer s.keyMu.Unlock()
+			d, err := s.replay(key, digest, time.Now())
+			if err == errKeyReused {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if d != nil {
+				c.Header(replayedHeader, "true")
+				c.JSON(http.StatusCreated, d)
+				return
+			}
+		}
+		d, err := s.createDeployment(&action)
+		if _, ok := err.(errConflict); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if key != "" {
+			s.remember(key, digest, d)
+		}
+		c.JSON(http.StatusCreated, d)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown action %s", action.Action)})
+	}
+}
+
+// createDeployment creates the deployment of an action, prepare functions
+// complete it before it is checked and saved
+func (s *Server) createDeployment(action *api.Action, prepare ...func(d *api.Deployment)) (*api.Deployment, error) {
+	if action.Target == "" {
+		return nil, fmt.Errorf("target is required")
+	}
+	d := &api.Deployment{
+		ID:        newID(),
+		Target:    action.Target,
+		Env:       action.Env,
+		Values:    action.Values,
+		Workers:   action.Workers,
+		Rollout:   action.Rollout,
+		Verify:    action.Verify,
+		Files:     action.Files,
+		Spec:      action.Spec,
+		State:     api.DeploymentPending,
+		CreatedAt: time.Now(),
+	}
+	var source *api.Deployment
+	if action.Action == api.ActionRollback {
+		current, previous, err := s.rollbackSource(action.Target, action.Env)
+		if err != nil {
+			return nil, err
+		}
+		source = previous
+		d.Values = previous.Values
+		d.Overlay = previous.Overlay
+		d.Files = previous.Files
+		d.Spec = previous.Spec
+		d.Workers = previous.Workers
+		d.RollbackOf = current.ID
+		if d.Rollout == nil {
+			d.Rollout = previous.Rollout
+		}
+		if d.Verify == nil {
+			d.Verify = previous.Verify
+		}
+	}
+	for _, fn := range prepare {
+		fn(d)
+	}
+	if len(action.Selector) > 0 {
+		selected, err := s.selectWorkers(action.Selector)
+		if err != nil {
+			return nil, err
+		}
+		d.Workers = mergeWorkers(d.Workers, selected)
+	}
+	if len(d.Workers) == 0 {
+		return nil, fmt.Errorf("at least one worker is required")
+	}
+	if err := s.validateVerification(d.Verify); err != nil {
+		return nil, err
+	}
+	if err := s.checkFiles(d.Files); err != nil {
+		return nil, err
+	}
+	if d.Spec != nil {
+		if err := spec.Validate(d.Spec); err != nil {
+			return nil, fmt.Errorf("invalid spec:%v", err)
+		}
+	}
+	d.Hooks = s.deploymentHooks(d)
+	artifact, err := artifactDigest(d.Target, d.Values, d.Files, d.Spec)
+	if err != nil {
+		return nil, err
+	}
+	d.Artifact = artifact
+	if d.Rollout != nil {
+		waves, err := planWaves(d.Workers, d.Rollout)
+		if err != nil {
+			return nil, err
+		}
+		d.Waves = waves
+	}
+	if s.requiresApproval(d.Env) {
+		d.State = api.DeploymentAwaitingApproval
+	}
+	if err := s.checkFreezes(d.Env, action.FreezeOverride); err != nil {
+		return nil, err
+	}
+	d.FreezeOverride = action.FreezeOverride
+	overridden, err := s.checkLock(d.Env, action.LockOverride)
+	if err != nil {
+		return nil, err
+	}
+	if overridden != nil {
+		o := *action.LockOverride
+		o.LockedAt = &overridden.CreatedAt
+		d.LockOverride = &o
+	}
+	if err := s.saveDeployment(d); err != nil {
+		return nil, err
+	}
+	if source != nil {
+		s.logf(d.ID, "created to roll %s back to %s", d.RollbackOf, source.ID)
+	} else {
+		s.logf(d.ID, "created for %s/%s", d.Target, d.Env)
+	}
+	if o := d.FreezeOverride; o != nil && len(o.Freezes) > 0 {
+		s.audit(o.By, auditOverrideFreeze, "deployment "+d.ID, strings.Join(o.Freezes, ", ")+": "+o.Reason)
+		s.logf(d.ID, "freezes %s overridden by %s: %s", strings.Join(o.Freezes, ", "), o.By, o.Reason)
+	}
+	if o := d.LockOverride; o != nil {
+		s.audit(o.By, auditOverrideLock, "deployment "+d.ID, envName(d.Env)+": "+o.Reason)
+		s.logf(d.ID, "lock of %s overridden by %s: %s", envName(d.Env), o.By, o.Reason)
+	}
+	return d, nil
+}
+
+// mergeWorkers appends the workers of more not in workers yet
+func mergeWorkers(workers, more []string) []string {
+	seen := make(map[string]bool, len(workers))
+	merged := append([]string(nil), workers...)
+	for _, w := range workers {
+		seen[w] = true
+	}
+	for _, w := range more {
+		if !seen[w] {
+			seen[w] = true
+			merged = append(merged, w)
+		}
+	}
+	return merged
+}
+
+// rollbackSource finds the current deployment of target and env, the latest
+// one which ran whether it succeeded or not, and the successful one before
+// it to go back to. What a rollback undid is skipped, by deployment and by
+// artifact, as well as what the current deployment succeeded deploying, so
+// that rolling back again goes further back instead of forward.
+func (s *Server) rollbackSource(target, env string) (current, previous *api.Deployment, err error) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		return nil, nil, err
+	}
+	undone := make(map[string]bool)
+	undoneArtifacts := make(map[string]bool)
+	for _, d := range deployments {
+		if d.Target != target || d.Env != env || !ran(d) {
+			continue
+		}
+		if d.RollbackOf != "" {
+			undone[d.RollbackOf] = true
+		}
+		if undone[d.ID] && d.Artifact != "" {
+			undoneArtifacts[d.Artifact] = true
+		}
+		if current == nil {
+			current = d
+			continue
+		}
+		if d.State != api.DeploymentSucceeded || undone[d.ID] || undoneArtifacts[d.Artifact] {
+			continue
+		}
+		if current.State == api.DeploymentSucceeded && d.Artifact != "" && d.Artifact == current.Artifact {
+			continue
+		}
+		return current, d, nil
+	}
+	return nil, nil, fmt.Errorf("no earlier successful deployment of %s/%s to roll back to", target, env)
+}
+
+// ran reports whether a deployment reached workers, unlike ones waiting or
+// cancelled before they started
+func ran(d *api.Deployment) bool {
+	switch d.State {
+	case api.DeploymentRunning, api.DeploymentSucceeded, api.DeploymentFailed:
+		return true
+	}
+	return false
+}
+
+func (s *Server) requiresApproval(env string) bool {
+	for _, e := range s.config().RequireApproval {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) approveHandler(c *gin.Context) {
+	s.review(c, api.DeploymentPending)
+}
+
+func (s *Server) rejectHandler(c *gin.Context) {
+	s.review(c, api.DeploymentCancelled)
+}
+
+// review moves a deployment awaiting approval to the given state
+func (s *Server) review(c *gin.Context, state api.DeploymentState) {
+	var review api.Review
+	if err := c.ShouldBindJSON(&review); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if s.config().Auth != nil {
+		review.By = caller(c)
+	}
+	if review.By == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reviewer is required"})
+		return
+	}
+	d, err := s.updateDeployment(c.Param("id"), func(d *api.Deployment) error {
+		if d.State != api.DeploymentAwaitingApproval {
+			return errConflict{fmt.Sprintf("deployment is %s", d.State)}
+		}
+		d.State = state
+		if state == api.DeploymentPending {
+			d.ApprovedBy = review.By
+		} else {
+			d.Message = fmt.Sprintf("rejected by %s", review.By)
+		}
+		return nil
+	})
+	switch err.(type) {
+	case nil:
+	case errConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if state == api.DeploymentPending {
+		s.logf(d.ID, "approved by %s: %s", review.By, review.Comment)
+	} else {
+		s.logf(d.ID, "rejected by %s: %s", review.By, review.Comment)
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// cancelHandler stops a deployment which has not ended yet. Workers are not
+// interrupted, updates they send afterwards are ignored.
+func (s *Server) cancelHandler(c *gin.Context) {
+	var review api.Review
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&review); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if s.config().Auth != nil || review.By == "" {
+		review.By = caller(c)
+	}
+	d, err := s.updateDeployment(c.Param("id"), func(d *api.Deployment) error {
+		if d.State.Terminal() {
+			return errConflict{fmt.Sprintf("deployment is %s", d.State)}
+		}
+		d.State = api.DeploymentCancelled
+		d.Message = fmt.Sprintf("cancelled by %s", review.By)
+		return nil
+	})
+	switch err.(type) {
+	case nil:
+	case errConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logf(d.ID, "cancelled by %s: %s", review.By, review.Comment)
+	c.JSON(http.StatusOK, d)
+}
+
+// errConflict reports a request which does not fit the current state
+type errConflict struct {
+	msg string
+}
+
+func (e errConflict) Error() string {
+	return e.msg
+}
+
+func (s *Server) listDeploymentsHandler(c *gin.Context) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deployments)
+}
+
+func (s *Server) getDeploymentHandler(c *gin.Context) {
+	d, err := s.getDeployment(c.Param("id"))
+	if err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
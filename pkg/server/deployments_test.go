@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+// call sends a REST request to s and decodes the JSON response into out
+func call(t *testing.T, s *Server, method, path, body string, out interface{}) int {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if out != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("failed to decode %s: %v", w.Body, err)
+		}
+	}
+	return w.Code
+}
+
+func TestApproval(t *testing.T) {
+	s := New(&config.Config{RequireApproval: []string{"prod"}})
+	var d api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"]}`, &d); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if d.State != api.DeploymentAwaitingApproval {
+		t.Fatalf("expected deployment to await approval, got %s", d.State)
+	}
+	if code := call(t, s, "POST", "/deployments/"+d.ID+"/approve", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected approval without reviewer to be rejected, got %d", code)
+	}
+	if code := call(t, s, "POST", "/deployments/"+d.ID+"/approve", `{"by":"alice"}`, &d); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if d.State != api.DeploymentPending || d.ApprovedBy != "alice" {
+		t.Errorf("expected approved deployment to be pending, got %+v", d)
+	}
+	if code := call(t, s, "POST", "/deployments/"+d.ID+"/reject", `{"by":"bob"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected rejecting an approved deployment to conflict, got %d", code)
+	}
+
+	var entries []api.LogEntry
+	call(t, s, "GET", "/deployments/"+d.ID+"/logs", "", &entries)
+	if len(entries) != 2 || !strings.Contains(entries[1].Line, "approved by alice") {
+		t.Errorf("unexpected log %+v", entries)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	st := store.NewMemory()
+	s := New(&config.Config{}, WithStore(st))
+	if code := call(t, s, "POST", "/actions", `{"action":"rollback","target":"web"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected rollback without history to fail, got %d", code)
+	}
+	finish := func(id string, state api.DeploymentState) {
+		s.updateDeployment(id, func(d *api.Deployment) error {
+			d.State = state
+			return nil
+		})
+	}
+	var ids []string
+	for _, version := range []string{"1", "2", "3"} {
+		var d api.Deployment
+		call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"values":{"version":"`+version+`"}}`, &d)
+		finish(d.ID, api.DeploymentSucceeded)
+		ids = append(ids, d.ID)
+	}
+	// A failed deployment is the current one, the last good version is
+	// rolled back to
+	var failed api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"values":{"version":"4"}}`, &failed)
+	finish(failed.ID, api.DeploymentFailed)
+	var d api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"rollback","target":"web"}`, &d); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if d.RollbackOf != failed.ID || d.Values["version"] != "3" || len(d.Workers) != 1 {
+		t.Errorf("expected rollback of %s to version 3, got %+v", failed.ID, d)
+	}
+	finish(d.ID, api.DeploymentSucceeded)
+
+	// Rolling back again goes further back rather than to what was undone
+	for _, version := range []string{"2", "1"} {
+		current := d.ID
+		if code := call(t, s, "POST", "/actions", `{"action":"rollback","target":"web"}`, &d); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", code)
+		}
+		if d.RollbackOf != current || d.Values["version"] != version {
+			t.Errorf("expected rollback of %s to version %s, got %+v", current, version, d)
+		}
+		finish(d.ID, api.DeploymentSucceeded)
+	}
+	if code := call(t, s, "POST", "/actions", `{"action":"rollback","target":"web"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected rollback past the first deployment to fail, got %d", code)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	s := New(&config.Config{})
+	req := httptest.NewRequest("GET", "/ui/", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<title>Deployer</title>") {
+		t.Errorf("expected dashboard, got %d", w.Code)
+	}
+	req = httptest.NewRequest("GET", "/ui/app.js", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected dashboard script, got %d", w.Code)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := New(&config.Config{})
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"]}`, &d)
+	if code := call(t, s, "POST", "/deployments/"+d.ID+"/cancel", "", &d); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if d.State != api.DeploymentCancelled {
+		t.Errorf("expected deployment to be cancelled, got %s", d.State)
+	}
+	if code := call(t, s, "POST", "/deployments/"+d.ID+"/cancel", `{"comment":"again"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected cancelling twice to conflict, got %d", code)
+	}
+}
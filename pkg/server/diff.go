@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/diff"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+// effectiveValues are the values workers get for d, overlay merged over them.
+// They are empty for a nil deployment so that every value compares as added.
+func effectiveValues(d *api.Deployment) map[string]interface{} {
+	if d == nil {
+		return map[string]interface{}{}
+	}
+	values := mergeValues(nil, d.Values)
+	return mergeValues(values, d.Overlay)
+}
+
+// mergeValues merges src into a copy of dst, nested maps are merged key by
+// key
+func mergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(dst)+len(src))
+	for k, v := range dst {
+		merged[k] = v
+	}
+	for k, v := range src {
+		sv, ok := v.(map[string]interface{})
+		if dv, isMap := merged[k].(map[string]interface{}); ok && isMap {
+			merged[k] = mergeValues(dv, sv)
+		} else if ok {
+			merged[k] = mergeValues(nil, sv)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// specValues is the spec of d as decoded JSON for diff.Values, nothing for a
+// deployment without spec
+func specValues(d *api.Deployment) interface{} {
+	if d == nil || d.Spec == nil {
+		return map[string]interface{}{}
+	}
+	raw, err := json.Marshal(d.Spec)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return map[string]interface{}{}
+	}
+	return v
+}
+
+// baseline returns what d is compared with: the deployment running when d
+// has not run yet, the one which ran before it otherwise
+func baseline(deployments []*api.Deployment, d *api.Deployment) *api.Deployment {
+	ran := d.State == api.DeploymentRunning || d.State == api.DeploymentSucceeded || d.State == api.DeploymentFailed
+	seen := false
+	for _, other := range deployments {
+		if other.ID == d.ID {
+			seen = true
+			continue
+		}
+		if other.Target != d.Target || other.Env != d.Env || (ran && !seen) {
+			continue
+		}
+		switch other.State {
+		case api.DeploymentRunning, api.DeploymentSucceeded, api.DeploymentFailed:
+			return other
+		}
+	}
+	return nil
+}
+
+// maxDiffBytes bounds the size of the files compared, diffs are computed
+// in memory
+const maxDiffBytes = 1 << 20
+
+// readBlob reads the content of a blob, it is nil when the blob is larger
+// than maxDiffBytes
+func (s *Server) readBlob(digest string) ([]byte, bool, error) {
+	if s.blobs == nil {
+		return nil, false, fmt.Errorf("the blob store is not configured on the server")
+	}
+	f, info, err := s.blobs.Open(digest)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open blob %s:%v", digest, err)
+	}
+	defer f.Close()
+	if info.Size > maxDiffBytes {
+		return nil, true, nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(f, maxDiffBytes))
+	return data, false, err
+}
+
+func binary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+// diffFile compares the revisions of a file, a missing revision has an empty
+// digest
+func (s *Server) diffFile(path, from, to string) (api.FileDiff, error) {
+	fd := api.FileDiff{Path: path, Kind: api.ChangeModified, FromDigest: from, ToDigest: to}
+	var a, b []byte
+	var aLarge, bLarge bool
+	var err error
+	fromName, toName := "a/"+path, "b/"+path
+	if from == "" {
+		fd.Kind, fromName = api.ChangeAdded, "/dev/null"
+	} else if a, aLarge, err = s.readBlob(from); err != nil {
+		return fd, err
+	}
+	if to == "" {
+		fd.Kind, toName = api.ChangeRemoved, "/dev/null"
+	} else if b, bLarge, err = s.readBlob(to); err != nil {
+		return fd, err
+	}
+	if aLarge || bLarge {
+		fd.TooLarge = true
+		return fd, nil
+	}
+	if binary(a) || binary(b) {
+		fd.Binary = true
+		return fd, nil
+	}
+	fd.Unified = diff.Unified(fromName, toName, string(a), string(b), diff.DefaultContext)
+	if fd.Kind == api.ChangeModified && diff.Structured(path) {
+		// Files which do not parse only get the text diff
+		av, aerr := diff.Parse(path, a)
+		bv, berr := diff.Parse(path, b)
+		if aerr == nil && berr == nil {
+			fd.Semantic = true
+			fd.Changes = diff.Values(av, bv)
+		}
+	}
+	return fd, nil
+}
+
+// diffDeployments tells what changes from deployment from, which may be nil,
+// to deployment to
+func (s *Server) diffDeployments(from, to *api.Deployment) (*api.Diff, error) {
+	result := &api.Diff{To: to.ID, Files: []api.FileDiff{}}
+	var fromFiles map[string]string
+	if from != nil {
+		result.From = from.ID
+		fromFiles = from.Files
+	}
+	result.Values = diff.Values(effectiveValues(from), effectiveValues(to))
+	result.Spec = diff.Values(specValues(from), specValues(to))
+
+	paths := make([]string, 0, len(fromFiles)+len(to.Files))
+	for p := range fromFiles {
+		paths = append(paths, p)
+	}
+	for p := range to.Files {
+		if _, ok := fromFiles[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if fromFiles[p] == to.Files[p] {
+			continue
+		}
+		fd, err := s.diffFile(p, fromFiles[p], to.Files[p])
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, fd)
+	}
+	return result, nil
+}
+
+func (s *Server) diffHandler(c *gin.Context) {
+	to, err := s.getDeployment(c.Param("id"))
+	if err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var from *api.Deployment
+	if against := c.Query("against"); against != "" {
+		if from, err = s.getDeployment(against); err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deployment " + against + " not found"})
+			return
+		}
+	} else {
+		var deployments []*api.Deployment
+		if deployments, err = s.listDeployments(); err == nil {
+			from = baseline(deployments, to)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := s.diffDeployments(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
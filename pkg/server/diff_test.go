@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+func TestDiff(t *testing.T) {
+	s := newBlobsServer(t, &fakeWorkers{})
+	upload := func(content string) string {
+		var b api.Blob
+		if code := call(t, s, "POST", "/blobs", content, &b); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", code)
+		}
+		return b.Digest
+	}
+	v1 := upload("kind: Deployment\nspec:\n  replicas: 2\n  image: web:1\n")
+	v2 := upload("kind: Deployment\nspec:\n  image: web:2\n  replicas: 2\n")
+	notes := upload("first release\n")
+
+	var first api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"values":{"tag":"1","debug":true},"files":{"app.yaml":"`+v1+`"}}`, &first)
+	s.schedule(context.Background())
+	report(t, s, first.ID, "w1", pb.ResourceState_RES_SUCCESS)
+
+	var second api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"values":{"tag":"2"},"files":{"app.yaml":"`+v2+`","NOTES":"`+notes+`"}}`, &second)
+
+	var d api.Diff
+	if code := call(t, s, "GET", "/deployments/"+second.ID+"/diff", "", &d); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if d.From != first.ID || len(d.Values) != 2 {
+		t.Fatalf("expected debug and tag to change since %s, got %+v", first.ID, d)
+	}
+	if len(d.Files) != 2 || d.Files[0].Path != "NOTES" || d.Files[0].Kind != api.ChangeAdded {
+		t.Fatalf("expected NOTES added and app.yaml modified, got %+v", d.Files)
+	}
+	app := d.Files[1]
+	if app.Unified == "" || !app.Semantic || len(app.Changes) != 1 || app.Changes[0].Path != "spec.image" {
+		t.Errorf("expected a text diff and the image change only, got %+v", app)
+	}
+
+	// Once the second one ran, it is compared with the first one still
+	s.schedule(context.Background())
+	report(t, s, second.ID, "w1", pb.ResourceState_RES_SUCCESS)
+	call(t, s, "GET", "/deployments/"+second.ID+"/diff", "", &d)
+	if d.From != first.ID {
+		t.Errorf("expected the comparison with %s, got %s", first.ID, d.From)
+	}
+	call(t, s, "GET", "/deployments/"+first.ID+"/diff?against="+second.ID, "", &d)
+	if d.From != second.ID || len(d.Files) != 2 || d.Files[0].Kind != api.ChangeRemoved {
+		t.Errorf("expected NOTES to be removed going back, got %+v", d)
+	}
+	if code := call(t, s, "GET", "/deployments/"+first.ID+"/diff?against=nope", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+
+	// Large files are not read to be compared
+	large, err := s.blobs.Put(strings.NewReader(strings.Repeat("a\n", maxDiffBytes)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := s.diffFile("big.txt", v1, large.Digest)
+	if err != nil || !fd.TooLarge || fd.Unified != "" {
+		t.Errorf("expected the file to be too large to compare, got %+v %v", fd, err)
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindDrift = "drift"
+
+func driftKey(worker, target, env string) string {
+	return worker + "/" + target + "/" + env
+}
+
+func hasWorker(d *api.Deployment, worker string) bool {
+	for _, w := range d.Workers {
+		if w == worker {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedDeployment returns the last successful deployment of target to env
+// on worker, and whether a deployment to the worker is in flight, during
+// which drift is not evaluated
+func expectedDeployment(deployments []*api.Deployment, worker, target, env string) (expected *api.Deployment, inflight bool) {
+	for _, d := range deployments {
+		if d.Target != target || d.Env != env || !hasWorker(d, worker) {
+			continue
+		}
+		switch d.State {
+		case api.DeploymentPending, api.DeploymentRunning:
+			return nil, true
+		case api.DeploymentSucceeded:
+			return d, false
+		}
+	}
+	return nil, false
+}
+
+// generatedFiles are the files of an observation which are not files of
+// the deployment expected, the worker wrote them such as by rendering.
+// The manifest and secrets change with every deployment, they are left out.
+func generatedFiles(expected *api.Deployment, o *api.Observation) map[string]string {
+	generated := make(map[string]string)
+	for path, digest := range o.Files {
+		if _, ok := expected.Files[path]; !ok && path != manifestPath && path != secretsPath {
+			generated[path] = digest
+		}
+	}
+	return generated
+}
+
+// detectDrift compares what a worker observed with the deployment expected
+// on it. Files the worker generated are compared with their digests when
+// first observed holding expected, generated is nil until then.
+func detectDrift(worker string, expected *api.Deployment, generated map[string]string, o *api.Observation) *api.Drift {
+	drift := &api.Drift{
+		Worker:    worker,
+		Target:    expected.Target,
+		Env:       expected.Env,
+		Expected:  expected.ID,
+		Observed:  o.Deployment,
+		Generated: generated,
+	}
+	for path, digest := range expected.Files {
+		switch observed, ok := o.Files[path]; {
+		case !ok:
+			drift.Files = append(drift.Files, api.DriftedFile{Path: path, Kind: api.ChangeRemoved, Expected: digest})
+		case observed != digest:
+			drift.Files = append(drift.Files, api.DriftedFile{Path: path, Kind: api.ChangeModified, Expected: digest, Observed: observed})
+		}
+	}
+	if generated != nil {
+		observed := generatedFiles(expected, o)
+		for path, digest := range generated {
+			switch current, ok := observed[path]; {
+			case !ok:
+				drift.Files = append(drift.Files, api.DriftedFile{Path: path, Kind: api.ChangeRemoved, Expected: digest})
+			case current != digest:
+				drift.Files = append(drift.Files, api.DriftedFile{Path: path, Kind: api.ChangeModified, Expected: digest, Observed: current})
+			}
+		}
+		for path, digest := range observed {
+			if _, ok := generated[path]; !ok {
+				drift.Files = append(drift.Files, api.DriftedFile{Path: path, Kind: api.ChangeAdded, Observed: digest})
+			}
+		}
+	}
+	sort.Slice(drift.Files, func(i, j int) bool { return drift.Files[i].Path < drift.Files[j].Path })
+	for _, check := range o.Checks {
+		if !check.OK {
+			drift.Checks = append(drift.Checks, check)
+		}
+	}
+	drift.Drifted = o.Deployment != expected.ID || len(drift.Files) > 0 || len(drift.Checks) > 0
+	return drift
+}
+
+// driftSummary tells in a line how a worker drifted
+func driftSummary(drift *api.Drift) string {
+	var parts []string
+	if drift.Observed != drift.Expected {
+		parts = append(parts, "runs "+drift.Observed)
+	}
+	for _, f := range drift.Files {
+		parts = append(parts, f.Path+" "+f.Kind)
+	}
+	for _, c := range drift.Checks {
+		parts = append(parts, "check "+c.Name+" failed")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// observe records what a worker observed of deployment observed. It returns
+// nil when there is nothing to compare with yet.
+func (s *Server) observe(worker string, observed *api.Deployment, o *api.Observation, now time.Time) (*api.Drift, error) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		return nil, err
+	}
+	expected, inflight := expectedDeployment(deployments, worker, observed.Target, observed.Env)
+	if expected == nil || inflight {
+		return nil, nil
+	}
+
+	s.driftMu.Lock()
+	defer s.driftMu.Unlock()
+	key := driftKey(worker, expected.Target, expected.Env)
+	previous := &api.Drift{}
+	if err := s.store.Get(kindDrift, key, previous); err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	// What the worker generated is recorded the first time it is seen
+	// holding the deployment expected, it is compared with afterwards
+	generated := previous.Generated
+	if previous.Expected != expected.ID {
+		generated = nil
+	}
+	if generated == nil && o.Deployment == expected.ID {
+		generated = generatedFiles(expected, o)
+	}
+	drift := detectDrift(worker, expected, generated, o)
+	drift.ObservedAt = now
+	if drift.Drifted {
+		drift.Since = previous.Since
+		drift.Reconciliation, drift.ReconcileError = previous.Reconciliation, previous.ReconcileError
+		if drift.Since == nil {
+			drift.Since = &now
+			log.Println("Worker", worker, "drifted from deployment", expected.ID, ":", driftSummary(drift))
+			s.logf(expected.ID, "worker %s drifted: %s", worker, driftSummary(drift))
+			if cfg := s.config(); cfg.Drift != nil && cfg.Drift.Reconcile {
+				s.reconcile(drift, expected)
+			}
+		}
+	} else if previous.Drifted {
+		log.Println("Worker", worker, "matches deployment", expected.ID, "again")
+	}
+	if err := s.store.Put(kindDrift, key, drift); err != nil {
+		return nil, err
+	}
+	return drift, nil
+}
+
+// reconcile deploys expected again on the worker which drifted from it
+func (s *Server) reconcile(drift *api.Drift, expected *api.Deployment) {
+	d, err := s.createDeployment(&api.Action{
+		Action:  api.ActionDeploy,
+		Target:  expected.Target,
+		Env:     expected.Env,
+		Values:  expected.Values,
+		Workers: []string{drift.Worker},
+		Verify:  expected.Verify,
+		Files:   expected.Files,
+		Spec:    expected.Spec,
+	}, func(d *api.Deployment) {
+		d.Overlay = expected.Overlay
+	})
+	if err != nil {
+		drift.ReconcileError = err.Error()
+		log.Println("Failed to reconcile worker", drift.Worker, ":", err)
+		return
+	}
+	drift.Reconciliation = d.ID
+	s.logf(d.ID, "reconciles worker %s which drifted from %s", drift.Worker, expected.ID)
+}
+
+func (s *Server) listDrift() ([]*api.Drift, error) {
+	keys, err := s.store.List(kindDrift)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	list := make([]*api.Drift, 0, len(keys))
+	for _, key := range keys {
+		drift := &api.Drift{}
+		if err := s.store.Get(kindDrift, key, drift); err == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		list = append(list, drift)
+	}
+	return list, nil
+}
+
+// observeHandler takes the observation of a worker, the drift found is
+// returned, nothing when a deployment to the worker is in flight
+func (s *Server) observeHandler(c *gin.Context) {
+	var o api.Observation
+	if err := c.ShouldBindJSON(&o); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	worker := c.Param("name")
+	if _, err := s.getWorker(worker); err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "worker not found"})
+		return
+	}
+	observed, err := s.getDeployment(o.Deployment)
+	if err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !hasWorker(observed, worker) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("deployment %s does not run on %s", observed.ID, worker)})
+		return
+	}
+	drift, err := s.observe(worker, observed, &o, time.Now())
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case drift == nil:
+		c.Status(http.StatusNoContent)
+	default:
+		c.JSON(http.StatusOK, drift)
+	}
+}
+
+// listDriftHandler lists the last observation of every worker, drifted=true
+// keeps the workers which drifted
+func (s *Server) listDriftHandler(c *gin.Context) {
+	list, err := s.listDrift()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := make([]*api.Drift, 0, len(list))
+	for _, drift := range list {
+		if c.Query("drifted") == "true" && !drift.Drifted {
+			continue
+		}
+		result = append(result, drift)
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+func TestDrift(t *testing.T) {
+	s := newBlobsServer(t, &fakeWorkers{})
+	s.cfg.Drift = &config.DriftConfig{Reconcile: true}
+	var b api.Blob
+	call(t, s, "POST", "/blobs", "replicas: 2\n", &b)
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"files":{"app.yaml":"`+b.Digest+`"}}`, &d)
+
+	// observe reports files and checks, drift is decoded unless nil as 204
+	// responses have no body
+	observe := func(files, checks string, drift *api.Drift) int {
+		body := `{"deployment":"` + d.ID + `","files":` + files + `,"checks":` + checks + `}`
+		if drift == nil {
+			return call(t, s, "POST", "/workers/w1/observations", body, nil)
+		}
+		return call(t, s, "POST", "/workers/w1/observations", body, drift)
+	}
+	intact := `{"app.yaml":"` + b.Digest + `","app.conf":"sha256:r1","deployment.json":"sha256:1"}`
+	if code := observe(intact, "[]", nil); code != http.StatusNoContent {
+		t.Fatalf("expected drift not to be evaluated while deploying, got %d", code)
+	}
+	s.schedule(context.Background())
+	report(t, s, d.ID, "w1", pb.ResourceState_RES_SUCCESS)
+
+	var drift api.Drift
+	// Files the worker rendered are recorded rather than drift
+	if code := observe(intact, `[{"name":"service","ok":true}]`, &drift); code != http.StatusOK || drift.Drifted {
+		t.Fatalf("expected no drift, got %d %+v", code, drift)
+	}
+	if drift.Generated["app.conf"] != "sha256:r1" || len(drift.Generated) != 1 {
+		t.Errorf("expected the rendered file to be recorded, got %v", drift.Generated)
+	}
+	if code := observe(intact, "[]", &drift); code != http.StatusOK || drift.Drifted {
+		t.Fatalf("expected no drift observing again, got %d %+v", code, drift)
+	}
+	edited := `{"app.yaml":"sha256:2","app.conf":"sha256:r2","extra.conf":"sha256:3"}`
+	code := observe(edited, `[{"name":"service","ok":false,"message":"not running"}]`, &drift)
+	if code != http.StatusOK || !drift.Drifted || len(drift.Files) != 3 || len(drift.Checks) != 1 || drift.Since == nil {
+		t.Fatalf("expected the edits and the failed check to be drift, got %d %+v", code, drift)
+	}
+	if f := drift.Files[0]; f.Path != "app.conf" || f.Kind != api.ChangeModified {
+		t.Errorf("expected the rendered file to be modified, got %+v", f)
+	}
+	if drift.Reconciliation == "" {
+		t.Fatalf("expected a reconciliation, got %+v", drift)
+	}
+	reconciliation, err := s.getDeployment(drift.Reconciliation)
+	if err != nil || len(reconciliation.Workers) != 1 || reconciliation.Files["app.yaml"] != b.Digest {
+		t.Errorf("expected the deployment to be redeployed on w1, got %+v %v", reconciliation, err)
+	}
+
+	var list []api.Drift
+	call(t, s, "GET", "/drift?drifted=true", "", &list)
+	if len(list) != 1 || list[0].Worker != "w1" {
+		t.Errorf("expected w1 to be listed as drifted, got %+v", list)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `deployer_drifted{worker="w1",target="web",env=""} 1`) {
+		t.Errorf("expected the drift gauge, got:\n%s", w.Body)
+	}
+
+	// While the reconciliation runs drift is not evaluated, it is not
+	// reconciled twice
+	if code := observe(edited, "[]", nil); code != http.StatusNoContent {
+		t.Errorf("expected drift not to be evaluated while reconciling, got %d", code)
+	}
+	if code := call(t, s, "POST", "/workers/nope/observations", `{"deployment":"`+d.ID+`"}`, nil); code != http.StatusNotFound {
+		t.Errorf("expected unknown workers to be refused, got %d", code)
+	}
+	if code := call(t, s, "POST", "/workers/w2/observations", `{"deployment":"`+d.ID+`"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected workers not in the deployment to be refused, got %d", code)
+	}
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	"github.com/beacon/deployer/pkg/cron"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindFreezes = "freezes"
+
+// Sources of freezes
+const (
+	freezeFromConfig = "config"
+	freezeFromAPI    = "api"
+)
+
+func freezeFromConfigFile(fc *config.FreezeConfig) *api.Freeze {
+	f := &api.Freeze{
+		Name:     fc.Name,
+		Envs:     fc.Envs,
+		Mode:     fc.Mode,
+		Reason:   fc.Reason,
+		Start:    fc.Start,
+		End:      fc.End,
+		Cron:     fc.Cron,
+		Timezone: fc.Timezone,
+		Source:   freezeFromConfig,
+	}
+	if fc.Duration > 0 {
+		f.Duration = time.Duration(fc.Duration).String()
+	}
+	return f
+}
+
+// validateFreeze checks a freeze defined through the API
+func validateFreeze(f *api.Freeze) error {
+	switch f.Mode {
+	case "", api.FreezeHold, api.FreezeRefuse:
+	default:
+		return fmt.Errorf("unknown freeze mode %s", f.Mode)
+	}
+	if f.Cron == "" {
+		if f.Start == nil || f.End == nil {
+			return fmt.Errorf("either start and end, or cron and duration are required")
+		}
+		if !f.End.After(*f.Start) {
+			return fmt.Errorf("end must be after start")
+		}
+		return nil
+	}
+	if f.Start != nil || f.End != nil {
+		return fmt.Errorf("start and end cannot be combined with cron")
+	}
+	if _, err := cron.Parse(f.Cron); err != nil {
+		return err
+	}
+	if d, err := time.ParseDuration(f.Duration); err != nil || d <= 0 {
+		return fmt.Errorf("invalid duration %q", f.Duration)
+	}
+	if _, err := time.LoadLocation(f.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", f.Timezone)
+	}
+	return nil
+}
+
+// window returns whether f is in effect at t, until when if so, and when it
+// starts next otherwise
+func window(f *api.Freeze, t time.Time) (active bool, until, next time.Time) {
+	if f.Cron == "" {
+		if f.Start == nil || f.End == nil {
+			return false, until, next
+		}
+		if !t.Before(*f.Start) && t.Before(*f.End) {
+			return true, *f.End, next
+		}
+		if t.Before(*f.Start) {
+			next = *f.Start
+		}
+		return false, until, next
+	}
+	sched, err := cron.Parse(f.Cron)
+	if err != nil {
+		return false, until, next
+	}
+	duration, err := time.ParseDuration(f.Duration)
+	if err != nil {
+		return false, until, next
+	}
+	loc, err := time.LoadLocation(f.Timezone)
+	if err != nil {
+		return false, until, next
+	}
+	// The latest start in (t-duration, t] is the window t falls in
+	var start time.Time
+	for s := sched.Next(t.Add(-duration).In(loc)); !s.IsZero() && !s.After(t); s = sched.Next(s) {
+		start = s
+	}
+	if !start.IsZero() {
+		return true, start.Add(duration), next
+	}
+	return false, until, sched.Next(t.In(loc))
+}
+
+func freezesEnv(f *api.Freeze, env string) bool {
+	if len(f.Envs) == 0 {
+		return true
+	}
+	for _, e := range f.Envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// listFreezes returns freezes from the config followed by the ones created
+// through the API
+func (s *Server) listFreezes() ([]*api.Freeze, error) {
+	var freezes []*api.Freeze
+	cfg := s.config()
+	for i := range cfg.Freezes {
+		freezes = append(freezes, freezeFromConfigFile(&cfg.Freezes[i]))
+	}
+	names, err := s.store.List(kindFreezes)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		f := &api.Freeze{}
+		if err := s.store.Get(kindFreezes, name, f); err == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		freezes = append(freezes, f)
+	}
+	return freezes, nil
+}
+
+// activeFreezes returns the freezes of env in effect at t, with the time the
+// last of them ends
+func (s *Server) activeFreezes(env string, t time.Time) ([]*api.Freeze, time.Time, error) {
+	freezes, err := s.listFreezes()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var active []*api.Freeze
+	var end time.Time
+	for _, f := range freezes {
+		if !freezesEnv(f, env) {
+			continue
+		}
+		if ok, until, _ := window(f, t); ok {
+			active = append(active, f)
+			if until.After(end) {
+				end = until
+			}
+		}
+	}
+	return active, end, nil
+}
+
+func freezeNames(freezes []*api.Freeze) []string {
+	names := make([]string, len(freezes))
+	for i, f := range freezes {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// checkFreezes refuses deployments to env during refusing freezes, an
+// override records the freezes it bypasses
+func (s *Server) checkFreezes(env string, override *api.FreezeOverride) error {
+	if override != nil {
+		// The server tells which freezes are overridden, names sent along
+		// would let the override bypass freezes to come
+		override.Freezes = nil
+	}
+	active, end, err := s.activeFreezes(env, time.Now())
+	if err != nil || len(active) == 0 {
+		return err
+	}
+	if override != nil {
+		override.Freezes = freezeNames(active)
+		return nil
+	}
+	for _, f := range active {
+		if f.Mode == api.FreezeRefuse {
+			return errConflict{fmt.Sprintf("%s is frozen by %s until %s, an override is required",
+				envName(env), f.Name, end.Format(time.RFC3339))}
+		}
+	}
+	return nil
+}
+
+// overridden reports whether the override of d was given for freeze f, an
+// override only bypasses the freezes in effect when it was given
+func overridden(d *api.Deployment, f *api.Freeze) bool {
+	if d.FreezeOverride == nil {
+		return false
+	}
+	for _, name := range d.FreezeOverride.Freezes {
+		if name == f.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// holdFrozen keeps a pending deployment waiting while its environment is
+// frozen, it reports whether the deployment is held
+func (s *Server) holdFrozen(d *api.Deployment) bool {
+	frozen, _, err := s.activeFreezes(d.Env, time.Now())
+	if err != nil {
+		log.Println("Failed to check freezes of deployment", d.ID, ":", err)
+		return true
+	}
+	var active []*api.Freeze
+	var end time.Time
+	for _, f := range frozen {
+		if overridden(d, f) {
+			continue
+		}
+		active = append(active, f)
+		if _, until, _ := window(f, time.Now()); until.After(end) {
+			end = until
+		}
+	}
+	if len(active) == 0 {
+		if strings.HasPrefix(d.Message, heldPrefix) {
+			s.updateDeployment(d.ID, func(d *api.Deployment) error {
+				d.Message = ""
+				return nil
+			})
+			s.logf(d.ID, "released, %s is no longer frozen", envName(d.Env))
+		}
+		return false
+	}
+	message := fmt.Sprintf("%s %s until %s", heldPrefix, strings.Join(freezeNames(active), ", "), end.Format(time.RFC3339))
+	if d.Message != message {
+		s.updateDeployment(d.ID, func(d *api.Deployment) error {
+			d.Message = message
+			return nil
+		})
+		s.logf(d.ID, "%s", message)
+	}
+	return true
+}
+
+const heldPrefix = "held by freeze"
+
+func envName(env string) string {
+	if env == "" {
+		return "the default environment"
+	}
+	return "environment " + env
+}
+
+func (s *Server) listFreezesHandler(c *gin.Context) {
+	freezes, err := s.listFreezes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	for _, f := range freezes {
+		active, until, next := window(f, now)
+		f.Active = active
+		if active {
+			f.Until = &until
+		}
+		if !next.IsZero() {
+			f.Next = &next
+		}
+	}
+	sort.SliceStable(freezes, func(i, j int) bool {
+		return freezes[i].Active && !freezes[j].Active
+	})
+	c.JSON(http.StatusOK, freezes)
+}
+
+func (s *Server) postFreezeHandler(c *gin.Context) {
+	var f api.Freeze
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateFreeze(&f); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f.Source = freezeFromAPI
+	f.CreatedBy = caller(c)
+	f.Active, f.Until, f.Next = false, nil, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	freezes, err := s.listFreezes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, existing := range freezes {
+		if existing.Name == f.Name {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("freeze %s already exists", f.Name)})
+			return
+		}
+	}
+	if err := s.store.Put(kindFreezes, f.Name, &f); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(f.CreatedBy, auditFreeze, "freeze "+f.Name, f.Reason)
+	c.JSON(http.StatusCreated, f)
+}
+
+func (s *Server) deleteFreezeHandler(c *gin.Context) {
+	name := c.Param("name")
+	for _, fc := range s.config().Freezes {
+		if fc.Name == name {
+			c.JSON(http.StatusConflict, gin.H{"error": "freeze is defined in the config file"})
+			return
+		}
+	}
+	if err := s.store.Get(kindFreezes, name, &api.Freeze{}); err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "freeze not found"})
+		return
+	}
+	if err := s.store.Delete(kindFreezes, name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(caller(c), auditUnfreeze, "freeze "+name, "")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+)
+
+func TestFreezeWindow(t *testing.T) {
+	// Friday evening to Monday morning
+	f := &api.Freeze{Name: "weekend", Cron: "0 17 * * fri", Duration: "63h"}
+	friday := time.Date(2020, 5, 15, 18, 0, 0, 0, time.UTC)
+	active, until, _ := window(f, friday)
+	if !active || !until.Equal(time.Date(2020, 5, 18, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected weekend freeze until Monday 8:00, got %v %s", active, until)
+	}
+	active, _, next := window(f, friday.Add(-24*time.Hour))
+	if active || !next.Equal(time.Date(2020, 5, 15, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected freeze to start on Friday 17:00, got %v %s", active, next)
+	}
+
+	start, end := friday, friday.Add(time.Hour)
+	holiday := &api.Freeze{Name: "holiday", Start: &start, End: &end}
+	if active, _, _ := window(holiday, end); active {
+		t.Error("expected freeze to end at its end time")
+	}
+}
+
+func TestFreezeRefuse(t *testing.T) {
+	s := New(&config.Config{})
+	start := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	freeze := `{"name":"release","envs":["prod"],"mode":"refuse","start":"` + start + `","end":"` + end + `"}`
+	if code := call(t, s, "POST", "/freezes", freeze, nil); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := call(t, s, "POST", "/freezes", freeze, nil); code != http.StatusConflict {
+		t.Errorf("expected duplicate freeze to conflict, got %d", code)
+	}
+
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"]}`, nil); code != http.StatusConflict {
+		t.Errorf("expected frozen deployment to be refused, got %d", code)
+	}
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"staging","workers":["w1"]}`, nil); code != http.StatusCreated {
+		t.Errorf("expected other environments not to be frozen, got %d", code)
+	}
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"],"freezeOverride":{}}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected override without reason to be rejected, got %d", code)
+	}
+	var d api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"],"freezeOverride":{"by":"alice","reason":"hotfix"}}`, &d); code != http.StatusCreated {
+		t.Fatalf("expected override to be accepted, got %d", code)
+	}
+	if o := d.FreezeOverride; o == nil || o.By != "alice" || len(o.Freezes) != 1 || o.Freezes[0] != "release" {
+		t.Errorf("expected override to be recorded, got %+v", o)
+	}
+
+	if code := call(t, s, "DELETE", "/freezes/release", "", nil); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"]}`, nil); code != http.StatusCreated {
+		t.Errorf("expected deployment after the freeze to be accepted, got %d", code)
+	}
+}
+
+func TestFreezeHold(t *testing.T) {
+	workers := &fakeWorkers{}
+	s := newTestServer(t, config.RecoveryRequeue, workers, "w1")
+	start := time.Now().Add(-time.Hour)
+	end := time.Now().Add(time.Hour)
+	s.cfg.Freezes = []config.FreezeConfig{{Name: "release", Start: &start, End: &end}}
+
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"]}`, &d)
+	s.schedule(context.Background())
+	held, _ := s.getDeployment(d.ID)
+	if held.State != api.DeploymentPending || !strings.HasPrefix(held.Message, heldPrefix) {
+		t.Fatalf("expected deployment to be held, got %s %q", held.State, held.Message)
+	}
+
+	s.cfg.Freezes = nil
+	s.schedule(context.Background())
+	released, _ := s.getDeployment(d.ID)
+	if released.State != api.DeploymentRunning || released.Message != "" {
+		t.Errorf("expected deployment to be dispatched after the freeze, got %s %q", released.State, released.Message)
+	}
+
+	// An override bypasses the freezes it was given for, not later ones
+	s.cfg.Freezes = []config.FreezeConfig{{Name: "release", Start: &start, End: &end}}
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"freezeOverride":{"by":"alice","reason":"hotfix"}}`, &d)
+	s.cfg.Freezes = append(s.cfg.Freezes, config.FreezeConfig{Name: "incident", Start: &start, End: &end})
+	s.schedule(context.Background())
+	held, _ = s.getDeployment(d.ID)
+	if held.State != api.DeploymentPending || held.Message != heldPrefix+" incident until "+end.Format(time.RFC3339) {
+		t.Errorf("expected overridden deployment to be held by the later freeze, got %s %q", held.State, held.Message)
+	}
+
+	// Freezes named by the client are not overridden, only the ones the
+	// server found in effect
+	s.cfg.Freezes = nil
+	var early api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"api","workers":["w1"],"freezeOverride":{"by":"alice","reason":"hotfix","freezes":["incident"]}}`, &early)
+	if early.FreezeOverride == nil || len(early.FreezeOverride.Freezes) != 0 {
+		t.Fatalf("expected the freezes sent to be dropped, got %+v", early.FreezeOverride)
+	}
+	s.cfg.Freezes = []config.FreezeConfig{{Name: "incident", Start: &start, End: &end}}
+	s.schedule(context.Background())
+	if held, _ = s.getDeployment(early.ID); held.State != api.DeploymentPending {
+		t.Errorf("expected the deployment to be held by the freeze started since, got %s %q", held.State, held.Message)
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/spec"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+// maxHookOutput bounds the output of a hook kept on its deployment, workers
+// send their last lines only already
+const maxHookOutput = 64 << 10
+
+// environmentHooks are the hooks every deployment to env runs
+func (s *Server) environmentHooks(env string) *api.Hooks {
+	for _, e := range s.config().Environments {
+		if e.Name == env {
+			return e.Hooks
+		}
+	}
+	return nil
+}
+
+// deploymentHooks are the hooks of the environment of d around the ones of
+// its spec
+func (s *Server) deploymentHooks(d *api.Deployment) *api.Hooks {
+	var inner *api.Hooks
+	if d.Spec != nil {
+		inner = d.Spec.Hooks
+	}
+	return spec.MergeHooks(s.environmentHooks(d.Env), inner)
+}
+
+// hasHook tells whether d runs a hook with that name in phase
+func hasHook(d *api.Deployment, phase, name string) bool {
+	for _, p := range spec.Phases(d.Hooks) {
+		if p.Name != phase {
+			continue
+		}
+		for _, hook := range p.Hooks {
+			if hook.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keepHooks carries the hooks of a worker over to the resources it reported,
+// workers report them apart. Once a worker reported a hook, the ones it did
+// not yet are pending but the on-failure ones, which only run when something
+// else failed. Workers which never reported one do not run hooks, nothing
+// waits for them.
+func keepHooks(d *api.Deployment, worker string, reported map[string]pb.ResourceState) {
+	runsHooks := false
+	for k := range reported {
+		runsHooks = runsHooks || spec.IsHookResource(k)
+	}
+	for k, v := range d.Resources[worker] {
+		if !spec.IsHookResource(k) {
+			continue
+		}
+		runsHooks = true
+		if _, ok := reported[k]; !ok {
+			reported[k] = v
+		}
+	}
+	if !runsHooks {
+		return
+	}
+	for _, phase := range spec.Phases(d.Hooks) {
+		if phase.Name == api.HookOnFailure {
+			continue
+		}
+		for _, hook := range phase.Hooks {
+			if _, ok := reported[spec.HookResource(phase.Name, hook.Name)]; !ok {
+				reported[spec.HookResource(phase.Name, hook.Name)] = pb.ResourceState_RES_PENDING
+			}
+		}
+	}
+}
+
+// recordHook keeps the result of a hook on its deployment, replacing an
+// earlier one, and derives the deployment state unless it ended
+func recordHook(d *api.Deployment, result *api.HookResult) {
+	replaced := false
+	for i, r := range d.HookResults {
+		if r.Worker == result.Worker && r.Phase == result.Phase && r.Name == result.Name {
+			d.HookResults[i] = *result
+			replaced = true
+		}
+	}
+	if !replaced {
+		d.HookResults = append(d.HookResults, *result)
+	}
+	if d.State.Terminal() {
+		return
+	}
+	if d.Resources == nil {
+		d.Resources = make(map[string]map[string]pb.ResourceState)
+	}
+	resources := make(map[string]pb.ResourceState, len(d.Resources[result.Worker])+1)
+	for k, v := range d.Resources[result.Worker] {
+		resources[k] = v
+	}
+	resources[spec.HookResource(result.Phase, result.Name)] = result.State
+	keepHooks(d, result.Worker, resources)
+	d.Resources[result.Worker] = resources
+	evaluate(d)
+}
+
+// postHookHandler takes the result of a hook a worker ran, its output is
+// masked like logs are
+func (s *Server) postHookHandler(c *gin.Context) {
+	var result api.HookResult
+	if err := c.ShouldBindJSON(&result); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	masker, err := s.masker()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "secrets cannot be masked: " + err.Error()})
+		return
+	}
+	result.Message = masker.Mask(result.Message)
+	// Masking first, cutting the output could leave part of a secret
+	result.Output = masker.Mask(result.Output)
+	if len(result.Output) > maxHookOutput {
+		result.Output = result.Output[len(result.Output)-maxHookOutput:]
+	}
+	d, err := s.getDeployment(c.Param("id"))
+	if err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !hasWorker(d, result.Worker) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("deployment %s does not run on %s", d.ID, result.Worker)})
+		return
+	}
+	if !hasHook(d, result.Phase, result.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("deployment %s has no %s hook %s", d.ID, result.Phase, result.Name)})
+		return
+	}
+	if _, err := s.updateDeployment(d.ID, func(d *api.Deployment) error {
+		recordHook(d, &result)
+		return nil
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.Message != "" {
+		s.logf(d.ID, "worker %s %s hook %s %s", result.Worker, result.Phase, result.Name, result.Message)
+	} else {
+		s.logf(d.ID, "worker %s %s hook %s ended %s", result.Worker, result.Phase, result.Name, result.State)
+	}
+	c.JSON(http.StatusOK, result)
+}
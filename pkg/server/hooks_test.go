@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+func TestHooks(t *testing.T) {
+	s := newRolloutServer(t, &fakeWorkers{})
+	s.cfg.Environments = []config.EnvironmentConfig{{
+		Name:  "prod",
+		Hooks: &api.Hooks{PreDeploy: []api.Step{{Name: "snapshot", Executor: "exec"}}},
+	}}
+	hooks := `{"hooks":{"postDeploy":[{"name":"notes","executor":"exec"}]}}`
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"],"spec":`+hooks+`}`, &d)
+	if d.Hooks == nil || len(d.Hooks.PreDeploy) != 1 || len(d.Hooks.PostDeploy) != 1 {
+		t.Fatalf("expected the hooks of the environment and the spec, got %+v", d.Hooks)
+	}
+	s.schedule(context.Background())
+
+	hook := func(phase, name string, state string) int {
+		return call(t, s, "POST", "/deployments/"+d.ID+"/hooks",
+			`{"worker":"w1","phase":"`+phase+`","name":"`+name+`","state":"`+state+`","attempts":1,"output":"done\n"}`, nil)
+	}
+	if code := hook(api.HookPreDeploy, "snapshot", "RES_SUCCESS"); code != http.StatusOK {
+		t.Fatalf("expected the hook result to be recorded, got %d", code)
+	}
+	report(t, s, d.ID, "w1", pb.ResourceState_RES_SUCCESS)
+	got, _ := s.getDeployment(d.ID)
+	if got.State != api.DeploymentRunning || got.Resources["w1"]["hook:postDeploy:notes"] != pb.ResourceState_RES_PENDING {
+		t.Fatalf("expected the deployment to wait for its post-deploy hook, got %s %v", got.State, got.Resources)
+	}
+	hook(api.HookPostDeploy, "notes", "RES_SUCCESS")
+	got, _ = s.getDeployment(d.ID)
+	if got.State != api.DeploymentSucceeded || len(got.HookResults) != 2 || got.HookResults[0].Output != "done\n" {
+		t.Errorf("expected the deployment to succeed with its hook results, got %s %+v", got.State, got.HookResults)
+	}
+
+	if code := hook(api.HookPreDeploy, "nope", "RES_SUCCESS"); code != http.StatusBadRequest {
+		t.Errorf("expected unknown hooks to be refused, got %d", code)
+	}
+	if code := call(t, s, "POST", "/deployments/"+d.ID+"/hooks", `{"worker":"w2","phase":"preDeploy","name":"snapshot"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected workers not in the deployment to be refused, got %d", code)
+	}
+
+	// Workers which report no hooks do not run them, nothing waits for them
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"],"spec":`+hooks+`}`, &d)
+	s.schedule(context.Background())
+	report(t, s, d.ID, "w1", pb.ResourceState_RES_SUCCESS)
+	if got, _ = s.getDeployment(d.ID); got.State != api.DeploymentSucceeded {
+		t.Errorf("expected a worker reporting no hooks to succeed, got %s %v", got.State, got.Resources)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindSubmissions = "submissions"
+
+// idempotencyHeader carries a key clients pick for an action, retrying the
+// action with the same key returns the deployment created the first time
+const idempotencyHeader = "Idempotency-Key"
+
+// replayedHeader marks responses returning the deployment of an earlier
+// submission
+const replayedHeader = "Idempotent-Replayed"
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	// maxIdempotencyKey bounds the length of keys
+	maxIdempotencyKey = 255
+	// keyPruneInterval is how often the scheduler removes expired keys
+	keyPruneInterval = 10 * time.Minute
+)
+
+var errKeyReused = errors.New("the idempotency key was already used for a different action")
+
+// submission records the action submitted with an idempotency key and the
+// deployment it created
+type submission struct {
+	Digest     string    `json:"digest"`
+	Deployment string    `json:"deployment"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// submissionKey stores the key of a caller, callers do not share keys
+func submissionKey(caller, key string) string {
+	sum := sha256.Sum256([]byte(caller + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// actionDigest tells actions apart however their JSON was formatted
+func actionDigest(action *api.Action) string {
+	raw, _ := json.Marshal(action)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) idempotencyTTL() time.Duration {
+	if ttl := time.Duration(s.config().IdempotencyKeyTTL); ttl > 0 {
+		return ttl
+	}
+	return defaultIdempotencyTTL
+}
+
+// replay returns the deployment an unexpired submission under key created,
+// nil if there is none. It fails with errKeyReused when the submission was
+// for another action. s.keyMu must be held.
+func (s *Server) replay(key, digest string, now time.Time) (*api.Deployment, error) {
+	sub := &submission{}
+	if err := s.store.Get(kindSubmissions, key, sub); err == store.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if now.Sub(sub.CreatedAt) >= s.idempotencyTTL() {
+		return nil, nil
+	}
+	if sub.Digest != digest {
+		return nil, errKeyReused
+	}
+	d, err := s.getDeployment(sub.Deployment)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	return d, err
+}
+
+// remember records that the action with digest created d under key, s.keyMu
+// must be held
+func (s *Server) remember(key, digest string, d *api.Deployment) {
+	sub := &submission{Digest: digest, Deployment: d.ID, CreatedAt: d.CreatedAt}
+	if err := s.store.Put(kindSubmissions, key, sub); err != nil {
+		// The deployment exists, a retry would only create another one
+		log.Println("Failed to record the idempotency key of deployment", d.ID, ":", err)
+	}
+}
+
+// maybePruneKeys removes expired idempotency keys from the scheduler once
+// every keyPruneInterval
+func (s *Server) maybePruneKeys(now time.Time) {
+	if now.Sub(s.lastKeyPrune) < keyPruneInterval {
+		return
+	}
+	s.lastKeyPrune = now
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+	keys, err := s.store.List(kindSubmissions)
+	if err != nil {
+		log.Println("Failed to list idempotency keys:", err)
+		return
+	}
+	for _, key := range keys {
+		sub := &submission{}
+		if err := s.store.Get(kindSubmissions, key, sub); err != nil {
+			continue
+		}
+		if now.Sub(sub.CreatedAt) < s.idempotencyTTL() {
+			continue
+		}
+		if err := s.store.Delete(kindSubmissions, key); err != nil {
+			log.Println("Failed to remove expired idempotency key:", err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+)
+
+// submit posts an action under an idempotency key
+func submit(t *testing.T, s *Server, key, body string, out *api.Deployment) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/actions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyHeader, key)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if out != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("failed to decode %s: %v", w.Body, err)
+		}
+	}
+	return w
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	s := New(&config.Config{IdempotencyKeyTTL: config.Duration(time.Hour)})
+	action := `{"action":"deploy","target":"web","env":"prod","workers":["w1"]}`
+	var first, retried api.Deployment
+	if w := submit(t, s, "ci-42", action, &first); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	// Formatted differently, the action is the same
+	w := submit(t, s, "ci-42", `{"target":"web", "action":"deploy","workers":["w1"],"env":"prod"}`, &retried)
+	if w.Code != http.StatusCreated || retried.ID != first.ID || w.Header().Get(replayedHeader) != "true" {
+		t.Errorf("expected retry to return deployment %s, got %d %s", first.ID, w.Code, retried.ID)
+	}
+	if w := submit(t, s, "ci-42", `{"action":"deploy","target":"web","env":"prod","workers":["w2"]}`, nil); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected key reused for another action to be rejected, got %d", w.Code)
+	}
+	var other api.Deployment
+	submit(t, s, "ci-43", action, &other)
+	if other.ID == "" || other.ID == first.ID {
+		t.Errorf("expected another key to create another deployment, got %s", other.ID)
+	}
+	var deployments []api.Deployment
+	call(t, s, "GET", "/deployments", "", &deployments)
+	if len(deployments) != 2 {
+		t.Errorf("expected 2 deployments, got %d", len(deployments))
+	}
+
+	// Once expired the key is forgotten
+	s.maybePruneKeys(time.Now().Add(2 * time.Hour))
+	if keys, _ := s.store.List(kindSubmissions); len(keys) != 0 {
+		t.Errorf("expected expired keys to be removed, got %d", len(keys))
+	}
+	var again api.Deployment
+	submit(t, s, "ci-42", action, &again)
+	if again.ID == "" || again.ID == first.ID {
+		t.Errorf("expected expired key to create another deployment, got %s", again.ID)
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+// leaderLease is held by the replica running the scheduler
+const leaderLease = "leader"
+
+const defaultLeaseTTL = 10 * time.Second
+
+// forwardedHeader marks requests forwarded to the leader, so that they are
+// never forwarded twice while leadership changes hands
+const forwardedHeader = "X-Deployer-Forwarded"
+
+// leadership is what a replica knows about the leader lease
+type leadership struct {
+	mu    sync.RWMutex
+	lease store.Lease
+	// until is when this replica stops acting as leader unless it renews,
+	// it comes well before the lease expires for other replicas
+	until time.Time
+}
+
+func (l *leadership) set(lease store.Lease, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lease = lease
+	l.until = until
+}
+
+func (l *leadership) get() (store.Lease, time.Time) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lease, l.until
+}
+
+func replicaID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "deployer"
+	}
+	return host + "-" + newID()[:6]
+}
+
+func (s *Server) leaseTTL() time.Duration {
+	if ttl := time.Duration(s.config().HA.LeaseTTL); ttl > 0 {
+		return ttl
+	}
+	return defaultLeaseTTL
+}
+
+// isLeader reports whether this replica may run the scheduler and accept
+// writes, a server without HA is always its own leader
+func (s *Server) isLeader() bool {
+	if s.config().HA == nil {
+		return true
+	}
+	lease, until := s.leader.get()
+	return lease.Holder == s.id && time.Now().Before(until)
+}
+
+// runElection keeps trying to take or renew the leader lease, and runs
+// recovery and the scheduler for as long as it is held
+func (s *Server) runElection(ctx context.Context) {
+	ttl := s.leaseTTL()
+	var cancelLead context.CancelFunc
+	var leading sync.WaitGroup
+	stopLeading := func() {
+		if cancelLead != nil {
+			cancelLead()
+			leading.Wait()
+			cancelLead = nil
+		}
+	}
+	defer func() {
+		stopLeading()
+		s.leader.set(store.Lease{}, time.Time{})
+		if err := s.store.Release(leaderLease, s.id); err != nil {
+			log.Println("Failed to release leader lease:", err)
+		}
+	}()
+
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		lease, err := s.store.Acquire(leaderLease, store.Lease{
+			Holder:  s.id,
+			Addr:    s.config().HA.AdvertiseAddr,
+			Expires: now.Add(ttl),
+		})
+		if err != nil {
+			log.Println("Failed to acquire leader lease:", err)
+		} else {
+			s.leader.set(lease, now.Add(ttl*2/3))
+		}
+
+		leader := s.isLeader()
+		if leader && cancelLead == nil {
+			log.Println("Replica", s.id, "became leader")
+			leadCtx, cancel := context.WithCancel(ctx)
+			cancelLead = cancel
+			leading.Add(1)
+			go func() {
+				defer leading.Done()
+				s.recoverDeployments(leadCtx)
+				s.runScheduler(leadCtx)
+			}()
+		} else if !leader && cancelLead != nil {
+			log.Println("Replica", s.id, "lost leadership")
+			stopLeading()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) getLeaderHandler(c *gin.Context) {
+	lease, _ := s.leader.get()
+	c.JSON(http.StatusOK, gin.H{
+		"replica": s.id,
+		"leader":  s.isLeader(),
+		"lease":   lease,
+	})
+}
+
+// forwardWrites proxies requests changing state to the leader
+func (s *Server) forwardWrites(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if s.isLeader() {
+		c.Next()
+		return
+	}
+	lease, _ := s.leader.get()
+	if lease.Addr == "" || lease.Holder == s.id || c.GetHeader(forwardedHeader) != "" {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "no leader available"})
+		return
+	}
+	target := &url.URL{Scheme: "http", Host: lease.Addr}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	if tlsCfg := s.config().TLS; tlsCfg != nil {
+		target.Scheme = "https"
+		transport, err := newTLSTransport(tlsCfg)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		proxy.Transport = transport
+	}
+	c.Request.Header.Set(forwardedHeader, s.id)
+	proxy.ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+}
+
+// forwardStatus hands a status update over to the leader
+func (s *Server) forwardStatus(ctx context.Context, status *pb.DeployStatus) (*pb.Reply, error) {
+	lease, _ := s.leader.get()
+	md, _ := metadata.FromIncomingContext(ctx)
+	if lease.Addr == "" || lease.Holder == s.id || len(md.Get(forwardedHeader)) > 0 {
+		return &pb.Reply{
+			Code:    503,
+			Message: "no leader available",
+		}, nil
+	}
+	conn, err := dial(ctx, s.config().TLS, lease.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach leader %s:%v", lease.Holder, err)
+	}
+	defer conn.Close()
+	ctx = metadata.AppendToOutgoingContext(ctx, forwardedHeader, s.id)
+	if auth := md.Get("authorization"); len(auth) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", auth[0])
+	}
+	return pb.NewServerClient(conn).UpdateDeployStatus(ctx, status)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+// newReplica starts a server sharing st with other replicas, reachable
+// through a test listener which speaks both REST and h2c grpc
+func newReplica(t *testing.T, id string, st store.Store, workers WorkerClient) *Server {
+	var s *Server
+	ts := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.ServeHTTP(w, r)
+	}), &http2.Server{}))
+	t.Cleanup(ts.Close)
+	cfg := &config.Config{
+		Addr: ":0",
+		HA: &config.HAConfig{
+			ID:            id,
+			AdvertiseAddr: ts.Listener.Addr().String(),
+			LeaseTTL:      config.Duration(300 * time.Millisecond),
+		},
+	}
+	s = New(cfg, WithStore(st), WithWorkerClient(workers))
+	s.start()
+	return s
+}
+
+// waitLeader waits for exactly one of the replicas to lead
+func waitLeader(t *testing.T, replicas ...*Server) *Server {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		var leaders []*Server
+		for _, s := range replicas {
+			if s.isLeader() {
+				leaders = append(leaders, s)
+			}
+		}
+		if len(leaders) > 1 {
+			t.Fatalf("%d replicas lead at once", len(leaders))
+		}
+		if len(leaders) == 1 {
+			return leaders[0]
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("no replica became leader")
+	return nil
+}
+
+func TestLeaderElection(t *testing.T) {
+	st := store.NewMemory()
+	st.Put(kindWorkers, "w1", &api.Worker{Name: "w1", Addr: "w1:9001"})
+	workers := &fakeWorkers{}
+	a := newReplica(t, "a", st, workers)
+	b := newReplica(t, "b", st, workers)
+	c := newReplica(t, "c", st, workers)
+
+	leader := waitLeader(t, a, b, c)
+	var follower *Server
+	for _, s := range []*Server{a, b, c} {
+		if s != leader {
+			follower = s
+			break
+		}
+	}
+
+	// Writes sent to a follower end up on the leader
+	resp, err := http.Post("http://"+follower.cfg.HA.AdvertiseAddr+"/actions", "application/json",
+		strings.NewReader(`{"action":"deploy","target":"web","workers":["w1"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected deployment to be created through the leader, got %d", resp.StatusCode)
+	}
+	deployments, _ := follower.listDeployments()
+	if len(deployments) != 1 {
+		t.Fatalf("expected one deployment, got %d", len(deployments))
+	}
+	id := deployments[0].ID
+
+	// Every replica ticks a few times, only the leader dispatches
+	time.Sleep(2 * scheduleInterval)
+	workers.mu.Lock()
+	sent := len(workers.sent)
+	workers.mu.Unlock()
+	if sent != 1 {
+		t.Fatalf("expected deployment to be dispatched once, got %d", sent)
+	}
+
+	reply, err := follower.UpdateDeployStatus(context.Background(), &pb.DeployStatus{
+		Id:        id,
+		Worker:    "w1",
+		Resources: map[string]pb.ResourceState{"app": pb.ResourceState_RES_SUCCESS},
+	})
+	if err != nil || reply.Code != 200 {
+		t.Fatalf("expected status forwarded to the leader, got %v, %v", reply, err)
+	}
+	if d, _ := follower.getDeployment(id); d.State != api.DeploymentSucceeded {
+		t.Errorf("expected deployment to succeed, got %s", d.State)
+	}
+
+	// Another replica takes over once the leader is gone
+	leader.Shutdown()
+	var rest []*Server
+	for _, s := range []*Server{a, b, c} {
+		if s != leader {
+			rest = append(rest, s)
+		}
+	}
+	start := time.Now()
+	next := waitLeader(t, rest...)
+	if next == leader {
+		t.Fatal("stopped replica should not lead")
+	}
+	t.Logf("replica %s took over after %s", next.id, time.Since(start))
+	for _, s := range rest {
+		s.Shutdown()
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/beacon/deployer/pkg/config"
+)
+
+// maxBuckets triggers pruning of idle identities
+const maxBuckets = 10000
+
+// rateLimiter keeps a token bucket per identity
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow reports whether identity may issue one more request now
+func (l *rateLimiter) Allow(identity string) bool {
+	if l == nil || l.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[identity]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[identity] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drops buckets which would have refilled by now, l.mu must be held
+func (l *rateLimiter) prune(now time.Time) {
+	idle := time.Duration(l.burst / l.rate * float64(time.Second))
+	for id, b := range l.buckets {
+		if now.Sub(b.last) > idle {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// identity of a client is the name of its token when the token is one of
+// auth, or its address otherwise. Unknown tokens are not trusted, so that
+// clients cannot get a fresh bucket by sending a new token every request.
+func identity(auth *config.AuthConfig, authorization, addr string) string {
+	if auth != nil {
+		if name, ok := authenticate(auth, authorization); ok {
+			return "token:" + name
+		}
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return "addr:" + host
+	}
+	return "addr:" + addr
+}
+
+// restfulLimits runs before auth so that unauthorized requests are limited
+// too, auth returns the tokens in effect
+func restfulLimits(limits *config.LimitsConfig, limiter *rateLimiter, auth func() *config.AuthConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limiter.Allow(identity(auth(), c.GetHeader("Authorization"), c.Request.RemoteAddr)) {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		var max int64
+		if limits != nil {
+			max = limits.MaxBodyBytes
+			if strings.HasPrefix(c.FullPath(), "/blobs") {
+				max = limits.MaxBlobBytes
+			}
+		}
+		if max > 0 {
+			if c.Request.ContentLength > max {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		}
+		c.Next()
+	}
+}
+
+func restfulRecovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Panic handling %s %s: %v\n%s", c.Request.Method, c.Request.URL.Path, r, debug.Stack())
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			}
+		}()
+		c.Next()
+	}
+}
+
+func rpcIdentity(ctx context.Context, auth *config.AuthConfig) string {
+	var authorization, addr string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	return identity(auth, authorization, addr)
+}
+
+func rpcUnaryInterceptor(limiter *rateLimiter, auth func() *config.AuthConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Panic handling %s: %v\n%s", info.FullMethod, r, debug.Stack())
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+		if !limiter.Allow(rpcIdentity(ctx, auth())) {
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func rpcStreamInterceptor(limiter *rateLimiter, auth func() *config.AuthConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Panic handling %s: %v\n%s", info.FullMethod, r, debug.Stack())
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+		if !limiter.Allow(rpcIdentity(ss.Context(), auth())) {
+			return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/beacon/deployer/pkg/config"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(1, 2)
+	for i := 0; i < 2; i++ {
+		if !l.Allow("a") {
+			t.Fatalf("request %d should be allowed within burst", i)
+		}
+	}
+	if l.Allow("a") {
+		t.Fatal("request beyond burst should be limited")
+	}
+	if !l.Allow("b") {
+		t.Fatal("identities should not share buckets")
+	}
+}
+
+func TestRestfulLimits(t *testing.T) {
+	limits := &config.LimitsConfig{MaxBodyBytes: 8}
+	auth := &config.AuthConfig{Tokens: []config.TokenConfig{{Name: "a", Token: "a"}, {Name: "b", Token: "b"}, {Name: "c", Token: "c"}}}
+	r := gin.New()
+	r.Use(restfulRecovery(), restfulLimits(limits, newRateLimiter(1, 1), func() *config.AuthConfig { return auth }))
+	r.POST("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/panic", func(c *gin.Context) { panic("boom") })
+
+	do := func(path, body, token string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := do("/ok", "", "a"); code != http.StatusOK {
+		t.Errorf("expected 200, got %d", code)
+	}
+	if code := do("/ok", "", "a"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", code)
+	}
+	if code := do("/ok", "0123456789", "b"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", code)
+	}
+	if code := do("/panic", "", "c"); code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", code)
+	}
+	// Unknown tokens share the bucket of their address
+	if code := do("/ok", "", "random-1"); code != http.StatusOK {
+		t.Errorf("expected 200, got %d", code)
+	}
+	if code := do("/ok", "", "random-2"); code != http.StatusTooManyRequests {
+		t.Errorf("expected a new unknown token to be limited, got %d", code)
+	}
+}
+
+func TestRPCInterceptor(t *testing.T) {
+	noAuth := func() *config.AuthConfig { return nil }
+	intercept := rpcUnaryInterceptor(newRateLimiter(1, 1), noAuth)
+	info := &grpc.UnaryServerInfo{FullMethod: "/Server/UpdateDeployStatus"}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+	if _, err := intercept(context.Background(), nil, info, ok); err != nil {
+		t.Fatal(err)
+	}
+	_, err := intercept(context.Background(), nil, info, ok)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected RESOURCE_EXHAUSTED, got %v", err)
+	}
+
+	intercept = rpcUnaryInterceptor(nil, noAuth)
+	_, err = intercept(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("expected INTERNAL, got %v", err)
+	}
+}
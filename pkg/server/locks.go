@@ -0,0 +1,198 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindLocks = "locks"
+
+// lockKey keys the lock of env, the default environment has no name to key
+// it by
+func lockKey(env string) string {
+	if env == "" {
+		return "-"
+	}
+	return env
+}
+
+// getLock returns the lock of env, nil if it is not locked
+func (s *Server) getLock(env string) (*api.Lock, error) {
+	lock := &api.Lock{}
+	if err := s.store.Get(kindLocks, lockKey(env), lock); err == store.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (s *Server) listLocks() ([]*api.Lock, error) {
+	keys, err := s.store.List(kindLocks)
+	if err != nil {
+		return nil, err
+	}
+	locks := make([]*api.Lock, 0, len(keys))
+	for _, key := range keys {
+		lock := &api.Lock{}
+		if err := s.store.Get(kindLocks, key, lock); err == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+// checkLock refuses deployments to env while a refusing lock holds it. Only
+// the owner of the lock may override it, it returns the lock they overrode.
+func (s *Server) checkLock(env string, override *api.LockOverride) (*api.Lock, error) {
+	lock, err := s.getLock(env)
+	if err != nil || lock == nil {
+		return nil, err
+	}
+	if override != nil {
+		if override.By != lock.Owner {
+			return nil, errConflict{fmt.Sprintf("%s is locked by %s, only they may override the lock", envName(env), lock.Owner)}
+		}
+		return lock, nil
+	}
+	if lock.Mode == api.LockRefuse {
+		return nil, errConflict{fmt.Sprintf("%s is locked by %s: %s", envName(env), lock.Owner, lock.Reason)}
+	}
+	return nil, nil
+}
+
+// overrides tells whether o was given for lock, a lock taken again later,
+// even by the same owner, holds the deployment anew
+func overrides(o *api.LockOverride, lock *api.Lock) bool {
+	return o != nil && o.By == lock.Owner && o.LockedAt != nil && o.LockedAt.Equal(lock.CreatedAt)
+}
+
+const lockedPrefix = "held by lock"
+
+// holdLocked keeps a pending deployment waiting while its environment is
+// locked, it reports whether the deployment is held
+func (s *Server) holdLocked(d *api.Deployment) bool {
+	lock, err := s.getLock(d.Env)
+	if err != nil {
+		log.Println("Failed to check the lock of deployment", d.ID, ":", err)
+		return true
+	}
+	if lock == nil {
+		if strings.HasPrefix(d.Message, lockedPrefix) {
+			s.updateDeployment(d.ID, func(d *api.Deployment) error {
+				d.Message = ""
+				return nil
+			})
+			s.logf(d.ID, "released, %s is no longer locked", envName(d.Env))
+		}
+		return false
+	}
+	if overrides(d.LockOverride, lock) {
+		return false
+	}
+	message := fmt.Sprintf("%s of %s: %s", lockedPrefix, lock.Owner, lock.Reason)
+	if d.Message != message {
+		s.updateDeployment(d.ID, func(d *api.Deployment) error {
+			d.Message = message
+			return nil
+		})
+		s.logf(d.ID, "%s", message)
+	}
+	return true
+}
+
+func (s *Server) listLocksHandler(c *gin.Context) {
+	locks, err := s.listLocks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, locks)
+}
+
+func (s *Server) postLockHandler(c *gin.Context) {
+	var lock api.Lock
+	if err := c.ShouldBindJSON(&lock); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch lock.Mode {
+	case "", api.LockHold, api.LockRefuse:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown lock mode %s", lock.Mode)})
+		return
+	}
+	if s.config().Auth != nil {
+		lock.Owner = caller(c)
+	}
+	if lock.Owner == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "owner is required"})
+		return
+	}
+	lock.CreatedAt = time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.getLock(lock.Env)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is already locked by %s", envName(lock.Env), existing.Owner)})
+		return
+	}
+	if err := s.store.Put(kindLocks, lockKey(lock.Env), &lock); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(lock.Owner, auditLock, envName(lock.Env), lock.Reason)
+	c.JSON(http.StatusCreated, lock)
+}
+
+// deleteLockHandler unlocks the environment in env=, the default one if
+// empty. Others than the owner must force=true when the server
+// authenticates callers, otherwise by= names who unlocks it.
+func (s *Server) deleteLockHandler(c *gin.Context) {
+	env := c.Query("env")
+	by := caller(c)
+	if s.config().Auth == nil && c.Query("by") != "" {
+		by = c.Query("by")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, err := s.getLock(env)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if lock == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": envName(env) + " is not locked"})
+		return
+	}
+	forced := by != lock.Owner
+	if forced && s.config().Auth != nil && c.Query("force") != "true" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is locked by %s, force=true unlocks it anyway", envName(env), lock.Owner)})
+		return
+	}
+	if err := s.store.Delete(kindLocks, lockKey(env)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	detail := "locked by " + lock.Owner + ": " + lock.Reason
+	if forced {
+		detail = "forced, " + detail
+	}
+	s.audit(by, auditUnlock, envName(env), detail)
+	c.Status(http.StatusNoContent)
+}
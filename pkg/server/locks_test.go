@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+)
+
+func TestLocks(t *testing.T) {
+	s := New(&config.Config{})
+	if code := call(t, s, "POST", "/locks", `{"env":"prod","reason":"incident"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected lock without owner to be rejected, got %d", code)
+	}
+	if code := call(t, s, "POST", "/locks", `{"env":"prod","owner":"alice","reason":"incident","mode":"freeze"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected an unknown lock mode to be rejected, got %d", code)
+	}
+	var lock api.Lock
+	if code := call(t, s, "POST", "/locks", `{"env":"prod","owner":"alice","reason":"incident","mode":"refuse"}`, &lock); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := call(t, s, "POST", "/locks", `{"env":"prod","owner":"bob","reason":"release"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected locking twice to conflict, got %d", code)
+	}
+	var locks []api.Lock
+	call(t, s, "GET", "/locks", "", &locks)
+	if len(locks) != 1 || locks[0].Owner != "alice" {
+		t.Errorf("expected the lock of alice, got %+v", locks)
+	}
+
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"]}`, nil); code != http.StatusConflict {
+		t.Errorf("expected deployment to a locked environment to be refused, got %d", code)
+	}
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"staging","workers":["w1"]}`, nil); code != http.StatusCreated {
+		t.Errorf("expected other environments not to be locked, got %d", code)
+	}
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"],"lockOverride":{"by":"bob","reason":"hotfix"}}`, nil); code != http.StatusConflict {
+		t.Errorf("expected override by someone else than the owner to be refused, got %d", code)
+	}
+	var d api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"],"lockOverride":{"by":"alice","reason":"hotfix"}}`, &d); code != http.StatusCreated {
+		t.Fatalf("expected override by the owner to be accepted, got %d", code)
+	}
+	if o := d.LockOverride; o == nil || o.By != "alice" {
+		t.Errorf("expected override to be recorded, got %+v", o)
+	}
+
+	if code := call(t, s, "DELETE", "/locks?env=staging", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected unlocking an unlocked environment to fail, got %d", code)
+	}
+	if code := call(t, s, "DELETE", "/locks?env=prod&by=alice", "", nil); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"]}`, nil); code != http.StatusCreated {
+		t.Errorf("expected deployment after unlocking to be accepted, got %d", code)
+	}
+
+	var entries []api.AuditEntry
+	if code := call(t, s, "GET", "/audit", "", &entries); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Actor+" "+e.Action)
+	}
+	if got := strings.Join(actions, ", "); got != "alice lock, alice override-lock, alice unlock" {
+		t.Errorf("expected lock, override and unlock to be audited, got %s", got)
+	}
+	if code := call(t, s, "GET", "/audit?since=yesterday", "", nil); code != http.StatusBadRequest {
+		t.Errorf("expected invalid since to be rejected, got %d", code)
+	}
+	if code := call(t, s, "GET", "/audit?limit=2000000000", "", &entries); code != http.StatusOK || len(entries) != 3 {
+		t.Errorf("expected a huge limit to be capped, got %d %d entries", code, len(entries))
+	}
+}
+
+func TestLockHold(t *testing.T) {
+	workers := &fakeWorkers{}
+	s := newTestServer(t, config.RecoveryRequeue, workers, "w1")
+	call(t, s, "POST", "/locks", `{"owner":"alice","reason":"incident"}`, nil)
+
+	var d api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"]}`, &d); code != http.StatusCreated {
+		t.Fatalf("expected deployment to be queued while locked, got %d", code)
+	}
+	s.schedule(context.Background())
+	held, _ := s.getDeployment(d.ID)
+	if held.State != api.DeploymentPending || !strings.HasPrefix(held.Message, lockedPrefix) {
+		t.Fatalf("expected deployment to be held, got %s %q", held.State, held.Message)
+	}
+
+	call(t, s, "DELETE", "/locks", "", nil)
+	s.schedule(context.Background())
+	released, _ := s.getDeployment(d.ID)
+	if released.State != api.DeploymentRunning || released.Message != "" {
+		t.Errorf("expected deployment to be dispatched once unlocked, got %s %q", released.State, released.Message)
+	}
+
+	// An override holds for the lock it was given for, not for the next one
+	call(t, s, "POST", "/locks", `{"owner":"alice","reason":"incident"}`, nil)
+	var o api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"api","workers":["w1"],"lockOverride":{"by":"alice","reason":"hotfix"}}`, &o); code != http.StatusCreated {
+		t.Fatalf("expected override by the owner to be accepted, got %d", code)
+	}
+	call(t, s, "DELETE", "/locks", "", nil)
+	call(t, s, "POST", "/locks", `{"owner":"alice","reason":"another incident"}`, nil)
+	s.schedule(context.Background())
+	if held, _ = s.getDeployment(o.ID); held.State != api.DeploymentPending || !strings.HasPrefix(held.Message, lockedPrefix) {
+		t.Errorf("expected the override not to pass a later lock, got %s %q", held.State, held.Message)
+	}
+	var p api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"db","workers":["w1"],"lockOverride":{"by":"alice","reason":"hotfix"}}`, &p)
+	s.schedule(context.Background())
+	if got, _ := s.getDeployment(p.ID); got.State != api.DeploymentRunning {
+		t.Errorf("expected the override to pass the lock it was given for, got %s %q", got.State, got.Message)
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindLogs = "logs"
+
+// followInterval is how often a followed log is checked for lines written
+// by other replicas, lines appended by this one wake followers at once
+const followInterval = 2 * time.Second
+
+// deploymentLog is a stored chunk of a deployment log. Every append stores
+// a chunk of its own under logs/<id>, keyed by time, so that appending does
+// not rewrite the lines before it.
+type deploymentLog struct {
+	Entries []api.LogEntry `json:"entries"`
+}
+
+func logKind(id string) string {
+	return kindLogs + "/" + id
+}
+
+// getLog returns the whole log of a deployment
+func (s *Server) getLog(id string) ([]api.LogEntry, error) {
+	entries, _, err := s.readLog(id, "")
+	return entries, err
+}
+
+// readLog returns the entries of the chunks after the chunk key after, and
+// the key of the last chunk read. Logs written as a single document before
+// they were split in chunks come first.
+func (s *Server) readLog(id, after string) ([]api.LogEntry, string, error) {
+	var entries []api.LogEntry
+	if after == "" {
+		var l deploymentLog
+		if err := s.store.Get(kindLogs, id, &l); err != nil && err != store.ErrNotFound {
+			return nil, after, err
+		}
+		entries = l.Entries
+	}
+	keys, err := s.store.List(logKind(id))
+	if err != nil {
+		return nil, after, err
+	}
+	last := after
+	for _, key := range keys {
+		if key <= after {
+			continue
+		}
+		var l deploymentLog
+		if err := s.store.Get(logKind(id), key, &l); err == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, after, err
+		}
+		entries = append(entries, l.Entries...)
+		last = key
+	}
+	return entries, last, nil
+}
+
+// logState is kept for a deployment log while it is appended to or
+// followed. Appends take mu so that chunks are stored in the order of their
+// keys: followers skip the keys before the last one they read, a chunk
+// stored late under an earlier key would never reach them.
+type logState struct {
+	mu sync.Mutex
+	// last is the time of the last chunk key, keys never go back
+	last int64
+	// refs counts appends and followers, the state is dropped at zero
+	refs int
+	// appended is closed and replaced on every append, s.logMu guards it
+	appended chan struct{}
+}
+
+// acquireLog returns the state of the log of a deployment, releaseLog must
+// be called once done with it
+func (s *Server) acquireLog(id string) *logState {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	if s.logStates == nil {
+		s.logStates = make(map[string]*logState)
+	}
+	st, ok := s.logStates[id]
+	if !ok {
+		st = &logState{appended: make(chan struct{})}
+		s.logStates[id] = st
+	}
+	st.refs++
+	return st
+}
+
+func (s *Server) releaseLog(id string, st *logState) {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	if st.refs--; st.refs == 0 {
+		delete(s.logStates, id)
+	}
+}
+
+// appendLog adds lines to the log of a deployment, secret values never
+// make it to the log
+func (s *Server) appendLog(id, source string, lines ...string) {
+	if len(lines) == 0 {
+		return
+	}
+	masker, err := s.masker()
+	if err != nil {
+		log.Println("Failed to mask log of deployment", id, ", lines dropped:", err)
+		return
+	}
+	now := time.Now()
+	entries := make([]api.LogEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = api.LogEntry{Time: now, Source: source, Line: masker.Mask(line)}
+	}
+	st := s.acquireLog(id)
+	defer s.releaseLog(id, st)
+	st.mu.Lock()
+	nanos := now.UnixNano()
+	if nanos <= st.last {
+		nanos = st.last + 1
+	}
+	st.last = nanos
+	key := fmt.Sprintf("%020d-%s", nanos, newID())
+	err = s.store.Put(logKind(id), key, &deploymentLog{Entries: entries})
+	st.mu.Unlock()
+	if err != nil {
+		log.Println("Failed to write log of deployment", id, ":", err)
+		return
+	}
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	close(st.appended)
+	st.appended = make(chan struct{})
+}
+
+// logAppended returns a channel closed when this replica next appends to the
+// log of st
+func (s *Server) logAppended(st *logState) <-chan struct{} {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	return st.appended
+}
+
+// logf adds a server message to the log of a deployment
+func (s *Server) logf(id, format string, args ...interface{}) {
+	s.appendLog(id, "server", fmt.Sprintf(format, args...))
+}
+
+// getLogsHandler returns log entries from offset "from", with "follow" it
+// streams new entries as server-sent events until the deployment ends.
+// Entries are masked again for secrets set after they were written.
+func (s *Server) getLogsHandler(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := s.getDeployment(id); err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	from, _ := strconv.Atoi(c.Query("from"))
+	if from < 0 {
+		from = 0
+	}
+	masker, err := s.masker()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "secrets cannot be masked: " + err.Error()})
+		return
+	}
+	if follow, _ := strconv.ParseBool(c.Query("follow")); !follow {
+		entries, err := s.getLog(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if from > len(entries) {
+			from = len(entries)
+		}
+		entries = entries[from:]
+		for i := range entries {
+			entries[i].Line = masker.Mask(entries[i].Line)
+		}
+		c.JSON(http.StatusOK, entries)
+		return
+	}
+
+	st := s.acquireLog(id)
+	defer s.releaseLog(id, st)
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	done := false
+	// Only the chunks after the last one read are fetched again, seen counts
+	// the entries read so far
+	last, seen := "", 0
+	c.Stream(func(w io.Writer) bool {
+		// Wait for the next append before reading, not to miss it
+		appended := s.logAppended(st)
+		entries, key, err := s.readLog(id, last)
+		if err != nil {
+			c.SSEvent("error", err.Error())
+			return false
+		}
+		last = key
+		for _, e := range entries {
+			if seen >= from {
+				e.Line = masker.Mask(e.Line)
+				c.SSEvent("log", e)
+			}
+			seen++
+		}
+		if done {
+			c.SSEvent("end", "")
+			return false
+		}
+		// Drain lines written up to the end before closing the stream
+		if d, err := s.getDeployment(id); err != nil || d.State.Terminal() {
+			done = true
+			return true
+		}
+		// Stream only flushes once the step returns
+		c.Writer.Flush()
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-appended:
+		case <-ticker.C:
+		}
+		return true
+	})
+}
+
+// postLogsHandler lets workers append lines to a deployment log
+func (s *Server) postLogsHandler(c *gin.Context) {
+	id := c.Param("id")
+	var entries []api.LogEntry
+	if err := c.ShouldBindJSON(&entries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := s.getDeployment(id); err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+	lines := make(map[string][]string)
+	var sources []string
+	for _, e := range entries {
+		if _, ok := lines[e.Source]; !ok {
+			sources = append(sources, e.Source)
+		}
+		lines[e.Source] = append(lines[e.Source], e.Line)
+	}
+	for _, source := range sources {
+		s.appendLog(id, source, lines[source]...)
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+func TestFollowLog(t *testing.T) {
+	s := New(&config.Config{})
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"]}`, &d)
+	s.logf(d.ID, "second")
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/deployments/" + d.ID + "/logs?follow=true&from=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data:") || strings.HasPrefix(line, "event:end") {
+				lines <- line
+			}
+		}
+		close(lines)
+	}()
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(followInterval / 2):
+			t.Fatalf("timed out waiting for the log")
+			return ""
+		}
+	}
+	if line := next(); !strings.Contains(line, "second") {
+		t.Fatalf("expected entries from offset 1, got %s", line)
+	}
+	// Appends wake followers without waiting for the next poll
+	s.logf(d.ID, "third")
+	if line := next(); !strings.Contains(line, "third") {
+		t.Fatalf("expected appended entry, got %s", line)
+	}
+	s.updateDeployment(d.ID, func(d *api.Deployment) error {
+		d.State = api.DeploymentSucceeded
+		return nil
+	})
+	s.logf(d.ID, "last")
+	if line := next(); !strings.Contains(line, "last") {
+		t.Fatalf("expected last entry, got %s", line)
+	}
+	if line := next(); line != "event:end" {
+		t.Fatalf("expected end of log, got %s", line)
+	}
+
+	entries, err := s.getLog(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 || entries[3].Line != "last" {
+		t.Errorf("expected 4 entries in order, got %+v", entries)
+	}
+	// Followers leave nothing behind once gone
+	resp.Body.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.logMu.Lock()
+		left := len(s.logStates)
+		s.logMu.Unlock()
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the log state to be dropped, %d left", left)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// orderedStore records the order log chunks are stored in
+type orderedStore struct {
+	store.Store
+	mu   sync.Mutex
+	keys []string
+}
+
+func (o *orderedStore) Put(kind, key string, v interface{}) error {
+	if strings.HasPrefix(kind, kindLogs+"/") {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.keys = append(o.keys, key)
+	}
+	return o.Store.Put(kind, key, v)
+}
+
+func TestAppendLogOrder(t *testing.T) {
+	st := &orderedStore{Store: store.NewMemory()}
+	s := New(&config.Config{}, WithStore(st))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.logf("d1", "line %d", i)
+		}(i)
+	}
+	wg.Wait()
+	// Chunks are stored in the order of their keys, so that followers
+	// reading past a key never miss one stored after it
+	if len(st.keys) != 50 || !sort.StringsAreSorted(st.keys) {
+		t.Errorf("expected 50 chunks stored in key order, got %v", st.keys)
+	}
+	if len(s.logStates) != 0 {
+		t.Errorf("expected no log state left, got %d", len(s.logStates))
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// labelValue escapes a Prometheus label value
+func labelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// metricsHandler exposes gauges in the Prometheus text format
+func (s *Server) metricsHandler(c *gin.Context) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	drifts, err := s.listDrift()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var b strings.Builder
+
+	states := make(map[api.DeploymentState]int)
+	for _, d := range deployments {
+		states[d.State]++
+	}
+	names := make([]string, 0, len(states))
+	for state := range states {
+		names = append(names, string(state))
+	}
+	sort.Strings(names)
+	fmt.Fprintln(&b, "# HELP deployer_deployments Deployments by state.")
+	fmt.Fprintln(&b, "# TYPE deployer_deployments gauge")
+	for _, state := range names {
+		fmt.Fprintf(&b, "deployer_deployments{state=\"%s\"} %d\n", labelValue(state), states[api.DeploymentState(state)])
+	}
+
+	fmt.Fprintln(&b, "# HELP deployer_drifted Whether a worker drifted from its last successful deployment of a target.")
+	fmt.Fprintln(&b, "# TYPE deployer_drifted gauge")
+	for _, drift := range drifts {
+		value := 0
+		if drift.Drifted {
+			value = 1
+		}
+		fmt.Fprintf(&b, "deployer_drifted{worker=\"%s\",target=\"%s\",env=\"%s\"} %d\n",
+			labelValue(drift.Worker), labelValue(drift.Target), labelValue(drift.Env), value)
+	}
+	fmt.Fprintln(&b, "# HELP deployer_drift_observed_timestamp_seconds When a worker last reported its workspace.")
+	fmt.Fprintln(&b, "# TYPE deployer_drift_observed_timestamp_seconds gauge")
+	for _, drift := range drifts {
+		fmt.Fprintf(&b, "deployer_drift_observed_timestamp_seconds{worker=\"%s\",target=\"%s\",env=\"%s\"} %d\n",
+			labelValue(drift.Worker), labelValue(drift.Target), labelValue(drift.Env), drift.ObservedAt.Unix())
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
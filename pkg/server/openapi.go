@@ -0,0 +1,369 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/schema"
+)
+
+// apiVersion is the version of the REST API described by /openapi.json
+const apiVersion = "1.0.0"
+
+// operation documents a REST route in the OpenAPI document
+type operation struct {
+	Summary string
+	// Query lists the query parameters accepted
+	Query []string
+	// Header lists the request headers accepted
+	Header []string
+	// Request is a value of the request body type, nil without body
+	Request interface{}
+	// Response is a value of the response body type, nil without body
+	Response interface{}
+	// Status is the status of a successful response, 200 if zero
+	Status int
+}
+
+// errorResponse is the body of every failed REST request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// operations documents every REST route, keyed by method and gin path
+var operations = map[string]operation{
+	"POST /actions": {
+		Summary:  "Submit an action creating a deployment, retries with the same Idempotency-Key return it again",
+		Header:   []string{idempotencyHeader},
+		Request:  api.Action{},
+		Response: api.Deployment{},
+		Status:   http.StatusCreated,
+	},
+	"GET /deployments": {
+		Summary:  "List deployments, newest first",
+		Response: []api.Deployment{},
+	},
+	"GET /deployments/:id": {
+		Summary:  "Get a deployment",
+		Response: api.Deployment{},
+	},
+	"POST /deployments/:id/approve": {
+		Summary:  "Approve a deployment awaiting approval",
+		Request:  api.Review{},
+		Response: api.Deployment{},
+	},
+	"POST /deployments/:id/reject": {
+		Summary:  "Reject a deployment awaiting approval",
+		Request:  api.Review{},
+		Response: api.Deployment{},
+	},
+	"POST /deployments/:id/cancel": {
+		Summary:  "Cancel a deployment which has not ended, aborting its rollout. The body is optional.",
+		Request:  api.Review{},
+		Response: api.Deployment{},
+	},
+	"POST /deployments/:id/pause": {
+		Summary:  "Hold the next wave of a rollout",
+		Response: api.Deployment{},
+	},
+	"POST /deployments/:id/resume": {
+		Summary:  "Resume a paused rollout, a waiting wave starts right away",
+		Response: api.Deployment{},
+	},
+	"GET /deployments/:id/logs": {
+		Summary:  "Get the log of a deployment, follow=true streams it as server-sent events",
+		Query:    []string{"from", "follow"},
+		Response: []api.LogEntry{},
+	},
+	"POST /deployments/:id/logs": {
+		Summary: "Append lines to the log of a deployment",
+		Request: []api.LogEntry{},
+		Status:  http.StatusNoContent,
+	},
+	"POST /deployments/:id/hooks": {
+		Summary:  "Report the result of a hook a worker ran for a deployment, its output is masked",
+		Request:  api.HookResult{},
+		Response: api.HookResult{},
+	},
+	"GET /deployments/:id/diff": {
+		Summary:  "Compare the values, steps and files of a deployment with another one, by default the one running before it",
+		Query:    []string{"against"},
+		Response: api.Diff{},
+	},
+	"GET /workers": {
+		Summary:  "List registered workers",
+		Response: []api.Worker{},
+	},
+	"PUT /workers/:name": {
+		Summary:  "Register a worker, workers call it periodically as heartbeat",
+		Request:  api.Worker{},
+		Response: api.Worker{},
+	},
+	"POST /workers/:name/observations": {
+		Summary:  "Report what a worker observed of its deployment workspace, 204 while a deployment to it is in flight",
+		Request:  api.Observation{},
+		Response: api.Drift{},
+	},
+	"GET /drift": {
+		Summary:  "List the last observation of every worker and target, drifted=true keeps the ones which drifted",
+		Query:    []string{"drifted"},
+		Response: []api.Drift{},
+	},
+	"GET /schedules": {
+		Summary:  "List schedules with their next runs",
+		Query:    []string{"next"},
+		Response: []api.Schedule{},
+	},
+	"GET /schedules/:name": {
+		Summary:  "Get a schedule with its next runs and history",
+		Query:    []string{"next"},
+		Response: api.Schedule{},
+	},
+	"POST /schedules/:name/pause": {
+		Summary:  "Pause a schedule",
+		Response: api.Schedule{},
+	},
+	"POST /schedules/:name/resume": {
+		Summary:  "Resume a schedule, runs due while it was paused do not fire",
+		Response: api.Schedule{},
+	},
+	"GET /freezes": {
+		Summary:  "List freezes, the ones in effect first",
+		Response: []api.Freeze{},
+	},
+	"POST /freezes": {
+		Summary:  "Create a freeze",
+		Request:  api.Freeze{},
+		Response: api.Freeze{},
+		Status:   http.StatusCreated,
+	},
+	"DELETE /freezes/:name": {
+		Summary: "Delete a freeze created through the API",
+		Status:  http.StatusNoContent,
+	},
+	"GET /locks": {
+		Summary:  "List locked environments",
+		Response: []api.Lock{},
+	},
+	"POST /locks": {
+		Summary:  "Lock an environment",
+		Request:  api.Lock{},
+		Response: api.Lock{},
+		Status:   http.StatusCreated,
+	},
+	"DELETE /locks": {
+		Summary: "Unlock an environment, others than its owner must force it when callers are authenticated",
+		Query:   []string{"env", "by", "force"},
+		Status:  http.StatusNoContent,
+	},
+	"GET /audit": {
+		Summary:  "List the audit log, oldest first",
+		Query:    []string{"since", "limit"},
+		Response: []api.AuditEntry{},
+	},
+	"GET /pipelines": {
+		Summary:  "List pipelines with the current deployment of every stage",
+		Response: []api.Pipeline{},
+	},
+	"GET /pipelines/:name": {
+		Summary:  "Get a pipeline with the current deployment of every stage",
+		Response: api.Pipeline{},
+	},
+	"POST /pipelines/:name/promote": {
+		Summary:  "Deploy the values of a stage to the next stage once they succeeded and soaked",
+		Request:  api.Promotion{},
+		Response: api.Deployment{},
+		Status:   http.StatusCreated,
+	},
+	"GET /blobs": {
+		Summary:  "List stored blobs with the retained deployments referencing them",
+		Response: []api.Blob{},
+	},
+	"POST /blobs": {
+		Summary:  "Upload a blob as application/octet-stream, it is stored under the digest of its content",
+		Response: api.Blob{},
+		Status:   http.StatusCreated,
+	},
+	"POST /blobs/gc": {
+		Summary:  "Remove blobs no retained deployment references, once past the grace period",
+		Response: api.GCResult{},
+	},
+	"GET /blobs/:digest": {
+		Summary: "Download a blob as application/octet-stream, ranges are supported",
+	},
+	"HEAD /blobs/:digest": {
+		Summary: "Check whether a blob is stored",
+	},
+	"PUT /blobs/:digest": {
+		Summary:  "Upload a blob as application/octet-stream, content with another digest is refused. 200 if it was already stored.",
+		Response: api.Blob{},
+		Status:   http.StatusCreated,
+	},
+	"GET /secrets/:project": {
+		Summary:  "List the secrets of a project without their values, env keeps the ones applying to an environment",
+		Query:    []string{"env"},
+		Response: []api.Secret{},
+	},
+	"GET /secrets/:project/values": {
+		Summary:  "Get the secret values of a project in an environment, tokens need to be allowed to",
+		Query:    []string{"env"},
+		Response: map[string]string{},
+	},
+	"PUT /secrets/:project/:name": {
+		Summary:  "Set a secret, it is encrypted before being stored",
+		Request:  api.SecretValue{},
+		Response: api.Secret{},
+	},
+	"DELETE /secrets/:project/:name": {
+		Summary: "Delete a secret",
+		Query:   []string{"env"},
+		Status:  http.StatusNoContent,
+	},
+	"GET /leader": {
+		Summary:  "Show which replica holds the leader lease",
+		Response: map[string]interface{}{},
+	},
+	"GET /metrics": {
+		Summary: "Gauges in the Prometheus text format",
+	},
+	"GET /openapi.json": {
+		Summary:  "This document",
+		Response: map[string]interface{}{},
+	},
+	"POST /rpc/Server/UpdateDeployStatus": {
+		Summary:  "Report the status of a deployment, the JSON form of Server.UpdateDeployStatus",
+		Request:  pb.DeployStatus{},
+		Response: pb.Reply{},
+	},
+}
+
+// undocumented reports routes which are not part of the API
+func undocumented(path string) bool {
+	return path == "/" || strings.HasPrefix(path, "/ui/")
+}
+
+func newSchemaGenerator(refPrefix string) *schema.Generator {
+	g := schema.New(refPrefix)
+	states := make([]string, len(pb.ResourceState_name))
+	for v, name := range pb.ResourceState_name {
+		states[v] = name
+	}
+	g.Enums[reflect.TypeOf(pb.ResourceState(0))] = states
+	g.Enums[reflect.TypeOf(api.DeploymentState(""))] = []string{
+		string(api.DeploymentAwaitingApproval),
+		string(api.DeploymentPending),
+		string(api.DeploymentRunning),
+		string(api.DeploymentSucceeded),
+		string(api.DeploymentFailed),
+		string(api.DeploymentCancelled),
+	}
+	return g
+}
+
+// openAPIPath converts a gin path to an OpenAPI one and its parameters
+func openAPIPath(path string) (string, []schema.Schema) {
+	var params []schema.Schema
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			name := part[1:]
+			parts[i] = "{" + name + "}"
+			params = append(params, schema.Schema{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   schema.Schema{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func jsonContent(s schema.Schema) schema.Schema {
+	return schema.Schema{"application/json": schema.Schema{"schema": s}}
+}
+
+// openAPI describes every documented route the server has registered
+func (s *Server) openAPI() schema.Schema {
+	g := newSchemaGenerator("#/components/schemas/")
+	errorSchema := g.For(reflect.TypeOf(errorResponse{}))
+	paths := schema.Schema{}
+	routes := s.restful.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Path+routes[i].Method < routes[j].Path+routes[j].Method
+	})
+	for _, r := range routes {
+		op, ok := operations[r.Method+" "+r.Path]
+		if !ok || undocumented(r.Path) {
+			continue
+		}
+		path, params := openAPIPath(r.Path)
+		for _, q := range op.Query {
+			params = append(params, schema.Schema{
+				"name":   q,
+				"in":     "query",
+				"schema": schema.Schema{"type": "string"},
+			})
+		}
+		for _, h := range op.Header {
+			params = append(params, schema.Schema{
+				"name":   h,
+				"in":     "header",
+				"schema": schema.Schema{"type": "string"},
+			})
+		}
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := schema.Schema{"description": http.StatusText(status)}
+		if op.Response != nil {
+			success["content"] = jsonContent(g.For(reflect.TypeOf(op.Response)))
+		}
+		item := schema.Schema{
+			"summary": op.Summary,
+			"responses": schema.Schema{
+				strconv.Itoa(status): success,
+				"default": schema.Schema{
+					"description": "Error",
+					"content":     jsonContent(errorSchema),
+				},
+			},
+		}
+		if len(params) > 0 {
+			item["parameters"] = params
+		}
+		if op.Request != nil {
+			item["requestBody"] = schema.Schema{
+				"required": true,
+				"content":  jsonContent(g.For(reflect.TypeOf(op.Request))),
+			}
+		}
+		if paths[path] == nil {
+			paths[path] = schema.Schema{}
+		}
+		paths[path].(schema.Schema)[strings.ToLower(r.Method)] = item
+	}
+	return schema.Schema{
+		"openapi": "3.0.3",
+		"info": schema.Schema{
+			"title":   "Deployer",
+			"version": apiVersion,
+		},
+		"paths": paths,
+		"components": schema.Schema{
+			"schemas": g.Definitions,
+		},
+	}
+}
+
+func (s *Server) getOpenAPIHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, s.openAPI())
+}
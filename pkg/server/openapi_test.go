@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	s := New(&config.Config{})
+	for _, r := range s.restful.Routes() {
+		if _, ok := operations[r.Method+" "+r.Path]; !ok && !undocumented(r.Path) {
+			t.Errorf("route %s %s is missing from the OpenAPI document", r.Method, r.Path)
+		}
+	}
+
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if code := call(t, s, "GET", "/openapi.json", "", &doc); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if doc.OpenAPI == "" {
+		t.Error("expected an OpenAPI version")
+	}
+	if _, ok := doc.Paths["/deployments/{id}"]["get"]; !ok {
+		t.Errorf("expected path parameters in OpenAPI form, got %v", doc.Paths)
+	}
+}
+
+func TestTranscodeCoversServerService(t *testing.T) {
+	s := New(&config.Config{})
+	methods := pb.File_proto_proto.Services().ByName("Server").Methods()
+	for i := 0; i < methods.Len(); i++ {
+		name := string(methods.Get(i).Name())
+		if _, ok := s.transcoded()[name]; !ok {
+			t.Errorf("method Server.%s is not served as JSON", name)
+		}
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	s := New(&config.Config{})
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"]}`, &d)
+
+	req := httptest.NewRequest("POST", "/rpc/Server/UpdateDeployStatus",
+		strings.NewReader(`{"id":"`+d.ID+`","worker":"w1","resources":{"app":"RES_SUCCESS"}}`))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"message":"OK"`) {
+		t.Fatalf("unexpected reply %d: %s", w.Code, w.Body)
+	}
+	if d, _ := s.getDeployment(d.ID); d.State != api.DeploymentSucceeded {
+		t.Errorf("expected deployment to succeed, got %s", d.State)
+	}
+
+	req = httptest.NewRequest("POST", "/rpc/Server/UpdateDeployStatus", strings.NewReader(`{"unknown":1}`))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid message, got %d", w.Code)
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+// artifactDigest identifies what a deployment ships apart from its
+// environment. Files are the bundle as rendered before it was uploaded, so
+// the digests of their blobs are hashed rather than the values they were
+// rendered from, values are hashed only when there are no files. JSON
+// encoding sorts keys so equal inputs give equal digests.
+func artifactDigest(target string, values map[string]interface{}, files map[string]string, spec *api.Spec) (string, error) {
+	if len(files) > 0 {
+		values = nil
+	}
+	raw, err := json.Marshal(struct {
+		Target string                 `json:"target"`
+		Values map[string]interface{} `json:"values,omitempty"`
+		Files  map[string]string      `json:"files,omitempty"`
+		Spec   *api.Spec              `json:"spec,omitempty"`
+	}{target, values, files, spec})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode values:%v", err)
+	}
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func (s *Server) pipelineConfig(name string) (*config.PipelineConfig, bool) {
+	cfg := s.config()
+	for i := range cfg.Pipelines {
+		if cfg.Pipelines[i].Name == name {
+			return &cfg.Pipelines[i], true
+		}
+	}
+	return nil, false
+}
+
+// stageIndex returns the position of env in a pipeline, -1 if absent
+func stageIndex(pc *config.PipelineConfig, env string) int {
+	for i, stage := range pc.Stages {
+		if stage.Env == env {
+			return i
+		}
+	}
+	return -1
+}
+
+// currentDeployment returns the latest deployment of target to env which
+// ran, deployments waiting or cancelled do not change what is deployed
+func currentDeployment(deployments []*api.Deployment, target, env string) *api.Deployment {
+	for _, d := range deployments {
+		if d.Target != target || d.Env != env {
+			continue
+		}
+		switch d.State {
+		case api.DeploymentRunning, api.DeploymentSucceeded, api.DeploymentFailed:
+			return d
+		}
+	}
+	return nil
+}
+
+// promotable checks that d may move on from its stage: it succeeded, is
+// still what the stage runs and has soaked. It returns when d is soaked.
+func promotable(deployments []*api.Deployment, d *api.Deployment, stage *config.StageConfig, now time.Time) (time.Time, error) {
+	if d.State != api.DeploymentSucceeded {
+		return time.Time{}, fmt.Errorf("deployment %s is %s in %s", d.ID, d.State, stage.Env)
+	}
+	if d.RolledBackBy != "" {
+		return time.Time{}, fmt.Errorf("deployment %s was rolled back by %s", d.ID, d.RolledBackBy)
+	}
+	if current := currentDeployment(deployments, d.Target, d.Env); current != nil && current.ID != d.ID {
+		if current.State == api.DeploymentSucceeded && current.Artifact == d.Artifact {
+			// Deploying the same artifact again does not make it less tested
+			return promotable(deployments, current, stage, now)
+		}
+		return time.Time{}, fmt.Errorf("deployment %s was followed by %s which is %s in %s",
+			d.ID, current.ID, current.State, stage.Env)
+	}
+	ended := d.UpdatedAt
+	if d.EndedAt != nil {
+		ended = *d.EndedAt
+	}
+	soaked := ended.Add(time.Duration(stage.Soak))
+	if now.Before(soaked) {
+		return soaked, fmt.Errorf("deployment %s soaks in %s until %s", d.ID, stage.Env, soaked.Format(time.RFC3339))
+	}
+	return soaked, nil
+}
+
+func (s *Server) describePipeline(pc *config.PipelineConfig) (*api.Pipeline, error) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	p := &api.Pipeline{Name: pc.Name, Target: pc.Target}
+	for i := range pc.Stages {
+		stage := &pc.Stages[i]
+		ps := api.PipelineStage{Env: stage.Env}
+		if stage.Soak > 0 {
+			ps.Soak = time.Duration(stage.Soak).String()
+		}
+		if d := currentDeployment(deployments, pc.Target, stage.Env); d != nil {
+			ps.Deployment, ps.Artifact, ps.State = d.ID, d.Artifact, d.State
+			soaked, err := promotable(deployments, d, stage, now)
+			if !soaked.IsZero() {
+				ps.SoakedAt = &soaked
+			}
+			if err != nil {
+				ps.Blocked = err.Error()
+			}
+		}
+		p.Stages = append(p.Stages, ps)
+	}
+	return p, nil
+}
+
+// promote deploys the artifact of a deployment of one stage to the next
+// stage. The files carried are the blobs the first stage deployed, they are
+// not rendered again: the overlay of the stage only reaches workers in the
+// deployment manifest, merged over the values there, for what reads values
+// when deploying, such as hooks, steps and templates rendered with secrets.
+func (s *Server) promote(pc *config.PipelineConfig, promotion *api.Promotion, by string) (*api.Deployment, error) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		return nil, err
+	}
+	var source *api.Deployment
+	if promotion.Deployment != "" {
+		if source, err = s.getDeployment(promotion.Deployment); err != nil {
+			return nil, err
+		}
+	} else if promotion.From != "" {
+		if source = currentDeployment(deployments, pc.Target, promotion.From); source == nil {
+			return nil, errConflict{fmt.Sprintf("nothing was deployed to %s", promotion.From)}
+		}
+	} else {
+		return nil, fmt.Errorf("either deployment or from is required")
+	}
+	if source.Target != pc.Target {
+		return nil, fmt.Errorf("deployment %s is of %s, pipeline %s promotes %s", source.ID, source.Target, pc.Name, pc.Target)
+	}
+	i := stageIndex(pc, source.Env)
+	if i < 0 {
+		return nil, fmt.Errorf("%s is not a stage of pipeline %s", envName(source.Env), pc.Name)
+	}
+	if i == len(pc.Stages)-1 {
+		return nil, errConflict{fmt.Sprintf("%s is the last stage of pipeline %s", source.Env, pc.Name)}
+	}
+	if _, err := promotable(deployments, source, &pc.Stages[i], time.Now()); err != nil {
+		return nil, errConflict{err.Error()}
+	}
+	next := &pc.Stages[i+1]
+	d, err := s.createDeployment(&api.Action{
+		Action:         api.ActionDeploy,
+		Target:         source.Target,
+		Env:            next.Env,
+		Values:         source.Values,
+		Workers:        next.Workers,
+		Selector:       next.Selector,
+		Verify:         source.Verify,
+		Files:          source.Files,
+		Spec:           source.Spec,
+		FreezeOverride: promotion.FreezeOverride,
+		LockOverride:   promotion.LockOverride,
+	}, func(d *api.Deployment) {
+		d.Overlay = next.Overlay
+		d.Pipeline = pc.Name
+		d.PromotedFrom = source.ID
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Deployment", source.ID, "promoted to", envName(next.Env), "as", d.ID, "by", by)
+	s.logf(d.ID, "promoted from %s in %s through pipeline %s by %s", source.ID, envName(source.Env), pc.Name, by)
+	return d, nil
+}
+
+func (s *Server) listPipelinesHandler(c *gin.Context) {
+	cfg := s.config()
+	pipelines := make([]*api.Pipeline, 0, len(cfg.Pipelines))
+	for i := range cfg.Pipelines {
+		p, err := s.describePipeline(&cfg.Pipelines[i])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		pipelines = append(pipelines, p)
+	}
+	c.JSON(http.StatusOK, pipelines)
+}
+
+func (s *Server) getPipelineHandler(c *gin.Context) {
+	pc, ok := s.pipelineConfig(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pipeline not found"})
+		return
+	}
+	p, err := s.describePipeline(pc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (s *Server) promoteHandler(c *gin.Context) {
+	pc, ok := s.pipelineConfig(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pipeline not found"})
+		return
+	}
+	var promotion api.Promotion
+	if err := c.ShouldBindJSON(&promotion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if o := promotion.FreezeOverride; o != nil && (s.config().Auth != nil || o.By == "") {
+		o.By = caller(c)
+	}
+	if o := promotion.LockOverride; o != nil && (s.config().Auth != nil || o.By == "") {
+		o.By = caller(c)
+	}
+	d, err := s.promote(pc, &promotion, caller(c))
+	switch err.(type) {
+	case nil:
+	case errConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, d)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+func TestPromote(t *testing.T) {
+	s := newRolloutServer(t, &fakeWorkers{})
+	s.cfg.Pipelines = []config.PipelineConfig{{
+		Name:   "web",
+		Target: "web",
+		Stages: []config.StageConfig{
+			{Env: "dev", Workers: []string{"w1"}, Soak: config.Duration(time.Hour)},
+			{Env: "staging", Workers: []string{"w2"}, Overlay: map[string]interface{}{"replicas": 2}},
+			{Env: "prod", Selector: map[string]string{"role": "db"}},
+		},
+	}}
+	deploy := func(values string) *api.Deployment {
+		var d api.Deployment
+		if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"dev","workers":["w1"],"values":`+values+`}`, &d); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", code)
+		}
+		s.schedule(context.Background())
+		return &d
+	}
+	dev := deploy(`{"image":"web:1.2"}`)
+	report(t, s, dev.ID, "w1", pb.ResourceState_RES_SUCCESS)
+
+	if code := call(t, s, "POST", "/pipelines/web/promote", `{"from":"dev"}`, nil); code != http.StatusConflict {
+		t.Fatalf("expected promotion to wait for the soak, got %d", code)
+	}
+	var p api.Pipeline
+	call(t, s, "GET", "/pipelines/web", "", &p)
+	if p.Stages[0].Deployment != dev.ID || p.Stages[0].SoakedAt == nil || p.Stages[0].Blocked == "" {
+		t.Errorf("unexpected dev stage %+v", p.Stages[0])
+	}
+
+	s.updateDeployment(dev.ID, func(d *api.Deployment) error {
+		ended := time.Now().Add(-2 * time.Hour)
+		d.EndedAt = &ended
+		return nil
+	})
+	var staging api.Deployment
+	if code := call(t, s, "POST", "/pipelines/web/promote", `{"from":"dev"}`, &staging); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if staging.Env != "staging" || staging.PromotedFrom != dev.ID || staging.Artifact != dev.Artifact ||
+		!reflect.DeepEqual(staging.Workers, []string{"w2"}) || staging.Overlay["replicas"] != float64(2) {
+		t.Errorf("unexpected promoted deployment %+v", staging)
+	}
+
+	// Staging has not run it yet
+	if code := call(t, s, "POST", "/pipelines/web/promote", `{"from":"staging"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", code)
+	}
+	s.schedule(context.Background())
+	report(t, s, staging.ID, "w2", pb.ResourceState_RES_SUCCESS)
+	var prod api.Deployment
+	if code := call(t, s, "POST", "/pipelines/web/promote", `{"deployment":"`+staging.ID+`"}`, &prod); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if prod.Artifact != dev.Artifact || prod.Overlay != nil || !reflect.DeepEqual(prod.Workers, []string{"db1"}) {
+		t.Errorf("unexpected promoted deployment %+v", prod)
+	}
+	if code := call(t, s, "POST", "/pipelines/web/promote", `{"deployment":"`+prod.ID+`"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected the last stage not to be promoted, got %d", code)
+	}
+
+	// A failed deployment in dev since blocks promoting the older one
+	failed := deploy(`{"image":"web:1.3"}`)
+	report(t, s, failed.ID, "w1", pb.ResourceState_RES_ERROR)
+	if code := call(t, s, "POST", "/pipelines/web/promote", `{"deployment":"`+dev.ID+`"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", code)
+	}
+	if code := call(t, s, "POST", "/pipelines/web/promote", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", code)
+	}
+	if code := call(t, s, "POST", "/pipelines/api/promote", `{"from":"dev"}`, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+}
+
+func TestArtifactDigest(t *testing.T) {
+	digest := func(values map[string]interface{}, files map[string]string) string {
+		artifact, err := artifactDigest("web", values, files, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return artifact
+	}
+	v1 := map[string]interface{}{"image": "web:1.2"}
+	v2 := map[string]interface{}{"image": "web:1.3"}
+	if digest(v1, nil) == digest(v2, nil) {
+		t.Error("expected values to make the artifact without files")
+	}
+	// Files were rendered from the values, their blobs are the artifact
+	files := map[string]string{"app.yaml": "sha256:1111"}
+	if digest(v1, files) != digest(v2, files) {
+		t.Error("expected the rendered files alone to make the artifact")
+	}
+	if digest(v1, files) == digest(v1, map[string]string{"app.yaml": "sha256:2222"}) {
+		t.Error("expected another rendering to make another artifact")
+	}
+}
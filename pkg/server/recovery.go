@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+// recoverDeployments reconciles deployments a previous process left running:
+// every worker involved is asked for its state, and deployments no worker
+// can account for are handled according to the recovery policy
+func (s *Server) recoverDeployments(ctx context.Context) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		log.Println("Failed to list deployments for recovery:", err)
+		return
+	}
+	policy := config.RecoveryRequeue
+	if cfg := s.config(); cfg.Recovery != nil && cfg.Recovery.Policy != "" {
+		policy = cfg.Recovery.Policy
+	}
+	for _, d := range deployments {
+		if d.State != api.DeploymentRunning {
+			continue
+		}
+		reports := make(map[string]*pb.DeployStatus)
+		var lost []string
+		for _, name := range dispatchedWorkers(d) {
+			status, err := s.askWorker(ctx, name, d.ID)
+			if err != nil {
+				log.Println("Worker", name, "cannot account for deployment", d.ID, ":", err)
+				lost = append(lost, name)
+				continue
+			}
+			reports[name] = status
+		}
+		recovered, err := s.updateDeployment(d.ID, func(d *api.Deployment) error {
+			if d.State != api.DeploymentRunning {
+				return nil
+			}
+			for name, status := range reports {
+				recordStatus(d, name, status.Resources, status.Steps)
+			}
+			if d.State != api.DeploymentRunning || len(lost) == 0 {
+				return nil
+			}
+			switch policy {
+			case config.RecoveryFail:
+				d.State = api.DeploymentFailed
+				d.Message = fmt.Sprintf("lost track of workers %v after restart", lost)
+			case config.RecoveryRequeue:
+				for _, name := range lost {
+					delete(d.Resources, name)
+				}
+				d.State = api.DeploymentPending
+				d.Message = fmt.Sprintf("re-queued for workers %v after restart", lost)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Println("Failed to recover deployment", d.ID, ":", err)
+			continue
+		}
+		log.Println("Recovered deployment", recovered.ID, "as", recovered.State)
+		s.logf(recovered.ID, "recovered after restart as %s", recovered.State)
+	}
+}
+
+func (s *Server) askWorker(ctx context.Context, name, id string) (*pb.DeployStatus, error) {
+	w, err := s.getWorker(name)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, workerTimeout)
+	defer cancel()
+	return s.workers.DeployStatus(ctx, w, id)
+}
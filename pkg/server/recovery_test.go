@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+// fakeWorkers answers on behalf of workers from canned statuses
+type fakeWorkers struct {
+	mu       sync.Mutex
+	statuses map[string]*pb.DeployStatus
+	sent     []string
+	// secrets are the ones sent last
+	secrets map[string]string
+}
+
+func (f *fakeWorkers) SendDeployment(ctx context.Context, w *api.Worker, d *api.Deployment, secrets map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, w.Name)
+	f.secrets = secrets
+	return nil
+}
+
+func (f *fakeWorkers) DeployStatus(ctx context.Context, w *api.Worker, id string) (*pb.DeployStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.statuses[w.Name]; ok {
+		return s, nil
+	}
+	return nil, status.Error(codes.NotFound, "unknown deployment")
+}
+
+func newTestServer(t *testing.T, policy string, workers *fakeWorkers, names ...string) *Server {
+	st := store.NewMemory()
+	for _, name := range names {
+		if err := st.Put(kindWorkers, name, &api.Worker{Name: name, Addr: name + ":9001"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{Addr: ":0", Recovery: &config.RecoveryConfig{Policy: policy}}
+	return New(cfg, WithStore(st), WithWorkerClient(workers))
+}
+
+func runningDeployment(t *testing.T, s *Server, workers ...string) string {
+	d := &api.Deployment{
+		ID:        newID(),
+		Target:    "web",
+		Workers:   workers,
+		State:     api.DeploymentRunning,
+		CreatedAt: time.Now(),
+	}
+	if err := s.saveDeployment(d); err != nil {
+		t.Fatal(err)
+	}
+	return d.ID
+}
+
+func TestRecoverRequeue(t *testing.T) {
+	workers := &fakeWorkers{statuses: map[string]*pb.DeployStatus{
+		"w1": {Resources: map[string]pb.ResourceState{"app": pb.ResourceState_RES_SUCCESS}},
+	}}
+	s := newTestServer(t, config.RecoveryRequeue, workers, "w1", "w2")
+	id := runningDeployment(t, s, "w1", "w2")
+
+	s.recoverDeployments(context.Background())
+	d, _ := s.getDeployment(id)
+	if d.State != api.DeploymentPending {
+		t.Fatalf("expected deployment to be re-queued, got %s", d.State)
+	}
+	if d.Resources["w1"]["app"] != pb.ResourceState_RES_SUCCESS {
+		t.Errorf("expected state reported by w1 to be kept, got %v", d.Resources)
+	}
+
+	s.schedule(context.Background())
+	if len(workers.sent) != 1 || workers.sent[0] != "w2" {
+		t.Errorf("expected only w2 to receive the deployment again, got %v", workers.sent)
+	}
+	d, _ = s.getDeployment(id)
+	if d.State != api.DeploymentRunning {
+		t.Errorf("expected deployment to run again, got %s", d.State)
+	}
+
+	reply, err := s.UpdateDeployStatus(context.Background(), &pb.DeployStatus{
+		Id:        id,
+		Worker:    "w2",
+		Resources: map[string]pb.ResourceState{"app": pb.ResourceState_RES_SUCCESS},
+	})
+	if err != nil || reply.Code != 200 {
+		t.Fatalf("unexpected reply %v, %v", reply, err)
+	}
+	d, _ = s.getDeployment(id)
+	if d.State != api.DeploymentSucceeded {
+		t.Errorf("expected deployment to succeed, got %s", d.State)
+	}
+}
+
+func TestRecoverFail(t *testing.T) {
+	s := newTestServer(t, config.RecoveryFail, &fakeWorkers{}, "w1")
+	id := runningDeployment(t, s, "w1")
+
+	s.recoverDeployments(context.Background())
+	d, _ := s.getDeployment(id)
+	if d.State != api.DeploymentFailed {
+		t.Errorf("expected deployment to fail, got %s", d.State)
+	}
+}
+
+func TestRecoverResume(t *testing.T) {
+	workers := &fakeWorkers{statuses: map[string]*pb.DeployStatus{
+		"w1": {Resources: map[string]pb.ResourceState{"app": pb.ResourceState_RES_PENDING}},
+		"w2": {Resources: map[string]pb.ResourceState{"app": pb.ResourceState_RES_ERROR}},
+	}}
+	s := newTestServer(t, config.RecoveryRequeue, workers, "w1", "w2")
+	pending := runningDeployment(t, s, "w1")
+	failed := runningDeployment(t, s, "w2")
+
+	s.recoverDeployments(context.Background())
+	if d, _ := s.getDeployment(pending); d.State != api.DeploymentRunning {
+		t.Errorf("expected deployment still in progress to resume, got %s", d.State)
+	}
+	if d, _ := s.getDeployment(failed); d.State != api.DeploymentFailed {
+		t.Errorf("expected deployment to adopt the worker failure, got %s", d.State)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/beacon/deployer/pkg/config"
+)
+
+// restartOnly lists the config fields a running server cannot change: the
+// listener, the store, replication, limits and what is opened at startup.
+// Everything else is read when used and applies as soon as it is reloaded.
+var restartOnly = []string{"Mode", "Addr", "DataDir", "HA", "Limits", "Secrets", "Blobs"}
+
+// Reload replaces the config of the running server with cfg, which must be
+// valid. Changes to fields only read at startup are not applied, their
+// names in the config file are returned for the caller to report. TLS
+// certificates are loaded again, failing to load them fails the reload and
+// the running config is kept. The log level applies at once. The server has
+// no webhooks, there are none to reload.
+func (s *Server) Reload(cfg *config.Config) ([]string, error) {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	running := s.cfg
+	next := *cfg
+	var restart []string
+	loaded := reflect.ValueOf(&next).Elem()
+	for _, name := range restartOnly {
+		field := loaded.FieldByName(name)
+		was := reflect.ValueOf(running).Elem().FieldByName(name)
+		if !reflect.DeepEqual(field.Interface(), was.Interface()) {
+			restart = append(restart, fieldName(name))
+			field.Set(was)
+		}
+	}
+	// Certificates are served from memory, but whether TLS is served at all
+	// depends on the listener
+	switch {
+	case (next.TLS == nil) != (running.TLS == nil):
+		restart = append(restart, fieldName("TLS"))
+		next.TLS = running.TLS
+	case next.TLS != nil:
+		if err := s.loadCertificate(next.TLS); err != nil {
+			return nil, err
+		}
+	}
+	s.cfg = &next
+	s.setLogLevel(next.LogLevel)
+	if len(restart) > 0 {
+		log.Println("Reloaded config, restart to apply changes to", strings.Join(restart, ", "))
+	} else {
+		log.Println("Reloaded config")
+	}
+	return restart, nil
+}
+
+// fieldName is the name of a config field in config files
+func fieldName(name string) string {
+	f, _ := reflect.TypeOf(config.Config{}).FieldByName(name)
+	if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag != "" {
+		return tag
+	}
+	return name
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/config"
+)
+
+func TestReload(t *testing.T) {
+	running := &config.Config{Addr: ":9000", DataDir: "/var/lib/deployer", TLS: cfg.TLS}
+	s := New(running)
+	if code := call(t, s, "GET", "/schedules/nightly", "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected no schedule yet, got %d", code)
+	}
+
+	next := &config.Config{
+		Addr: ":9100",
+		TLS:  &config.TLSConfig{CertFile: cfg.TLS.CertFile, KeyFile: cfg.TLS.KeyFile},
+		Auth: &config.AuthConfig{Tokens: []config.TokenConfig{{Name: "ci", Token: "secret"}}},
+		Schedules: []config.ScheduleConfig{{
+			Name: "nightly", Cron: "0 2 * * *", Target: "web", Workers: []string{"w1"},
+		}},
+	}
+	restart, err := s.Reload(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"addr", "dataDir"}; !reflect.DeepEqual(restart, want) {
+		t.Errorf("expected %v to need a restart, got %v", want, restart)
+	}
+	if c := s.config(); c.Addr != ":9000" || c.DataDir != "/var/lib/deployer" {
+		t.Errorf("expected restart only fields to keep their running value, got %s %s", c.Addr, c.DataDir)
+	}
+	if cert, _ := s.getCertificate(nil); cert == nil {
+		t.Error("expected certificate to be loaded")
+	}
+	// Tokens and schedules apply at once
+	if code := call(t, s, "GET", "/schedules/nightly", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected tokens to be required, got %d", code)
+	}
+	if s.debug != 0 {
+		t.Error("expected the info log level by default")
+	}
+	next.Auth, next.LogLevel = nil, config.LogDebug
+	if _, err := s.Reload(next); err != nil {
+		t.Fatal(err)
+	}
+	if code := call(t, s, "GET", "/schedules/nightly", "", nil); code != http.StatusOK {
+		t.Errorf("expected reloaded schedule, got %d", code)
+	}
+	if s.debug != 1 {
+		t.Error("expected the debug log level to apply at once")
+	}
+
+	// A certificate which cannot be loaded keeps the running config
+	broken := &config.Config{Addr: ":9000", TLS: &config.TLSConfig{CertFile: "/nonexistent", KeyFile: "/nonexistent"}}
+	if _, err := s.Reload(broken); err == nil {
+		t.Error("expected reload to fail")
+	}
+	if len(s.config().Schedules) != 1 {
+		t.Error("expected running config to be kept")
+	}
+	if restart, _ := s.Reload(&config.Config{Addr: ":9000", DataDir: "/var/lib/deployer"}); !reflect.DeepEqual(restart, []string{"tls"}) {
+		t.Errorf("expected disabling TLS to need a restart, got %v", restart)
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+// planWaves splits workers into the waves of a rollout
+func planWaves(workers []string, rollout *api.Rollout) ([][]string, error) {
+	if len(rollout.Waves) == 0 {
+		return nil, fmt.Errorf("a rollout needs at least one wave")
+	}
+	if rollout.Pause != "" {
+		if d, err := time.ParseDuration(rollout.Pause); err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid pause %q", rollout.Pause)
+		}
+	}
+	if rollout.MaxFailures < 0 {
+		return nil, fmt.Errorf("maxFailures cannot be negative")
+	}
+	var waves [][]string
+	rest := workers
+	for _, size := range rollout.Waves {
+		n, err := waveSize(size, len(workers))
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			break
+		}
+		if n > len(rest) {
+			n = len(rest)
+		}
+		waves = append(waves, rest[:n])
+		rest = rest[n:]
+	}
+	if len(rest) > 0 {
+		waves = append(waves, rest)
+	}
+	return waves, nil
+}
+
+// waveSize reads "3" or "10%" of total, a wave has at least one worker
+func waveSize(size string, total int) (int, error) {
+	if strings.HasSuffix(size, "%") {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(size, "%"), 64)
+		if err != nil || pct <= 0 || pct > 100 {
+			return 0, fmt.Errorf("invalid wave size %q", size)
+		}
+		n := int(math.Ceil(pct * float64(total) / 100))
+		if n < 1 {
+			n = 1
+		}
+		return n, nil
+	}
+	n, err := strconv.Atoi(size)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid wave size %q", size)
+	}
+	return n, nil
+}
+
+// dispatchedWorkers returns the workers of the waves sent so far, every
+// worker for deployments without waves
+func dispatchedWorkers(d *api.Deployment) []string {
+	if len(d.Waves) == 0 {
+		return d.Workers
+	}
+	last := d.Wave
+	if d.NextWaveAt != nil {
+		last--
+	}
+	var workers []string
+	for i := 0; i <= last && i < len(d.Waves); i++ {
+		workers = append(workers, d.Waves[i]...)
+	}
+	return workers
+}
+
+func maxFailures(d *api.Deployment) int {
+	if d.Rollout == nil {
+		return 0
+	}
+	return d.Rollout.MaxFailures
+}
+
+// nextWave schedules the wave after the one which just ended
+func nextWave(d *api.Deployment) {
+	var pause time.Duration
+	if d.Rollout != nil {
+		pause, _ = time.ParseDuration(d.Rollout.Pause)
+		d.Paused = d.Rollout.Manual
+	}
+	d.Wave++
+	next := time.Now().Add(pause)
+	d.NextWaveAt = &next
+	d.Message = fmt.Sprintf("wave %d of %d done", d.Wave, len(d.Waves))
+}
+
+// waveDue reports whether the next wave of a running deployment may start
+func waveDue(d *api.Deployment, now time.Time) bool {
+	return d.State == api.DeploymentRunning && d.NextWaveAt != nil && !d.Paused && !now.Before(*d.NextWaveAt)
+}
+
+func (s *Server) pauseHandler(c *gin.Context) {
+	s.setRolloutPaused(c, true)
+}
+
+func (s *Server) resumeHandler(c *gin.Context) {
+	s.setRolloutPaused(c, false)
+}
+
+// setRolloutPaused holds or releases the next wave of a rollout, resuming
+// starts a waiting wave without waiting for the rest of its pause
+func (s *Server) setRolloutPaused(c *gin.Context, paused bool) {
+	d, err := s.updateDeployment(c.Param("id"), func(d *api.Deployment) error {
+		if len(d.Waves) == 0 {
+			return errConflict{"deployment is not rolled out in waves"}
+		}
+		if d.State.Terminal() {
+			return errConflict{fmt.Sprintf("deployment is %s", d.State)}
+		}
+		if d.Paused == paused {
+			return nil
+		}
+		d.Paused = paused
+		if !paused && d.NextWaveAt != nil {
+			now := time.Now()
+			d.NextWaveAt = &now
+		}
+		return nil
+	})
+	switch err.(type) {
+	case nil:
+	case errConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if paused {
+		s.logf(d.ID, "rollout paused by %s", caller(c))
+	} else {
+		s.logf(d.ID, "rollout resumed by %s", caller(c))
+	}
+	c.JSON(http.StatusOK, d)
+}
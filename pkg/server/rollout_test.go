@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+func TestPlanWaves(t *testing.T) {
+	var workers []string
+	for i := 0; i < 20; i++ {
+		workers = append(workers, fmt.Sprintf("w%d", i))
+	}
+	waves, err := planWaves(workers, &api.Rollout{Waves: []string{"1", "10%"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waves) != 3 || len(waves[0]) != 1 || len(waves[1]) != 2 || len(waves[2]) != 17 {
+		t.Errorf("unexpected waves %v", waves)
+	}
+	for _, size := range []string{"0", "x", "150%"} {
+		if _, err := planWaves(workers, &api.Rollout{Waves: []string{size}}); err == nil {
+			t.Errorf("expected wave size %s to be rejected", size)
+		}
+	}
+}
+
+func newRolloutServer(t *testing.T, workers *fakeWorkers) *Server {
+	s := newTestServer(t, config.RecoveryRequeue, workers)
+	for _, name := range []string{"w1", "w2", "w3", "db1"} {
+		role := "web"
+		if name == "db1" {
+			role = "db"
+		}
+		s.store.Put(kindWorkers, name, &api.Worker{Name: name, Addr: name + ":9001", Labels: map[string]string{"role": role}})
+	}
+	return s
+}
+
+func report(t *testing.T, s *Server, id, worker string, state pb.ResourceState) {
+	t.Helper()
+	reply, err := s.UpdateDeployStatus(context.Background(), &pb.DeployStatus{
+		Id:        id,
+		Worker:    worker,
+		Resources: map[string]pb.ResourceState{"app": state},
+	})
+	if err != nil || reply.Code != http.StatusOK {
+		t.Fatalf("failed to report status: %v %v", reply, err)
+	}
+}
+
+func TestRolloutWaves(t *testing.T) {
+	workers := &fakeWorkers{}
+	s := newRolloutServer(t, workers)
+	var d api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","selector":{"role":"web"},"rollout":{"waves":["1"],"maxFailures":1}}`, &d); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if len(d.Workers) != 3 || len(d.Waves) != 2 {
+		t.Fatalf("expected 3 web workers in 2 waves, got %v %v", d.Workers, d.Waves)
+	}
+
+	s.schedule(context.Background())
+	if len(workers.sent) != 1 || workers.sent[0] != "w1" {
+		t.Fatalf("expected the canary wave only, sent to %v", workers.sent)
+	}
+	report(t, s, d.ID, "w1", pb.ResourceState_RES_SUCCESS)
+	s.schedule(context.Background())
+	if len(workers.sent) != 3 {
+		t.Fatalf("expected second wave to be dispatched, sent to %v", workers.sent)
+	}
+
+	// One failure is tolerated, the second one stops the rollout
+	report(t, s, d.ID, "w2", pb.ResourceState_RES_ERROR)
+	if d, _ := s.getDeployment(d.ID); d.State != api.DeploymentRunning {
+		t.Fatalf("expected a tolerated failure to keep the rollout going, got %s", d.State)
+	}
+	report(t, s, d.ID, "w3", pb.ResourceState_RES_ERROR)
+	if d, _ := s.getDeployment(d.ID); d.State != api.DeploymentFailed {
+		t.Errorf("expected rollout to stop, got %s", d.State)
+	}
+}
+
+func TestRolloutPauseResume(t *testing.T) {
+	workers := &fakeWorkers{}
+	s := newRolloutServer(t, workers)
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","selector":{"role":"web"},"rollout":{"waves":["1"],"pause":"1h","manual":true}}`, &d)
+	s.schedule(context.Background())
+	report(t, s, d.ID, "w1", pb.ResourceState_RES_SUCCESS)
+	s.schedule(context.Background())
+	if len(workers.sent) != 1 {
+		t.Fatalf("expected manual rollout to wait, sent to %v", workers.sent)
+	}
+
+	if code := call(t, s, "POST", "/deployments/"+d.ID+"/resume", "", &d); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	s.schedule(context.Background())
+	if len(workers.sent) != 3 {
+		t.Fatalf("expected resumed rollout to go on without waiting for the pause, sent to %v", workers.sent)
+	}
+	report(t, s, d.ID, "w2", pb.ResourceState_RES_SUCCESS)
+	report(t, s, d.ID, "w3", pb.ResourceState_RES_SUCCESS)
+	if d, _ := s.getDeployment(d.ID); d.State != api.DeploymentSucceeded {
+		t.Errorf("expected rollout to succeed, got %s", d.State)
+	}
+	if code := call(t, s, "POST", "/deployments/"+d.ID+"/pause", "", nil); code != http.StatusConflict {
+		t.Errorf("expected pausing an ended rollout to conflict, got %d", code)
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// scheduleInterval is how often pending deployments are looked for
+const scheduleInterval = time.Second
+
+// workerTimeout bounds every call made to a worker
+const workerTimeout = 10 * time.Second
+
+func (s *Server) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		s.schedule(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// schedule fires due schedules, dispatches pending deployments unless their
+// environment is frozen and fails stale running ones
+func (s *Server) schedule(ctx context.Context) {
+	s.runSchedules(time.Now())
+	s.maybeCollectBlobs(time.Now())
+	s.maybePruneKeys(time.Now())
+	deployments, err := s.listDeployments()
+	if err != nil {
+		log.Println("Failed to list deployments:", err)
+		return
+	}
+	var staleAfter time.Duration
+	if cfg := s.config(); cfg.Recovery != nil {
+		staleAfter = time.Duration(cfg.Recovery.StaleAfter)
+	}
+	now := time.Now()
+	for _, d := range deployments {
+		if !s.isLeader() {
+			return
+		}
+		switch d.State {
+		case api.DeploymentPending:
+			if d.Paused || s.holdFrozen(d) || s.holdLocked(d) {
+				continue
+			}
+			s.dispatch(ctx, d.ID)
+		case api.DeploymentRunning:
+			if d.NextWaveAt != nil || d.Paused {
+				// Waiting between waves is not being stale
+				if waveDue(d, now) && !s.holdFrozen(d) && !s.holdLocked(d) {
+					s.dispatchWave(ctx, d.ID)
+				}
+				continue
+			}
+			if d.Verify != nil && s.startVerifications(ctx, d) {
+				// Probes may take longer than staleAfter
+				continue
+			}
+			if staleAfter > 0 && now.Sub(d.UpdatedAt) > staleAfter {
+				s.updateDeployment(d.ID, func(d *api.Deployment) error {
+					if d.State == api.DeploymentRunning {
+						d.State = api.DeploymentFailed
+						d.Message = fmt.Sprintf("no update received for %s", staleAfter)
+					}
+					return nil
+				})
+			}
+		case api.DeploymentFailed:
+			if wantsRollback(d) {
+				s.autoRollback(d)
+			}
+		}
+	}
+}
+
+// dispatch sends a pending deployment to every worker of the waves so far
+// which has not reported on it yet, the deployment is marked running first
+// so that a crash halfway leaves it to recovery rather than dispatching it
+// twice
+func (s *Server) dispatch(ctx context.Context, id string) {
+	d, err := s.updateDeployment(id, func(d *api.Deployment) error {
+		if d.State != api.DeploymentPending {
+			return fmt.Errorf("deployment %s is %s", d.ID, d.State)
+		}
+		d.State = api.DeploymentRunning
+		return nil
+	})
+	if err != nil {
+		log.Println("Skipped dispatching:", err)
+		return
+	}
+	s.send(ctx, d, dispatchedWorkers(d))
+}
+
+// dispatchWave sends a running deployment to the workers of its next wave
+func (s *Server) dispatchWave(ctx context.Context, id string) {
+	d, err := s.updateDeployment(id, func(d *api.Deployment) error {
+		if !waveDue(d, time.Now()) {
+			return fmt.Errorf("wave %d of deployment %s is not due", d.Wave+1, d.ID)
+		}
+		d.NextWaveAt = nil
+		d.Message = fmt.Sprintf("wave %d of %d in progress", d.Wave+1, len(d.Waves))
+		return nil
+	})
+	if err != nil {
+		log.Println("Skipped dispatching:", err)
+		return
+	}
+	s.send(ctx, d, d.Waves[d.Wave])
+}
+
+// send hands a deployment over to the given workers, except those which
+// reported on it already. The deployment fails if a worker cannot be reached.
+func (s *Server) send(ctx context.Context, d *api.Deployment, workers []string) {
+	for _, name := range workers {
+		if _, reported := d.Resources[name]; reported {
+			continue
+		}
+		callCtx, cancel := context.WithTimeout(ctx, workerTimeout)
+		err := s.sendToWorker(callCtx, name, d)
+		cancel()
+		if err != nil {
+			log.Println("Failed to dispatch deployment", d.ID, "to", name, ":", err)
+			s.logf(d.ID, "failed to dispatch to worker %s: %v", name, err)
+			s.updateDeployment(d.ID, func(d *api.Deployment) error {
+				d.State = api.DeploymentFailed
+				d.Message = fmt.Sprintf("failed to dispatch to worker %s: %v", name, err)
+				return nil
+			})
+			return
+		}
+	}
+	log.Println("Dispatched deployment", d.ID, "to", workers)
+	s.logf(d.ID, "dispatched to workers %v", workers)
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	"github.com/beacon/deployer/pkg/cron"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindSchedules = "schedules"
+
+// maxScheduleHistory is how many runs are kept per schedule
+const maxScheduleHistory = 50
+
+// missedAfter is how late a run may be noticed before it counts as missed,
+// runs are checked every scheduleInterval by the leader
+const missedAfter = time.Minute
+
+// maxCatchUpRuns is how many missed runs the all catch-up policy fires at
+// most, the older ones are skipped
+const maxCatchUpRuns = 5
+
+// scheduleState is the stored document tracking a schedule
+type scheduleState struct {
+	Paused bool `json:"paused"`
+	// Checked is the time up to which runs have been handled
+	Checked time.Time `json:"checked"`
+	// Pending are runs claimed to fire whose deployment may not exist yet,
+	// they are fired again after a crash or a change of leader
+	Pending []time.Time       `json:"pending,omitempty"`
+	History []api.ScheduleRun `json:"history,omitempty"`
+}
+
+func (s *Server) scheduleConfig(name string) (*config.ScheduleConfig, bool) {
+	cfg := s.config()
+	for i := range cfg.Schedules {
+		if cfg.Schedules[i].Name == name {
+			return &cfg.Schedules[i], true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) getScheduleState(name string) (*scheduleState, error) {
+	state := &scheduleState{}
+	if err := s.store.Get(kindSchedules, name, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// updateScheduleState applies fn to the stored state of a schedule, a new
+// state is checked from now on
+func (s *Server) updateScheduleState(name string, fn func(state *scheduleState) error) (*scheduleState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.getScheduleState(name)
+	if err == store.ErrNotFound {
+		state, err = &scheduleState{Checked: time.Now()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(state); err != nil {
+		return nil, err
+	}
+	if len(state.History) > maxScheduleHistory {
+		state.History = state.History[len(state.History)-maxScheduleHistory:]
+	}
+	if err := s.store.Put(kindSchedules, name, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// parseSchedule returns the cron schedule and location of a schedule,
+// config validation makes sure both parse
+func parseSchedule(sc *config.ScheduleConfig) (*cron.Schedule, *time.Location, error) {
+	sched, err := cron.Parse(sc.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := time.UTC
+	if sc.Timezone != "" {
+		if loc, err = time.LoadLocation(sc.Timezone); err != nil {
+			return nil, nil, err
+		}
+	}
+	return sched, loc, nil
+}
+
+// runSchedules fires the runs of every schedule which are due at now
+func (s *Server) runSchedules(now time.Time) {
+	cfg := s.config()
+	for i := range cfg.Schedules {
+		if !s.isLeader() {
+			return
+		}
+		sc := &cfg.Schedules[i]
+		if err := s.runSchedule(sc, now); err != nil {
+			log.Println("Failed to run schedule", sc.Name, ":", err)
+		}
+	}
+}
+
+// runSchedule fires the runs of a schedule due at now. Runs are claimed
+// before they fire, and fire idempotently, so that a crash or a new leader
+// in between fires each run once.
+func (s *Server) runSchedule(sc *config.ScheduleConfig, now time.Time) error {
+	sched, loc, err := parseSchedule(sc)
+	if err != nil {
+		return err
+	}
+	var claimed []time.Time
+	_, err = s.updateScheduleState(sc.Name, func(state *scheduleState) error {
+		if state.Paused {
+			return nil
+		}
+		var due []time.Time
+		for t := sched.Next(state.Checked.In(loc)); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+			due = append(due, t)
+		}
+		if len(due) > maxScheduleHistory {
+			due = due[len(due)-maxScheduleHistory:]
+		}
+		missed := 0
+		for _, t := range due {
+			if now.Sub(t) > missedAfter {
+				missed++
+			}
+		}
+		for i, t := range due {
+			last := i == len(due)-1
+			fire := now.Sub(t) <= missedAfter || (last && sc.CatchUp != config.CatchUpSkip)
+			message := fmt.Sprintf("missed, catch-up policy is %s", catchUp(sc))
+			if !fire && sc.CatchUp == config.CatchUpAll {
+				// Only the latest missed runs are caught up
+				fire = missed-i <= maxCatchUpRuns
+				message = fmt.Sprintf("missed, catch-up fires the last %d missed runs at most", maxCatchUpRuns)
+			}
+			if !fire {
+				state.History = append(state.History, api.ScheduleRun{
+					Time:    t,
+					Status:  api.ScheduleRunSkipped,
+					Message: message,
+				})
+				continue
+			}
+			state.Pending = append(state.Pending, t)
+		}
+		if now.After(state.Checked) {
+			state.Checked = now
+		}
+		claimed = append(claimed, state.Pending...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range claimed {
+		run := s.fireSchedule(sc, t)
+		_, err := s.updateScheduleState(sc.Name, func(state *scheduleState) error {
+			pending := state.Pending[:0]
+			for _, p := range state.Pending {
+				if !p.Equal(t) {
+					pending = append(pending, p)
+				}
+			}
+			state.Pending = pending
+			// A run fired again replaces its earlier record
+			history := state.History[:0]
+			for _, h := range state.History {
+				if !h.Time.Equal(t) {
+					history = append(history, h)
+				}
+			}
+			state.History = append(history, run)
+			sort.SliceStable(state.History, func(i, j int) bool {
+				return state.History[i].Time.Before(state.History[j].Time)
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fireSchedule creates the deployment of a run due at t, a run fired again
+// returns the deployment it created the first time
+func (s *Server) fireSchedule(sc *config.ScheduleConfig, t time.Time) api.ScheduleRun {
+	run := api.ScheduleRun{Time: t}
+	action := &api.Action{
+		Action:  api.ActionDeploy,
+		Target:  sc.Target,
+		Env:     sc.Env,
+		Values:  sc.Values,
+		Workers: sc.Workers,
+	}
+	key := submissionKey("schedule:"+sc.Name, t.UTC().Format(time.RFC3339))
+	digest := actionDigest(action)
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+	d, err := s.replay(key, digest, time.Now())
+	if err == nil && d == nil {
+		if d, err = s.createDeployment(action); err == nil {
+			s.remember(key, digest, d)
+			s.logf(d.ID, "triggered by schedule %s due at %s", sc.Name, t.Format(time.RFC3339))
+		}
+	}
+	if err != nil {
+		log.Println("Schedule", sc.Name, "failed to create deployment:", err)
+		run.Status = api.ScheduleRunFailed
+		run.Message = err.Error()
+		return run
+	}
+	run.Status = api.ScheduleRunStarted
+	run.Deployment = d.ID
+	return run
+}
+
+func catchUp(sc *config.ScheduleConfig) string {
+	if sc.CatchUp == "" {
+		return config.CatchUpOnce
+	}
+	return sc.CatchUp
+}
+
+// describeSchedule describes a schedule with its next n runs
+func (s *Server) describeSchedule(sc *config.ScheduleConfig, n int, history bool) (*api.Schedule, error) {
+	state, err := s.getScheduleState(sc.Name)
+	if err == store.ErrNotFound {
+		state, err = &scheduleState{Checked: time.Now()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &api.Schedule{
+		Name:     sc.Name,
+		Cron:     sc.Cron,
+		Timezone: sc.Timezone,
+		CatchUp:  catchUp(sc),
+		Target:   sc.Target,
+		Env:      sc.Env,
+		Values:   sc.Values,
+		Workers:  sc.Workers,
+		Paused:   state.Paused,
+		NextRuns: []time.Time{},
+	}
+	for i := len(state.History) - 1; i >= 0; i-- {
+		if state.History[i].Status == api.ScheduleRunStarted {
+			result.LastRun = &state.History[i].Time
+			break
+		}
+	}
+	if history {
+		result.History = state.History
+	}
+	sched, loc, err := parseSchedule(sc)
+	if err != nil {
+		return nil, err
+	}
+	from := time.Now()
+	if state.Checked.After(from) {
+		from = state.Checked
+	}
+	for t := sched.Next(from.In(loc)); !t.IsZero() && len(result.NextRuns) < n; t = sched.Next(t) {
+		result.NextRuns = append(result.NextRuns, t)
+	}
+	return result, nil
+}
+
+// nextRuns reads how many next runs to show from the "next" query
+func nextRuns(c *gin.Context) int {
+	n, err := strconv.Atoi(c.DefaultQuery("next", "3"))
+	if err != nil || n < 0 {
+		return 3
+	}
+	if n > 100 {
+		return 100
+	}
+	return n
+}
+
+func (s *Server) listSchedulesHandler(c *gin.Context) {
+	cfg := s.config()
+	schedules := make([]*api.Schedule, 0, len(cfg.Schedules))
+	for i := range cfg.Schedules {
+		sched, err := s.describeSchedule(&cfg.Schedules[i], nextRuns(c), false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		schedules = append(schedules, sched)
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+func (s *Server) getScheduleHandler(c *gin.Context) {
+	sc, ok := s.scheduleConfig(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+	sched, err := s.describeSchedule(sc, nextRuns(c), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sched)
+}
+
+func (s *Server) pauseScheduleHandler(c *gin.Context) {
+	s.setPaused(c, true)
+}
+
+func (s *Server) resumeScheduleHandler(c *gin.Context) {
+	s.setPaused(c, false)
+}
+
+// setPaused pauses or resumes a schedule, runs due while a schedule was
+// paused do not fire once it resumes
+func (s *Server) setPaused(c *gin.Context, paused bool) {
+	sc, ok := s.scheduleConfig(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+	_, err := s.updateScheduleState(sc.Name, func(state *scheduleState) error {
+		if state.Paused && !paused {
+			state.Checked = time.Now()
+		}
+		state.Paused = paused
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if paused {
+		log.Println("Schedule", sc.Name, "paused by", caller(c))
+	} else {
+		log.Println("Schedule", sc.Name, "resumed by", caller(c))
+	}
+	sched, err := s.describeSchedule(sc, nextRuns(c), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sched)
+}
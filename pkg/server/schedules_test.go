@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+)
+
+func TestScheduleCatchUp(t *testing.T) {
+	now := time.Date(2020, 5, 15, 10, 33, 20, 0, time.UTC)
+	for policy, want := range map[string]int{
+		config.CatchUpSkip: 0,
+		config.CatchUpOnce: 1,
+		config.CatchUpAll:  maxCatchUpRuns,
+	} {
+		s := New(&config.Config{Schedules: []config.ScheduleConfig{{
+			Name:    "every-5-minutes",
+			Cron:    "*/5 * * * *",
+			CatchUp: policy,
+			Target:  "web",
+			Workers: []string{"w1"},
+		}}})
+		// The server was down for an hour
+		s.store.Put(kindSchedules, "every-5-minutes", &scheduleState{Checked: now.Add(-time.Hour)})
+		if err := s.runSchedule(&s.cfg.Schedules[0], now); err != nil {
+			t.Fatal(err)
+		}
+		deployments, _ := s.listDeployments()
+		if len(deployments) != want {
+			t.Errorf("%s: expected %d deployments, got %d", policy, want, len(deployments))
+		}
+		state, _ := s.getScheduleState("every-5-minutes")
+		if len(state.History) != 12 {
+			t.Errorf("%s: expected 12 runs in history, got %d", policy, len(state.History))
+		}
+
+		// Runs claimed before a crash fire again without deploying twice
+		if want > 0 {
+			state.Pending = []time.Time{state.History[11].Time}
+			s.store.Put(kindSchedules, "every-5-minutes", state)
+			if err := s.runSchedule(&s.cfg.Schedules[0], now); err != nil {
+				t.Fatal(err)
+			}
+			deployments, _ = s.listDeployments()
+			if len(deployments) != want {
+				t.Errorf("%s: expected a claimed run not to deploy twice, got %d deployments", policy, len(deployments))
+			}
+			state, _ = s.getScheduleState("every-5-minutes")
+			if len(state.Pending) != 0 || len(state.History) != 12 {
+				t.Errorf("%s: expected the claimed run to be recorded, got %+v", policy, state)
+			}
+		}
+
+		// A run due since the last check fires whatever the policy
+		if err := s.runSchedule(&s.cfg.Schedules[0], now.Add(2*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		deployments, _ = s.listDeployments()
+		if len(deployments) != want+1 {
+			t.Errorf("%s: expected the due run to fire, got %d deployments", policy, len(deployments))
+		}
+	}
+}
+
+func TestSchedulesAPI(t *testing.T) {
+	s := New(&config.Config{Schedules: []config.ScheduleConfig{{
+		Name:    "nightly",
+		Cron:    "0 2 * * *",
+		Target:  "web",
+		Env:     "staging",
+		Workers: []string{"w1"},
+	}}})
+	var schedules []api.Schedule
+	if code := call(t, s, "GET", "/schedules?next=2", "", &schedules); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(schedules) != 1 || len(schedules[0].NextRuns) != 2 || schedules[0].NextRuns[0].Hour() != 2 {
+		t.Fatalf("unexpected schedules %+v", schedules)
+	}
+
+	var sched api.Schedule
+	call(t, s, "POST", "/schedules/nightly/pause", "", &sched)
+	if !sched.Paused {
+		t.Error("expected schedule to be paused")
+	}
+	state, _ := s.getScheduleState("nightly")
+	state.Checked = state.Checked.Add(-48 * time.Hour)
+	s.store.Put(kindSchedules, "nightly", state)
+	s.runSchedules(time.Now())
+	if deployments, _ := s.listDeployments(); len(deployments) != 0 {
+		t.Errorf("expected paused schedule not to fire, got %d deployments", len(deployments))
+	}
+
+	// Runs due while paused are not caught up
+	call(t, s, "POST", "/schedules/nightly/resume", "", &sched)
+	s.runSchedules(time.Now())
+	if deployments, _ := s.listDeployments(); sched.Paused || len(deployments) != 0 {
+		t.Errorf("expected resumed schedule to wait for its next run, got %d deployments", len(deployments))
+	}
+	if code := call(t, s, "GET", "/schedules/weekly", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/secrets"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindSecrets = "secrets"
+
+// secretName keeps names usable as {{ secret "name" }} and in store keys
+var secretName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// storedSecret is the stored document of a secret, Sealed is its encrypted
+// value
+type storedSecret struct {
+	api.Secret
+	Sealed string `json:"sealed"`
+}
+
+// secretKey is the store key of a secret, values are sealed for it too so
+// that a value copied to another secret does not open
+func secretKey(project, env, name string) string {
+	return project + "/" + env + "/" + name
+}
+
+func (s *Server) listSecrets(project string) ([]*storedSecret, error) {
+	keys, err := s.store.List(kindSecrets)
+	if err != nil {
+		return nil, err
+	}
+	var list []*storedSecret
+	for _, key := range keys {
+		secret := &storedSecret{}
+		if err := s.store.Get(kindSecrets, key, secret); err == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if project == "" || secret.Project == project {
+			list = append(list, secret)
+		}
+	}
+	return list, nil
+}
+
+func (s *Server) openSecret(secret *storedSecret) (string, error) {
+	return s.secrets.Open(secret.Sealed, secretKey(secret.Project, secret.Env, secret.Name))
+}
+
+// secretValues returns the secrets of a project in env, secrets of the
+// environment override the ones of the whole project
+func (s *Server) secretValues(project, env string) (map[string]string, error) {
+	values := make(map[string]string)
+	if s.secrets == nil {
+		return values, nil
+	}
+	list, err := s.listSecrets(project)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Env == "" && list[j].Env != "" })
+	for _, secret := range list {
+		if secret.Env != "" && secret.Env != env {
+			continue
+		}
+		value, err := s.openSecret(secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open secret %s of %s:%v", secret.Name, secret.Project, err)
+		}
+		values[secret.Name] = value
+	}
+	return values, nil
+}
+
+// maskerTTL bounds how long secrets set through other replicas may go
+// unmasked, secrets set through this one are masked at once
+const maskerTTL = time.Minute
+
+// masker hides the values of every secret, whatever their project, in log
+// lines. It is built once and again when secrets change, since it opens
+// every secret. When secrets cannot be read the last masker built is kept,
+// and without one the error is returned: nothing may be written or served
+// unmasked.
+func (s *Server) masker() (*secrets.Masker, error) {
+	if s.secrets == nil {
+		return nil, nil
+	}
+	s.maskerMu.Lock()
+	defer s.maskerMu.Unlock()
+	if s.maskerCache != nil && time.Since(s.maskerBuilt) < maskerTTL {
+		return s.maskerCache, nil
+	}
+	values, err := s.maskedValues()
+	if err != nil {
+		if s.maskerCache == nil {
+			return nil, err
+		}
+		log.Println("Failed to read secrets to mask, masking the ones known before:", err)
+		return s.maskerCache, nil
+	}
+	s.maskerValues = values
+	s.maskerCache, s.maskerBuilt = secrets.NewMasker(values...), time.Now()
+	return s.maskerCache, nil
+}
+
+// maskedValues reads the value of every secret
+func (s *Server) maskedValues() ([]string, error) {
+	list, err := s.listSecrets("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets:%v", err)
+	}
+	values := make([]string, 0, len(list))
+	for _, secret := range list {
+		value, err := s.openSecret(secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open secret %s of %s:%v", secret.Name, secret.Project, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// forgetMasker has the next masker built again, after secrets changed. The
+// values set are masked at once, in case secrets cannot be read then.
+func (s *Server) forgetMasker(set ...string) {
+	s.maskerMu.Lock()
+	defer s.maskerMu.Unlock()
+	if len(set) > 0 {
+		s.maskerValues = append(s.maskerValues, set...)
+		s.maskerCache = secrets.NewMasker(s.maskerValues...)
+	}
+	s.maskerBuilt = time.Time{}
+}
+
+// canReadSecrets reports whether the caller may read secret values, only
+// tokens allowed to may. Nobody may when auth is not configured, since
+// anyone reaching the server would otherwise read every secret.
+func (s *Server) canReadSecrets(c *gin.Context) bool {
+	auth := s.config().Auth
+	if auth == nil {
+		return false
+	}
+	name := caller(c)
+	for _, t := range auth.Tokens {
+		if t.Name == name && t.Secrets {
+			return true
+		}
+	}
+	return false
+}
+
+// secretsEnabled answers requests with an error when no key is configured
+func (s *Server) secretsEnabled(c *gin.Context) bool {
+	if s.secrets == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "secrets are not configured on the server"})
+		return false
+	}
+	return true
+}
+
+func (s *Server) listSecretsHandler(c *gin.Context) {
+	if !s.secretsEnabled(c) {
+		return
+	}
+	list, err := s.listSecrets(c.Param("project"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	env, filter := c.GetQuery("env")
+	result := make([]api.Secret, 0, len(list))
+	for _, secret := range list {
+		if filter && secret.Env != "" && secret.Env != env {
+			continue
+		}
+		result = append(result, secret.Secret)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Env < result[j].Env
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) getSecretValuesHandler(c *gin.Context) {
+	if !s.secretsEnabled(c) {
+		return
+	}
+	if !s.canReadSecrets(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "reading secret values needs a token allowed to read secrets"})
+		return
+	}
+	project, env := c.Param("project"), c.Query("env")
+	values, err := s.secretValues(project, env)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Println("Secrets of", project, "in", envName(env), "read by", caller(c))
+	c.JSON(http.StatusOK, values)
+}
+
+func (s *Server) putSecretHandler(c *gin.Context) {
+	if !s.secretsEnabled(c) {
+		return
+	}
+	var value api.SecretValue
+	if err := c.ShouldBindJSON(&value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project, name := c.Param("project"), c.Param("name")
+	if !secretName.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid secret name %q", name)})
+		return
+	}
+	key := secretKey(project, value.Env, name)
+	sealed, err := s.secrets.Seal(value.Value, key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	secret := &storedSecret{
+		Secret: api.Secret{
+			Project:   project,
+			Env:       value.Env,
+			Name:      name,
+			UpdatedBy: caller(c),
+			UpdatedAt: time.Now(),
+		},
+		Sealed: sealed,
+	}
+	if err := s.store.Put(kindSecrets, key, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.forgetMasker(value.Value)
+	log.Println("Secret", name, "of", project, "in", envName(value.Env), "set by", secret.UpdatedBy)
+	c.JSON(http.StatusOK, secret.Secret)
+}
+
+func (s *Server) deleteSecretHandler(c *gin.Context) {
+	if !s.secretsEnabled(c) {
+		return
+	}
+	project, name, env := c.Param("project"), c.Param("name"), c.Query("env")
+	key := secretKey(project, env, name)
+	if err := s.store.Get(kindSecrets, key, &storedSecret{}); err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "secret not found"})
+		return
+	}
+	if err := s.store.Delete(kindSecrets, key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.forgetMasker()
+	log.Println("Secret", name, "of", project, "in", envName(env), "deleted by", caller(c))
+	c.Status(http.StatusNoContent)
+}
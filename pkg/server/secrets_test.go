@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	"github.com/beacon/deployer/pkg/secrets"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+func newSecretsServer(t *testing.T, workers *fakeWorkers) *Server {
+	s := newRolloutServer(t, workers)
+	box, err := secrets.NewBox(make([]byte, secrets.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithSecrets(box)(s)
+	return s
+}
+
+func TestSecrets(t *testing.T) {
+	workers := &fakeWorkers{}
+	s := newSecretsServer(t, workers)
+	for _, body := range []struct{ name, body string }{
+		{"db_password", `{"value":"everywhere"}`},
+		{"db_password", `{"env":"prod","value":"s3cr3t-prod"}`},
+		{"api_key", `{"value":"k3y"}`},
+	} {
+		if code := call(t, s, "PUT", "/secrets/web/"+body.name, body.body, nil); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+	}
+	if code := call(t, s, "PUT", "/secrets/web/bad%20name", `{"value":"x"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected invalid names to be rejected, got %d", code)
+	}
+
+	var list []api.Secret
+	call(t, s, "GET", "/secrets/web?env=dev", "", &list)
+	if len(list) != 2 {
+		t.Errorf("expected the 2 secrets applying to dev, got %v", list)
+	}
+	values, _ := s.secretValues("web", "prod")
+	if values["db_password"] != "s3cr3t-prod" || values["api_key"] != "k3y" {
+		t.Errorf("unexpected values %v", values)
+	}
+	stored := &storedSecret{}
+	s.store.Get(kindSecrets, secretKey("web", "prod", "db_password"), stored)
+	if stored.Sealed == "" || strings.Contains(stored.Sealed, "s3cr3t") {
+		t.Errorf("expected the value to be stored encrypted, got %q", stored.Sealed)
+	}
+
+	// Deployments carry their secrets to workers and mask them in logs
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","env":"prod","workers":["w1"]}`, &d)
+	s.schedule(context.Background())
+	if workers.secrets["db_password"] != "s3cr3t-prod" {
+		t.Errorf("expected secrets to be sent to the worker, got %v", workers.secrets)
+	}
+	call(t, s, "POST", "/deployments/"+d.ID+"/logs", `[{"source":"w1","line":"connecting with s3cr3t-prod"}]`, nil)
+	entries, _ := s.getLog(d.ID)
+	if line := entries[len(entries)-1].Line; line != "connecting with "+secrets.Mask {
+		t.Errorf("expected the secret to be masked, got %q", line)
+	}
+	// Secrets set afterwards are masked as well
+	call(t, s, "PUT", "/secrets/web/token", `{"value":"t0ken"}`, nil)
+	call(t, s, "POST", "/deployments/"+d.ID+"/logs", `[{"source":"w1","line":"using t0ken"}]`, nil)
+	entries, _ = s.getLog(d.ID)
+	if line := entries[len(entries)-1].Line; line != "using "+secrets.Mask {
+		t.Errorf("expected the new secret to be masked, got %q", line)
+	}
+
+	if code := call(t, s, "DELETE", "/secrets/web/db_password?env=prod", "", nil); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if code := call(t, s, "DELETE", "/secrets/web/db_password?env=prod", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+}
+
+func TestSecretsAccess(t *testing.T) {
+	if code := call(t, newRolloutServer(t, &fakeWorkers{}), "GET", "/secrets/web", "", nil); code != http.StatusNotImplemented {
+		t.Errorf("expected secrets to be disabled without a key, got %d", code)
+	}
+
+	s := newSecretsServer(t, &fakeWorkers{})
+	call(t, s, "PUT", "/secrets/web/db_password", `{"value":"s3cr3t"}`, nil)
+	if code := call(t, s, "GET", "/secrets/web/values", "", nil); code != http.StatusForbidden {
+		t.Errorf("expected values not to be readable without auth, got %d", code)
+	}
+	s.cfg.Auth = &config.AuthConfig{Tokens: []config.TokenConfig{
+		{Name: "ci", Token: "ci-token"},
+		{Name: "render", Token: "render-token", Secrets: true},
+	}}
+	for token, expected := range map[string]int{"ci-token": http.StatusForbidden, "render-token": http.StatusOK} {
+		req := httptest.NewRequest("GET", "/secrets/web/values", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("token %s: expected %d, got %d", token, expected, w.Code)
+		}
+	}
+}
+
+// failingStore fails listing secrets while fail is set
+type failingStore struct {
+	store.Store
+	fail bool
+}
+
+func (f *failingStore) List(kind string) ([]string, error) {
+	if f.fail && kind == kindSecrets {
+		return nil, errors.New("store unavailable")
+	}
+	return f.Store.List(kind)
+}
+
+func TestMaskerFailsClosed(t *testing.T) {
+	s := newSecretsServer(t, &fakeWorkers{})
+	st := &failingStore{Store: s.store, fail: true}
+	s.store = st
+
+	// Without a masker built yet, lines are not written nor served
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"]}`, &d)
+	s.logf(d.ID, "written unmasked")
+	if code := call(t, s, "GET", "/deployments/"+d.ID+"/logs", "", nil); code != http.StatusInternalServerError {
+		t.Errorf("expected logs not to be served unmasked, got %d", code)
+	}
+	if entries, _ := s.getLog(d.ID); len(entries) != 0 {
+		t.Fatalf("expected no line to be written unmasked, got %+v", entries)
+	}
+
+	// Once built, the values known are masked, the ones set since included
+	st.fail = false
+	s.logf(d.ID, "built")
+	call(t, s, "PUT", "/secrets/web/db_password", `{"value":"s3cr3t"}`, nil)
+	st.fail = true
+	s.logf(d.ID, "connecting with s3cr3t")
+	entries, _ := s.getLog(d.ID)
+	if line := entries[len(entries)-1].Line; line != "connecting with "+secrets.Mask {
+		t.Errorf("expected the secret masked with the values known, got %q", line)
+	}
+}
@@ -2,43 +2,209 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/blob"
 	"github.com/beacon/deployer/pkg/config"
 	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/secrets"
+	"github.com/beacon/deployer/pkg/store"
 )
 
 //go:generate protoc -I ../proto --go_out=plugins=grpc:../proto ../proto/proto.proto
 
 // Server for grpc
 type Server struct {
+	// cfg is replaced as a whole when the config is reloaded, read it
+	// through config()
+	cfgMu sync.RWMutex
+	cfg   *config.Config
+	// cert is the certificate served with TLS, reloaded with the config
+	certMu sync.RWMutex
+	cert   *tls.Certificate
+
 	srv    *http.Server
 	rpcSrv *grpc.Server
 
 	restful *gin.Engine
+
+	store   store.Store
+	workers WorkerClient
+	// secrets seals secret values, secrets are disabled when nil
+	secrets *secrets.Box
+	// blobs keeps files of deployments, they are disabled when nil
+	blobs *blob.Store
+	// debug is 1 when the log level is debug, requests are logged then
+	debug int32
+	// blobMu serializes touching blobs deployments reference with removing
+	// them, so that a blob checked is not removed before it is referenced
+	blobMu sync.Mutex
+	// lastGC is when the scheduler last collected blobs
+	lastGC time.Time
+	// lastKeyPrune is when the scheduler last removed expired idempotency
+	// keys
+	lastKeyPrune time.Time
+
+	// mu serializes read-modify-write cycles on stored deployments
+	mu sync.Mutex
+	// logMu guards logStates, kept for the deployment logs appended to or
+	// followed
+	logMu     sync.Mutex
+	logStates map[string]*logState
+	// maskerCache hides maskerValues in logs, read from secrets at
+	// maskerBuilt
+	maskerMu     sync.Mutex
+	maskerCache  *secrets.Masker
+	maskerValues []string
+	maskerBuilt  time.Time
+	// keyMu serializes submissions carrying an idempotency key, so that
+	// concurrent retries create a single deployment
+	keyMu sync.Mutex
+
+	// id names this replica when several share the store
+	id     string
+	leader leadership
+
+	// stopMu orders inflight.Add before the close of stop, Shutdown only
+	// waits for requests once no more can be tracked
+	stopMu    sync.RWMutex
+	inflight  sync.WaitGroup
+	startOnce sync.Once
+	stop      chan struct{}
+	loops     sync.WaitGroup
+
+	// verifying holds the deployment/worker pairs being probed
+	verifyMu  sync.Mutex
+	verifying map[string]bool
+
+	// driftMu serializes read-modify-write cycles on drift records
+	driftMu sync.Mutex
+}
+
+// Option customizes a Server
+type Option func(*Server)
+
+// WithStore keeps server state in st instead of memory
+func WithStore(st store.Store) Option {
+	return func(s *Server) {
+		s.store = st
+	}
+}
+
+// WithSecrets enables secrets, sealing them with box
+func WithSecrets(box *secrets.Box) Option {
+	return func(s *Server) {
+		s.secrets = box
+	}
+}
+
+// WithBlobs enables files referenced by digest, kept in st
+func WithBlobs(st *blob.Store) Option {
+	return func(s *Server) {
+		s.blobs = st
+	}
+}
+
+// WithWorkerClient replaces the gRPC client used to talk to workers
+func WithWorkerClient(c WorkerClient) Option {
+	return func(s *Server) {
+		s.workers = c
+	}
 }
 
 func (s *Server) UpdateDeployStatus(ctx context.Context, status *pb.DeployStatus) (*pb.Reply, error) {
+	if !s.isLeader() {
+		return s.forwardStatus(ctx, status)
+	}
+	_, err := s.updateDeployment(status.Id, func(d *api.Deployment) error {
+		if !d.State.Terminal() {
+			recordStatus(d, status.Worker, status.Resources, status.Steps)
+		}
+		return nil
+	})
+	if err == nil {
+		s.logf(status.Id, "worker %s reported %v", status.Worker, status.Resources)
+		for _, step := range status.Steps {
+			switch {
+			case step.Message == "":
+			case step.Attempts == 0:
+				s.logf(status.Id, "worker %s step %s %s", status.Worker, step.Name, step.Message)
+			default:
+				s.logf(status.Id, "worker %s step %s attempt %d: %s", status.Worker, step.Name, step.Attempts, step.Message)
+			}
+		}
+	}
+	if err == store.ErrNotFound {
+		return &pb.Reply{
+			Code:    404,
+			Message: "deployment not found",
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 	return &pb.Reply{
 		Code:    200,
 		Message: "OK",
 	}, nil
 }
 
-func New(cfg *config.Config) *Server {
-	rpcSrv := grpc.NewServer()
+func New(cfg *config.Config, opts ...Option) *Server {
+	limits := cfg.Limits
+	if limits == nil {
+		limits = &config.LimitsConfig{}
+	}
 	s := &Server{
-		rpcSrv:  rpcSrv,
+		cfg:     cfg,
 		restful: gin.New(),
+		stop:    make(chan struct{}),
+
+		verifying: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.setLogLevel(cfg.LogLevel)
+	if s.store == nil {
+		s.store = store.NewMemory()
+	}
+	if s.workers == nil {
+		s.workers = newRPCWorkerClient(func() *config.TLSConfig { return s.config().TLS })
 	}
+	if cfg.HA != nil {
+		s.id = cfg.HA.ID
+		if s.id == "" {
+			s.id = replicaID()
+		}
+	}
+
+	limiter := newRateLimiter(limits.RatePerSecond, limits.Burst)
+	auth := func() *config.AuthConfig { return s.config().Auth }
+	rpcOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.trackUnary, rpcUnaryInterceptor(limiter, auth), s.authUnary),
+		grpc.ChainStreamInterceptor(s.trackStream, rpcStreamInterceptor(limiter, auth), s.authStream),
+	}
+	if limits.MaxMsgBytes > 0 {
+		rpcOpts = append(rpcOpts, grpc.MaxRecvMsgSize(limits.MaxMsgBytes))
+	}
+	rpcSrv := grpc.NewServer(rpcOpts...)
+	s.rpcSrv = rpcSrv
+	s.restful.Use(restfulRecovery(), restfulLimits(limits, limiter, auth), s.restfulAuth, s.forwardWrites)
 	if cfg.TLS == nil {
 		h2Srv := &http2.Server{}
 
@@ -60,23 +226,94 @@ func New(cfg *config.Config) *Server {
 }
 
 func (s *Server) ListenAndServe(cfg *config.Config) error {
+	s.start()
 	if cfg.TLS == nil {
 		log.Println("NextProto:", s.srv.TLSNextProto)
 		log.Println("TLS:", s.srv.TLSConfig)
 		return s.srv.ListenAndServe()
 	} else {
-		return s.srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err := s.loadCertificate(cfg.TLS); err != nil {
+			return err
+		}
+		// The certificate is looked up on every handshake so that reloading
+		// the config renews it without a restart
+		s.srv.TLSConfig = &tls.Config{GetCertificate: s.getCertificate}
+		return s.srv.ListenAndServeTLS("", "")
 	}
 }
 
+// config returns the config in effect, it changes when reloaded
+func (s *Server) config() *config.Config {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.cfg
+}
+
+func (s *Server) loadCertificate(tlsCfg *config.TLSConfig) error {
+	cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate:%v", err)
+	}
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+	s.cert = &cert
+	return nil
+}
+
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.certMu.RLock()
+	defer s.certMu.RUnlock()
+	return s.cert, nil
+}
+
+// start recovers deployments left by a previous process and runs the
+// scheduler, with HA only once this replica is elected leader
+func (s *Server) start() {
+	s.startOnce.Do(func() {
+		s.loops.Add(1)
+		go func() {
+			defer s.loops.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				<-s.stop
+				cancel()
+			}()
+			if s.config().HA != nil {
+				s.runElection(ctx)
+				return
+			}
+			s.recoverDeployments(ctx)
+			s.runScheduler(ctx)
+		}()
+	})
+}
+
+// setLogLevel applies the log level of the config, info if empty
+func (s *Server) setLogLevel(level string) {
+	var debug int32
+	if level == config.LogDebug {
+		debug = 1
+	}
+	atomic.StoreInt32(&s.debug, debug)
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request, uri=", r.RequestURI, "method=", r.Method)
+	debug := atomic.LoadInt32(&s.debug) == 1
+	if debug {
+		// The query is not logged, it may hold an access_token
+		log.Println("Received request, path=", r.URL.Path, "method=", r.Method)
+	}
 	if r.ProtoMajor == 2 && strings.HasPrefix(
 		r.Header.Get("Content-Type"), "application/grpc") {
-		log.Println("Request handled by grpc")
+		if debug {
+			log.Println("Request handled by grpc")
+		}
 		s.rpcSrv.ServeHTTP(w, r)
 	} else {
-		log.Println("Request handled by restful")
+		if debug {
+			log.Println("Request handled by restful")
+		}
 		s.restful.ServeHTTP(w, r)
 	}
 }
@@ -86,16 +323,140 @@ func (s *Server) routeRestful() {
 		g := s.restful.Group("/actions")
 		g.POST("", s.postAction)
 	}
+	{
+		g := s.restful.Group("/deployments")
+		g.GET("", s.listDeploymentsHandler)
+		g.GET("/:id", s.getDeploymentHandler)
+		g.POST("/:id/approve", s.approveHandler)
+		g.POST("/:id/reject", s.rejectHandler)
+		g.POST("/:id/cancel", s.cancelHandler)
+		g.POST("/:id/pause", s.pauseHandler)
+		g.POST("/:id/resume", s.resumeHandler)
+		g.GET("/:id/logs", s.getLogsHandler)
+		g.POST("/:id/logs", s.postLogsHandler)
+		g.GET("/:id/diff", s.diffHandler)
+		g.POST("/:id/hooks", s.postHookHandler)
+	}
+	{
+		g := s.restful.Group("/workers")
+		g.GET("", s.listWorkersHandler)
+		g.PUT("/:name", s.putWorkerHandler)
+		g.POST("/:name/observations", s.observeHandler)
+	}
+	{
+		g := s.restful.Group("/schedules")
+		g.GET("", s.listSchedulesHandler)
+		g.GET("/:name", s.getScheduleHandler)
+		g.POST("/:name/pause", s.pauseScheduleHandler)
+		g.POST("/:name/resume", s.resumeScheduleHandler)
+	}
+	{
+		g := s.restful.Group("/freezes")
+		g.GET("", s.listFreezesHandler)
+		g.POST("", s.postFreezeHandler)
+		g.DELETE("/:name", s.deleteFreezeHandler)
+	}
+	{
+		g := s.restful.Group("/locks")
+		g.GET("", s.listLocksHandler)
+		g.POST("", s.postLockHandler)
+		g.DELETE("", s.deleteLockHandler)
+	}
+	{
+		g := s.restful.Group("/pipelines")
+		g.GET("", s.listPipelinesHandler)
+		g.GET("/:name", s.getPipelineHandler)
+		g.POST("/:name/promote", s.promoteHandler)
+	}
+	{
+		g := s.restful.Group("/blobs")
+		g.GET("", s.listBlobsHandler)
+		g.POST("", s.postBlobHandler)
+		g.POST("/gc", s.gcBlobsHandler)
+		g.GET("/:digest", s.getBlobHandler)
+		g.HEAD("/:digest", s.getBlobHandler)
+		g.PUT("/:digest", s.putBlobHandler)
+	}
+	{
+		g := s.restful.Group("/secrets")
+		g.GET("/:project", s.listSecretsHandler)
+		g.GET("/:project/values", s.getSecretValuesHandler)
+		g.PUT("/:project/:name", s.putSecretHandler)
+		g.DELETE("/:project/:name", s.deleteSecretHandler)
+	}
+	s.restful.GET("/leader", s.getLeaderHandler)
+	s.restful.GET("/drift", s.listDriftHandler)
+	s.restful.GET("/audit", s.listAuditHandler)
+	s.restful.GET("/metrics", s.metricsHandler)
+	s.restful.GET("/openapi.json", s.getOpenAPIHandler)
+	s.routeRPC()
+	s.routeDashboard()
+}
+
+// track counts a request in flight, unless the server is shutting down
+func (s *Server) track() error {
+	s.stopMu.RLock()
+	defer s.stopMu.RUnlock()
+	select {
+	case <-s.stop:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	default:
+	}
+	s.inflight.Add(1)
+	return nil
 }
 
-func (s *Server) postAction(c *gin.Context) {
-	c.Status(200)
+func (s *Server) trackUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.track(); err != nil {
+		return nil, err
+	}
+	defer s.inflight.Done()
+	return handler(ctx, req)
 }
 
+func (s *Server) trackStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.track(); err != nil {
+		return err
+	}
+	defer s.inflight.Done()
+	return handler(srv, ss)
+}
+
+// Shutdown stops the scheduler and lets in-flight requests finish. Deployment
+// state is persisted in the store, so nothing in flight is lost.
 func (s *Server) Shutdown() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	timeout := time.Duration(s.config().ShutdownTimeout)
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+
+	s.stopMu.Lock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.stopMu.Unlock()
+	s.loops.Wait()
+
 	if err := s.srv.Shutdown(ctx); err != nil {
 		log.Println("Error shutting down:", err)
 	}
+
+	// grpc served through ServeHTTP cannot drain its streams, so wait for
+	// them here and only stop gracefully once none are left
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.rpcSrv.GracefulStop()
+	case <-ctx.Done():
+		log.Println("Timed out waiting for grpc requests, stopping")
+		s.rpcSrv.Stop()
+	}
 }
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+func TestSpecSteps(t *testing.T) {
+	s := newRolloutServer(t, &fakeWorkers{})
+	steps := `{"steps":[{"name":"migrate","executor":"exec"},{"name":"app","executor":"exec","dependsOn":["migrate"]}]}`
+	var d api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"spec":`+steps+`}`, &d); code != http.StatusCreated {
+		t.Fatalf("expected the deployment to be created, got %d", code)
+	}
+	s.schedule(context.Background())
+
+	// A worker reporting the steps as they end is done once all are
+	update := func(resources map[string]pb.ResourceState) *api.Deployment {
+		t.Helper()
+		if _, err := s.UpdateDeployStatus(context.Background(), &pb.DeployStatus{Id: d.ID, Worker: "w1", Resources: resources}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.getDeployment(d.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	got := update(map[string]pb.ResourceState{"step:migrate": pb.ResourceState_RES_SUCCESS})
+	if got.State != api.DeploymentRunning || got.Resources["w1"]["step:app"] != pb.ResourceState_RES_PENDING {
+		t.Fatalf("expected the deployment to wait for step app, got %s %v", got.State, got.Resources)
+	}
+	got = update(map[string]pb.ResourceState{"step:app": pb.ResourceState_RES_SUCCESS})
+	if got.State != api.DeploymentSucceeded || got.Resources["w1"]["step:migrate"] != pb.ResourceState_RES_SUCCESS {
+		t.Fatalf("expected the deployment to succeed, got %s %v", got.State, got.Resources)
+	}
+
+	// Workers which do not run specs report no steps, nothing waits for them
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"spec":`+steps+`}`, &d)
+	s.schedule(context.Background())
+	got = update(map[string]pb.ResourceState{"app": pb.ResourceState_RES_SUCCESS})
+	if got.State != api.DeploymentSucceeded {
+		t.Fatalf("expected a worker reporting no steps to succeed, got %s %v", got.State, got.Resources)
+	}
+
+	cycle := `{"steps":[{"name":"a","executor":"exec","dependsOn":["b"]},{"name":"b","executor":"exec","dependsOn":["a"]}]}`
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"spec":`+cycle+`}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected a spec with a cycle to be refused, got %d", code)
+	}
+	var diff api.Diff
+	other := `{"steps":[{"name":"migrate","executor":"exec"},{"name":"app","executor":"exec"}]}`
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"spec":`+other+`}`, &d)
+	call(t, s, "GET", "/deployments/"+d.ID+"/diff", "", &diff)
+	if len(diff.Spec) != 1 || diff.Spec[0].Path != "steps[1].dependsOn" {
+		t.Errorf("expected the dependency removed to be diffed, got %+v", diff.Spec)
+	}
+}
+
+func TestSpecStepAttempts(t *testing.T) {
+	s := newRolloutServer(t, &fakeWorkers{})
+	steps := `{"steps":[{"name":"fetch","executor":"exec","retries":2},{"name":"lint","executor":"exec","onFailure":"continue"}]}`
+	var d api.Deployment
+	call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"spec":`+steps+`}`, &d)
+	s.schedule(context.Background())
+
+	// Steps alone tell the state of their resources
+	update := func(steps ...*pb.StepStatus) {
+		t.Helper()
+		if _, err := s.UpdateDeployStatus(context.Background(), &pb.DeployStatus{Id: d.ID, Worker: "w1", Steps: steps}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update(&pb.StepStatus{Name: "fetch", State: pb.ResourceState_RES_PENDING, Attempts: 1, Message: "mirror unavailable"},
+		&pb.StepStatus{Name: "lint", State: pb.ResourceState_RES_OTHER, Attempts: 1, Message: "failed after 1 attempt(s): warnings"})
+	update(&pb.StepStatus{Name: "fetch", State: pb.ResourceState_RES_SUCCESS, Attempts: 2})
+	got, err := s.getDeployment(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != api.DeploymentSucceeded {
+		t.Fatalf("expected the ignored failure not to fail the deployment, got %s %v", got.State, got.Resources)
+	}
+	if fetch := got.Steps["w1"]["fetch"]; fetch.Attempts != 2 || fetch.State != pb.ResourceState_RES_SUCCESS {
+		t.Errorf("expected the attempts of fetch to be recorded, got %+v", fetch)
+	}
+	entries, err := s.getLog(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range entries {
+		found = found || strings.Contains(e.Line, "step fetch attempt 1: mirror unavailable")
+	}
+	if !found {
+		t.Errorf("expected the failed attempt to be logged, got %+v", entries)
+	}
+}
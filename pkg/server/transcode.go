@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+// rpcMethod is a grpc method callable with JSON over HTTP
+type rpcMethod struct {
+	request func() proto.Message
+	call    func(ctx context.Context, req proto.Message) (proto.Message, error)
+}
+
+// transcoded lists the methods of the Server service by name, they are
+// served at POST /rpc/Server/<method>
+func (s *Server) transcoded() map[string]rpcMethod {
+	return map[string]rpcMethod{
+		"UpdateDeployStatus": {
+			request: func() proto.Message { return &pb.DeployStatus{} },
+			call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return s.UpdateDeployStatus(ctx, req.(*pb.DeployStatus))
+			},
+		},
+	}
+}
+
+func (s *Server) routeRPC() {
+	g := s.restful.Group("/rpc/Server")
+	for name, m := range s.transcoded() {
+		g.POST("/"+name, transcode(m))
+	}
+}
+
+// transcode decodes a JSON request into the grpc request message, and encodes
+// the reply the way protojson does
+func transcode(m rpcMethod) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req := m.request()
+		if err := protojson.Unmarshal(body, req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		md := metadata.MD{}
+		if auth := c.GetHeader("Authorization"); auth != "" {
+			md.Set("authorization", auth)
+		}
+		if fwd := c.GetHeader(forwardedHeader); fwd != "" {
+			md.Set(forwardedHeader, fwd)
+		}
+		ctx := metadata.NewIncomingContext(c.Request.Context(), md)
+		reply, err := m.call(ctx, req)
+		if err != nil {
+			st := status.Convert(err)
+			c.JSON(httpStatus(st.Code()), gin.H{"error": st.Message()})
+			return
+		}
+		out, err := protojson.Marshal(reply)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/json", out)
+	}
+}
+
+// httpStatus maps grpc codes the way grpc-gateway does
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/verify"
+)
+
+// probePrefix starts the resources recording the probes of a worker
+const probePrefix = "verify:"
+
+func probeResource(name string) string {
+	return probePrefix + name
+}
+
+func isProbeResource(name string) bool {
+	return strings.HasPrefix(name, probePrefix)
+}
+
+func (s *Server) validateVerification(v *api.Verification) error {
+	if v == nil {
+		return nil
+	}
+	if len(v.Probes) == 0 {
+		return fmt.Errorf("verification needs at least one probe")
+	}
+	names := make(map[string]bool, len(v.Probes))
+	for i := range v.Probes {
+		p := &v.Probes[i]
+		if names[p.Name] {
+			return fmt.Errorf("probe %s is defined twice", p.Name)
+		}
+		names[p.Name] = true
+		if err := verify.Validate(p, s.config().AllowExecProbes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startVerifications probes the workers of a running deployment which wait
+// for verification, each worker is verified by a single goroutine. It
+// reports whether any worker is being verified.
+func (s *Server) startVerifications(ctx context.Context, d *api.Deployment) bool {
+	verifying := false
+	for worker, resources := range d.Resources {
+		waiting := false
+		for name, state := range resources {
+			if isProbeResource(name) && state == pb.ResourceState_RES_PENDING {
+				waiting = true
+			}
+		}
+		if !waiting {
+			continue
+		}
+		verifying = true
+		key := d.ID + "/" + worker
+		s.verifyMu.Lock()
+		if s.verifying[key] {
+			s.verifyMu.Unlock()
+			continue
+		}
+		s.verifying[key] = true
+		s.verifyMu.Unlock()
+
+		s.loops.Add(1)
+		go func(worker string) {
+			defer s.loops.Done()
+			defer func() {
+				s.verifyMu.Lock()
+				delete(s.verifying, key)
+				s.verifyMu.Unlock()
+			}()
+			s.verifyWorker(ctx, d, worker)
+		}(worker)
+	}
+	return verifying
+}
+
+// verifyWorker runs the pending probes of a worker in order, stopping at
+// the first failure
+func (s *Server) verifyWorker(ctx context.Context, d *api.Deployment, worker string) {
+	vars := verify.Vars{
+		Deployment: d.ID,
+		Target:     d.Target,
+		Env:        d.Env,
+		Worker:     worker,
+		Values:     d.Values,
+	}
+	if w, err := s.getWorker(worker); err == nil {
+		vars.Addr = w.Addr
+		vars.Host = w.Addr
+		if host, _, err := net.SplitHostPort(w.Addr); err == nil {
+			vars.Host = host
+		}
+	}
+	for i := range d.Verify.Probes {
+		p := &d.Verify.Probes[i]
+		resource := probeResource(p.Name)
+		if d.Resources[worker][resource] != pb.ResourceState_RES_PENDING {
+			continue
+		}
+		err := verify.Run(ctx, p, vars)
+		if ctx.Err() != nil {
+			// Probes left pending run again on the next leader
+			return
+		}
+		state := pb.ResourceState_RES_SUCCESS
+		if err != nil {
+			state = pb.ResourceState_RES_ERROR
+			s.logf(d.ID, "probe %s failed on worker %s: %v", p.Name, worker, err)
+		} else {
+			s.logf(d.ID, "probe %s passed on worker %s", p.Name, worker)
+		}
+		_, uerr := s.updateDeployment(d.ID, func(d *api.Deployment) error {
+			if d.State != api.DeploymentRunning {
+				return fmt.Errorf("deployment %s is %s", d.ID, d.State)
+			}
+			d.Resources[worker][resource] = state
+			evaluate(d)
+			return nil
+		})
+		if uerr != nil {
+			log.Println("Dropped result of probe", p.Name, ":", uerr)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wantsRollback reports whether a failed deployment should be rolled back
+// automatically and has not been yet. Rollbacks are never rolled back
+// themselves.
+func wantsRollback(d *api.Deployment) bool {
+	return d.State == api.DeploymentFailed && d.Verify != nil && d.Verify.AutoRollback &&
+		d.RollbackOf == "" && d.RolledBackBy == "" && d.RollbackError == ""
+}
+
+// autoRollback redeploys the last successful deployment before a failed
+// one, freezes are overridden on behalf of the server. The failed deployment
+// records the rollback before it is created, so that failing to record it
+// afterwards cannot lead the next round to create a second one.
+func (s *Server) autoRollback(failed *api.Deployment) {
+	id := newID()
+	_, err := s.updateDeployment(failed.ID, func(d *api.Deployment) error {
+		if !wantsRollback(d) {
+			return errConflict{fmt.Sprintf("deployment %s needs no rollback", d.ID)}
+		}
+		d.RolledBackBy = id
+		return nil
+	})
+	if err != nil {
+		log.Println("Failed to record rollback of deployment", failed.ID, ":", err)
+		return
+	}
+	previous, err := s.lastSucceeded(failed)
+	var rollback *api.Deployment
+	if err == nil {
+		rollback, err = s.createDeployment(&api.Action{
+			Action:  api.ActionDeploy,
+			Target:  previous.Target,
+			Env:     previous.Env,
+			Values:  previous.Values,
+			Workers: previous.Workers,
+			Rollout: previous.Rollout,
+			Files:   previous.Files,
+			Spec:    previous.Spec,
+			FreezeOverride: &api.FreezeOverride{
+				By:     "deployer",
+				Reason: fmt.Sprintf("automatic rollback of failed deployment %s", failed.ID),
+			},
+		}, func(d *api.Deployment) {
+			d.ID = id
+			d.RollbackOf = failed.ID
+			d.Overlay = previous.Overlay
+		})
+	}
+	if err != nil {
+		_, uerr := s.updateDeployment(failed.ID, func(d *api.Deployment) error {
+			d.RolledBackBy = ""
+			d.RollbackError = err.Error()
+			return nil
+		})
+		if uerr != nil {
+			log.Println("Failed to record rollback of deployment", failed.ID, ":", uerr)
+		}
+		log.Println("Failed to roll back deployment", failed.ID, ":", err)
+		s.logf(failed.ID, "automatic rollback failed: %v", err)
+		return
+	}
+	s.logf(failed.ID, "rolled back automatically by %s", rollback.ID)
+	s.logf(rollback.ID, "rolls back failed deployment %s to %s", failed.ID, previous.ID)
+}
+
+// lastSucceeded returns the latest successful deployment of the target and
+// environment of d created before it
+func (s *Server) lastSucceeded(d *api.Deployment) (*api.Deployment, error) {
+	deployments, err := s.listDeployments()
+	if err != nil {
+		return nil, err
+	}
+	for _, previous := range deployments {
+		if previous.Target == d.Target && previous.Env == d.Env &&
+			previous.State == api.DeploymentSucceeded && previous.CreatedAt.Before(d.CreatedAt) {
+			return previous, nil
+		}
+	}
+	return nil, fmt.Errorf("no earlier successful deployment of %s/%s to roll back to", d.Target, d.Env)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+// waitDeployment polls a deployment until it reaches state
+func waitDeployment(t *testing.T, s *Server, id string, state api.DeploymentState) *api.Deployment {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		d, err := s.getDeployment(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.State == state {
+			return d
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deployment %s is %s (%s), expected %s", id, d.State, d.Message, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestVerifyAutoRollback(t *testing.T) {
+	healthy := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	workers := &fakeWorkers{}
+	s := newRolloutServer(t, workers)
+	verify := `"verify":{"probes":[{"name":"health","http":{"url":"` + ts.URL + `/{{.Worker}}"}}],"autoRollback":true}`
+
+	var good api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"values":{"v":1},`+verify+`}`, &good); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	s.schedule(context.Background())
+	report(t, s, good.ID, "w1", pb.ResourceState_RES_SUCCESS)
+	if d, _ := s.getDeployment(good.ID); d.State != api.DeploymentRunning || d.Resources["w1"]["verify:health"] != pb.ResourceState_RES_PENDING {
+		t.Fatalf("expected the worker to wait for its probe, got %s %v", d.State, d.Resources)
+	}
+	s.schedule(context.Background())
+	waitDeployment(t, s, good.ID, api.DeploymentSucceeded)
+
+	healthy = false
+	var bad api.Deployment
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"values":{"v":2},`+verify+`}`, &bad); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	s.schedule(context.Background())
+	report(t, s, bad.ID, "w1", pb.ResourceState_RES_SUCCESS)
+	s.schedule(context.Background())
+	waitDeployment(t, s, bad.ID, api.DeploymentFailed)
+
+	s.schedule(context.Background())
+	failed, _ := s.getDeployment(bad.ID)
+	if failed.RolledBackBy == "" {
+		t.Fatalf("expected an automatic rollback, got %q", failed.RollbackError)
+	}
+	rollback, _ := s.getDeployment(failed.RolledBackBy)
+	if rollback.RollbackOf != bad.ID || rollback.Values["v"] != float64(1) || rollback.Verify != nil {
+		t.Errorf("unexpected rollback %+v", rollback)
+	}
+
+	// The rollback happens once
+	s.schedule(context.Background())
+	deployments, _ := s.listDeployments()
+	if len(deployments) != 3 {
+		t.Errorf("expected 3 deployments, got %d", len(deployments))
+	}
+}
+
+func TestVerifyValidation(t *testing.T) {
+	s := newRolloutServer(t, &fakeWorkers{})
+	for _, body := range []string{
+		`{"action":"deploy","target":"web","workers":["w1"],"verify":{"probes":[{"name":"x"}]}}`,
+		`{"action":"deploy","target":"web","workers":["w1"],"verify":{"probes":[{"name":"x","tcp":{"addr":"a:1"}},{"name":"x","tcp":{"addr":"a:1"}}]}}`,
+		`{"action":"deploy","target":"web","workers":["w1"],"verify":{"probes":[{"name":"x","exec":{"command":["true"]}}]}}`,
+		`{"action":"deploy","target":"web","workers":["w1"],"verify":{"probes":[{"name":"x","tcp":{"addr":"a:1"},"interval":"soon"}]}}`,
+	} {
+		if code := call(t, s, "POST", "/actions", body, nil); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, code)
+		}
+	}
+	s.cfg.AllowExecProbes = true
+	if code := call(t, s, "POST", "/actions", `{"action":"deploy","target":"web","workers":["w1"],"verify":{"probes":[{"name":"x","exec":{"command":["true"]}}]}}`, nil); code != http.StatusCreated {
+		t.Errorf("expected exec probes to be allowed, got %d", code)
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/beacon/deployer/pkg/api"
+	"github.com/beacon/deployer/pkg/config"
+	pb "github.com/beacon/deployer/pkg/proto"
+	"github.com/beacon/deployer/pkg/store"
+)
+
+const kindWorkers = "workers"
+
+// manifestPath is the file carrying the deployment itself to workers
+const manifestPath = "deployment.json"
+
+// secretsPath carries the secrets of the deployment, they are not part of
+// the manifest which is stored
+const secretsPath = "secrets.json"
+
+// WorkerClient talks to workers on behalf of the server
+type WorkerClient interface {
+	// SendDeployment hands a deployment and its secrets over to a worker
+	SendDeployment(ctx context.Context, w *api.Worker, d *api.Deployment, secrets map[string]string) error
+	// DeployStatus asks a worker what it knows about a deployment
+	DeployStatus(ctx context.Context, w *api.Worker, id string) (*pb.DeployStatus, error)
+}
+
+func (s *Server) getWorker(name string) (*api.Worker, error) {
+	w := &api.Worker{}
+	if err := s.store.Get(kindWorkers, name, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// listWorkers returns registered workers sorted by name
+func (s *Server) listWorkers() ([]*api.Worker, error) {
+	names, err := s.store.List(kindWorkers)
+	if err != nil {
+		return nil, err
+	}
+	workers := make([]*api.Worker, 0, len(names))
+	for _, name := range names {
+		w, err := s.getWorker(name)
+		if err != nil {
+			continue
+		}
+		workers = append(workers, w)
+	}
+	return workers, nil
+}
+
+// selectWorkers returns the names of workers having every label of selector
+func (s *Server) selectWorkers(selector map[string]string) ([]string, error) {
+	workers, err := s.listWorkers()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, w := range workers {
+		matches := true
+		for k, v := range selector {
+			if w.Labels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			names = append(names, w.Name)
+		}
+	}
+	return names, nil
+}
+
+func (s *Server) listWorkersHandler(c *gin.Context) {
+	workers, err := s.listWorkers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, workers)
+}
+
+// putWorkerHandler registers a worker, workers call it periodically as heartbeat
+func (s *Server) putWorkerHandler(c *gin.Context) {
+	var w api.Worker
+	if err := c.ShouldBindJSON(&w); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	w.Name = c.Param("name")
+	w.LastSeen = time.Now()
+	if err := s.store.Put(kindWorkers, w.Name, &w); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, &w)
+}
+
+// rpcWorkerClient reaches workers through their Worker grpc service
+type rpcWorkerClient struct {
+	// tls returns the TLS config in effect, it changes when reloaded
+	tls func() *config.TLSConfig
+}
+
+func newRPCWorkerClient(tlsCfg func() *config.TLSConfig) *rpcWorkerClient {
+	return &rpcWorkerClient{tls: tlsCfg}
+}
+
+// clientTLS presents our own certificate and verifies peers with the CA of
+// the config if any
+func clientTLS(tlsCfg *config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate:%v", err)
+	}
+	result := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if tlsCfg.CAFile != "" {
+		ca, err := ioutil.ReadFile(tlsCfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s:%v", tlsCfg.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", tlsCfg.CAFile)
+		}
+		result.RootCAs = pool
+	}
+	return result, nil
+}
+
+// newTLSTransport is an http transport presenting our own certificate
+func newTLSTransport(tlsCfg *config.TLSConfig) (*http.Transport, error) {
+	clientCfg, err := clientTLS(tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Transport{TLSClientConfig: clientCfg}, nil
+}
+
+// dial connects to a worker or another server, presenting our own certificate
+func dial(ctx context.Context, tlsCfg *config.TLSConfig, addr string) (*grpc.ClientConn, error) {
+	if tlsCfg == nil {
+		return grpc.DialContext(ctx, addr, grpc.WithInsecure())
+	}
+	clientCfg, err := clientTLS(tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(credentials.NewTLS(clientCfg)))
+}
+
+func (c *rpcWorkerClient) SendDeployment(ctx context.Context, w *api.Worker, d *api.Deployment, secrets map[string]string) error {
+	conn, err := dial(ctx, c.tls(), w.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	manifest, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	stream, err := pb.NewWorkerClient(conn).SendDeployFile(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&pb.File{
+		Id:   d.ID,
+		Path: manifestPath,
+		Data: string(manifest),
+	}); err != nil {
+		return err
+	}
+	// Files are referenced by digest, workers download the blobs they lack
+	for path, digest := range d.Files {
+		if err := stream.Send(&pb.File{Id: d.ID, Path: path, Digest: digest}); err != nil {
+			return err
+		}
+	}
+	if len(secrets) > 0 {
+		data, err := json.Marshal(secrets)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.File{Id: d.ID, Path: secretsPath, Data: string(data)}); err != nil {
+			return err
+		}
+	}
+	status, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	if status.State == pb.FileState_FILE_FAILED {
+		return fmt.Errorf("worker %s rejected %s: %s", w.Name, status.Path, status.Error)
+	}
+	return nil
+}
+
+func (c *rpcWorkerClient) DeployStatus(ctx context.Context, w *api.Worker, id string) (*pb.DeployStatus, error) {
+	conn, err := dial(ctx, c.tls(), w.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return pb.NewWorkerClient(conn).GetDeployStatus(ctx, &pb.DeployStatusRequest{Id: id})
+}
+
+// sendToWorker resolves a worker by name and hands the deployment over
+func (s *Server) sendToWorker(ctx context.Context, name string, d *api.Deployment) error {
+	w, err := s.getWorker(name)
+	if err == store.ErrNotFound {
+		return fmt.Errorf("worker %s is not registered", name)
+	}
+	if err != nil {
+		return err
+	}
+	values, err := s.secretValues(d.Target, d.Env)
+	if err != nil {
+		return err
+	}
+	return s.workers.SendDeployment(ctx, w, d, values)
+}
@@ -0,0 +1,201 @@
+package spec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+// HookPrefix starts the resources recording the hooks of a worker
+const HookPrefix = "hook:"
+
+// HookResource is the resource recording the outcome of the hook name run
+// in phase
+func HookResource(phase, name string) string {
+	return HookPrefix + phase + ":" + name
+}
+
+// IsHookResource tells whether resource records a hook
+func IsHookResource(resource string) bool {
+	return strings.HasPrefix(resource, HookPrefix)
+}
+
+// Phase is the hooks run at a point of the lifecycle
+type Phase struct {
+	Name  string
+	Hooks []api.Step
+}
+
+// Phases lists the hooks of h by phase, in the order of the lifecycle
+func Phases(h *api.Hooks) []Phase {
+	if h == nil {
+		return nil
+	}
+	return []Phase{
+		{api.HookPreRender, h.PreRender},
+		{api.HookPreDeploy, h.PreDeploy},
+		{api.HookPostDeploy, h.PostDeploy},
+		{api.HookOnFailure, h.OnFailure},
+	}
+}
+
+// ValidateHooks checks hooks as steps, names being unique in every phase.
+// Hooks run in order, they may not depend on other steps.
+func ValidateHooks(h *api.Hooks) error {
+	for _, phase := range Phases(h) {
+		seen := make(map[string]bool, len(phase.Hooks))
+		for i := range phase.Hooks {
+			hook := &phase.Hooks[i]
+			if !stepName.MatchString(hook.Name) {
+				return fmt.Errorf("invalid %s hook name %q", phase.Name, hook.Name)
+			}
+			if seen[hook.Name] {
+				return fmt.Errorf("duplicate %s hook %s", phase.Name, hook.Name)
+			}
+			seen[hook.Name] = true
+			if hook.Executor == "" {
+				return fmt.Errorf("%s hook %s has no executor", phase.Name, hook.Name)
+			}
+			if len(hook.DependsOn) > 0 {
+				return fmt.Errorf("%s hook %s may not depend on other steps, hooks run in order", phase.Name, hook.Name)
+			}
+			if err := validatePolicy(hook); err != nil {
+				return fmt.Errorf("%s hook %s %v", phase.Name, hook.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// MergeHooks returns the hooks of outer around the ones of inner: those of
+// outer run first before deploying and last after. It is nil when both are.
+func MergeHooks(outer, inner *api.Hooks) *api.Hooks {
+	if outer == nil && inner == nil {
+		return nil
+	}
+	if outer == nil {
+		outer = &api.Hooks{}
+	}
+	if inner == nil {
+		inner = &api.Hooks{}
+	}
+	join := func(first, last []api.Step) []api.Step {
+		return append(append([]api.Step(nil), first...), last...)
+	}
+	return &api.Hooks{
+		PreRender:  join(outer.PreRender, inner.PreRender),
+		PreDeploy:  join(outer.PreDeploy, inner.PreDeploy),
+		PostDeploy: join(inner.PostDeploy, outer.PostDeploy),
+		OnFailure:  join(inner.OnFailure, outer.OnFailure),
+	}
+}
+
+// maxHookOutput bounds the output kept of a hook, its last lines are kept
+const maxHookOutput = 64 << 10
+
+// output keeps the last lines a hook printed
+type output struct {
+	lines []string
+	size  int
+}
+
+func (o *output) add(line string) {
+	o.lines = append(o.lines, line)
+	o.size += len(line) + 1
+	for o.size > maxHookOutput && len(o.lines) > 1 {
+		o.size -= len(o.lines[0]) + 1
+		o.lines = o.lines[1:]
+	}
+}
+
+func (o *output) String() string {
+	if len(o.lines) == 0 {
+		return ""
+	}
+	return strings.Join(o.lines, "\n") + "\n"
+}
+
+// RunHooks runs the hooks of a phase in order and reports their results.
+// The failure of a hook stops the phase and is returned, unless its
+// onFailure mode is continue.
+func (r *Runner) RunHooks(ctx context.Context, phase string, hooks []api.Step) error {
+	if err := r.checkExecutors(hooks); err != nil {
+		return err
+	}
+	for i := range hooks {
+		hook := &hooks[i]
+		var out output
+		logf := func(format string, args ...interface{}) {
+			line := fmt.Sprintf(format, args...)
+			out.add(line)
+			r.logf("%s hook %s: %s", phase, hook.Name, line)
+		}
+		result := &api.HookResult{Phase: phase, Name: hook.Name, StartedAt: time.Now()}
+		r.logf("%s hook %s started", phase, hook.Name)
+		attempts, err := r.attempt(ctx, hook, logf)
+		result.Attempts = attempts
+		result.State = pb.ResourceState_RES_SUCCESS
+		if err != nil {
+			result.Message = fmt.Sprintf("failed after %d attempt(s): %v", attempts, err)
+			result.State = pb.ResourceState_RES_ERROR
+			switch hook.OnFailure {
+			case api.OnFailureContinue:
+				result.State = pb.ResourceState_RES_OTHER
+			case api.OnFailureCompensate:
+				if cerr := r.compensate(ctx, hook, logf); cerr != nil {
+					result.Message += fmt.Sprintf(", compensation failed: %v", cerr)
+				} else {
+					result.Message += ", compensated"
+				}
+			}
+			r.logf("%s hook %s %s", phase, hook.Name, result.Message)
+		} else {
+			r.logf("%s hook %s succeeded", phase, hook.Name)
+		}
+		result.Output = out.String()
+		result.EndedAt = time.Now()
+		if r.ReportHook != nil {
+			r.ReportHook(result)
+		}
+		if result.State == pb.ResourceState_RES_ERROR {
+			return fmt.Errorf("%s hook %s %s", phase, hook.Name, result.Message)
+		}
+	}
+	return nil
+}
+
+// Deploy runs the lifecycle of d on a worker: its pre-render hooks, render,
+// its pre-deploy hooks, the steps of its spec and its post-deploy hooks.
+// When any of them fails the on-failure hooks run and the failure is
+// returned.
+func (r *Runner) Deploy(ctx context.Context, d *api.Deployment, render func(ctx context.Context) error) error {
+	hooks := d.Hooks
+	if hooks == nil {
+		hooks = &api.Hooks{}
+	}
+	err := r.RunHooks(ctx, api.HookPreRender, hooks.PreRender)
+	if err == nil && render != nil {
+		if err = render(ctx); err != nil {
+			err = fmt.Errorf("failed to render:%v", err)
+		}
+	}
+	if err == nil {
+		err = r.RunHooks(ctx, api.HookPreDeploy, hooks.PreDeploy)
+	}
+	if err == nil && d.Spec != nil && len(d.Spec.Steps) > 0 {
+		err = r.Run(ctx, d.Spec)
+	}
+	if err == nil {
+		err = r.RunHooks(ctx, api.HookPostDeploy, hooks.PostDeploy)
+	}
+	if err != nil {
+		if herr := r.RunHooks(ctx, api.HookOnFailure, hooks.OnFailure); herr != nil {
+			r.logf("%v", herr)
+		}
+	}
+	return err
+}
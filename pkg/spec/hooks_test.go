@@ -0,0 +1,89 @@
+package spec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+func TestMergeHooks(t *testing.T) {
+	env := &api.Hooks{PreDeploy: []api.Step{{Name: "snapshot"}}, PostDeploy: []api.Step{{Name: "notes"}}}
+	bundle := &api.Hooks{PreDeploy: []api.Step{{Name: "drain"}}, PostDeploy: []api.Step{{Name: "undrain"}}}
+	h := MergeHooks(env, bundle)
+	if h.PreDeploy[0].Name != "snapshot" || h.PreDeploy[1].Name != "drain" || h.PostDeploy[0].Name != "undrain" || h.PostDeploy[1].Name != "notes" {
+		t.Errorf("expected the environment hooks around the bundle ones, got %+v", h)
+	}
+	if MergeHooks(nil, nil) != nil {
+		t.Error("expected no hooks")
+	}
+	if err := ValidateHooks(&api.Hooks{PreDeploy: []api.Step{{Name: "a", Executor: "exec", DependsOn: []string{"b"}}}}); err == nil {
+		t.Error("expected hooks depending on steps to be refused")
+	}
+	if _, err := Parse([]byte("hooks: {postDeploy: [{name: notes, executor: exec}]}")); err != nil {
+		t.Errorf("expected a spec with hooks only to be valid, got %v", err)
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	var results []*api.HookResult
+	fail := ""
+	runner := &Runner{
+		Executors: map[string]Executor{"exec": ExecutorFunc(func(ctx context.Context, step *api.Step, logf func(string, ...interface{})) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ran = append(ran, step.Name)
+			logf("running %s", step.Name)
+			if step.Name == fail {
+				return fmt.Errorf("%s failed", step.Name)
+			}
+			return nil
+		})},
+		ReportHook: func(result *api.HookResult) { results = append(results, result) },
+	}
+	d := &api.Deployment{
+		Spec: &api.Spec{Steps: []api.Step{{Name: "app", Executor: "exec"}}},
+		Hooks: &api.Hooks{
+			PreRender:  []api.Step{{Name: "fetch", Executor: "exec"}},
+			PreDeploy:  []api.Step{{Name: "snapshot", Executor: "exec"}},
+			PostDeploy: []api.Step{{Name: "notes", Executor: "exec", OnFailure: api.OnFailureContinue}},
+			OnFailure:  []api.Step{{Name: "restore", Executor: "exec"}},
+		},
+	}
+	render := func(ctx context.Context) error {
+		ran = append(ran, "render")
+		return nil
+	}
+	if err := runner.Deploy(context.Background(), d, render); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ran, ","); got != "fetch,render,snapshot,app,notes" {
+		t.Errorf("unexpected lifecycle %s", got)
+	}
+	if len(results) != 3 || results[0].Phase != api.HookPreRender || results[0].Output != "running fetch\n" {
+		t.Errorf("unexpected hook results %+v", results)
+	}
+
+	// Ignored failures of hooks do not fail the deployment, others run the
+	// on-failure hooks
+	ran, results, fail = nil, nil, "notes"
+	if err := runner.Deploy(context.Background(), d, render); err != nil {
+		t.Errorf("expected the failure of notes to be ignored, got %v", err)
+	}
+	if results[2].State != pb.ResourceState_RES_OTHER {
+		t.Errorf("expected notes to be reported as ignored, got %+v", results[2])
+	}
+	ran, results, fail = nil, nil, "app"
+	if err := runner.Deploy(context.Background(), d, render); err == nil {
+		t.Error("expected the deployment to fail")
+	}
+	if got := strings.Join(ran, ","); got != "fetch,render,snapshot,app,restore" {
+		t.Errorf("unexpected lifecycle %s", got)
+	}
+}
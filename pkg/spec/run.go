@@ -0,0 +1,320 @@
+package spec
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+// Executor runs steps, logf records their output
+type Executor interface {
+	Execute(ctx context.Context, step *api.Step, logf func(format string, args ...interface{})) error
+}
+
+// ExecutorFunc adapts a function to Executor
+type ExecutorFunc func(ctx context.Context, step *api.Step, logf func(format string, args ...interface{})) error
+
+// Execute calls f
+func (f ExecutorFunc) Execute(ctx context.Context, step *api.Step, logf func(format string, args ...interface{})) error {
+	return f(ctx, step, logf)
+}
+
+// Exec runs the command input of a step, either a string run by sh -c or a
+// list of arguments. The dir input is where it runs and the env input maps
+// variables added to its environment. Every line it prints is logged.
+var Exec = ExecutorFunc(func(ctx context.Context, step *api.Step, logf func(format string, args ...interface{})) error {
+	var cmd *exec.Cmd
+	switch command := step.Inputs["command"].(type) {
+	case string:
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	case []interface{}:
+		if len(command) == 0 {
+			return fmt.Errorf("command of step %s is empty", step.Name)
+		}
+		args := make([]string, len(command))
+		for i, arg := range command {
+			args[i] = fmt.Sprint(arg)
+		}
+		cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	default:
+		return fmt.Errorf("step %s has no command", step.Name)
+	}
+	if dir, ok := step.Inputs["dir"].(string); ok {
+		cmd.Dir = dir
+	}
+	cmd.Env = os.Environ()
+	if env, ok := step.Inputs["env"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", name, env[name]))
+		}
+	}
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start step %s:%v", step.Name, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			logf("%s", scanner.Text())
+		}
+		io.Copy(ioutil.Discard, r)
+	}()
+	err := cmd.Wait()
+	w.Close()
+	<-done
+	return err
+})
+
+// DefaultExecutors are the executors workers provide
+func DefaultExecutors() map[string]Executor {
+	return map[string]Executor{"exec": Exec}
+}
+
+// Runner runs the steps of specs, Report and Logf are called from the
+// goroutines running steps
+type Runner struct {
+	Executors map[string]Executor
+	// Report is called with the status of a step whenever it changes, the
+	// state is the one of the resource Resource(status.Name)
+	Report func(status *pb.StepStatus)
+	// ReportHook is called with the result of every hook once it ran
+	ReportHook func(result *api.HookResult)
+	// Logf records what steps do
+	Logf func(format string, args ...interface{})
+}
+
+func (r *Runner) report(step string, state pb.ResourceState, attempts int, message string) {
+	if r.Report != nil {
+		r.Report(&pb.StepStatus{Name: step, State: state, Attempts: int32(attempts), Message: message})
+	}
+}
+
+func (r *Runner) logf(format string, args ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
+
+const (
+	defaultBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+// jitterRand is seeded apart on every worker, the default source would
+// have workers retrying together draw the same delays. Rand sources are not
+// safe for concurrent use, steps of a level run together.
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter shortens delay by a random part of up to half of it, so that
+// workers retrying together spread out
+func jitter(delay time.Duration) time.Duration {
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return delay - time.Duration(jitterRand.Int63n(int64(delay/2)+1))
+}
+
+// attempt runs step until it succeeds, it is out of retries or its timeout
+// expires, and returns the number of attempts made. logf records what the
+// executor prints.
+func (r *Runner) attempt(parent context.Context, step *api.Step, logf func(format string, args ...interface{})) (int, error) {
+	ctx := parent
+	if step.Timeout != "" {
+		timeout, _ := time.ParseDuration(step.Timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, timeout)
+		defer cancel()
+	}
+	// timedOut tells the timeout of the step apart from the deadline of
+	// the whole run
+	timedOut := func() bool {
+		return step.Timeout != "" && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil
+	}
+	delay := defaultBackoff
+	if step.Backoff != "" {
+		delay, _ = time.ParseDuration(step.Backoff)
+	}
+	executor := r.Executors[step.Executor]
+	for attempt := 1; ; attempt++ {
+		err := executor.Execute(ctx, step, logf)
+		if err == nil {
+			return attempt, nil
+		}
+		if timedOut() {
+			return attempt, fmt.Errorf("timed out after %s: %v", step.Timeout, err)
+		}
+		if attempt > step.Retries || ctx.Err() != nil {
+			return attempt, err
+		}
+		wait := jitter(delay)
+		r.logf("step %s attempt %d of %d failed: %v, retrying in %s", step.Name, attempt, step.Retries+1, err, wait.Round(time.Millisecond))
+		r.report(step.Name, pb.ResourceState_RES_PENDING, attempt, err.Error())
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			if timedOut() {
+				return attempt, fmt.Errorf("timed out after %s: %v", step.Timeout, err)
+			}
+			return attempt, err
+		}
+		if delay *= 2; delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+}
+
+// compensate runs the compensation of a failed step
+func (r *Runner) compensate(ctx context.Context, step *api.Step, logf func(format string, args ...interface{})) error {
+	r.logf("step %s compensating", step.Name)
+	c := &api.Step{Name: step.Name, Executor: step.Compensate.Executor, Inputs: step.Compensate.Inputs}
+	err := r.Executors[c.Executor].Execute(ctx, c, logf)
+	if err != nil {
+		r.logf("step %s compensation failed: %v", step.Name, err)
+		return err
+	}
+	r.logf("step %s compensated", step.Name)
+	return nil
+}
+
+// checkExecutors fails unless the runner has the executors of every step
+func (r *Runner) checkExecutors(steps []api.Step) error {
+	for _, step := range steps {
+		if _, ok := r.Executors[step.Executor]; !ok {
+			return fmt.Errorf("step %s has unknown executor %s", step.Name, step.Executor)
+		}
+		if c := step.Compensate; c != nil {
+			if _, ok := r.Executors[c.Executor]; !ok {
+				return fmt.Errorf("compensation of step %s has unknown executor %s", step.Name, c.Executor)
+			}
+		}
+	}
+	return nil
+}
+
+// Run runs the steps of s, each once all the steps it depends on succeeded,
+// failed attempts retried as the step allows. What the failure of a step
+// does depends on its onFailure mode:
+//   - abort, the default, reports the step as RES_ERROR. Steps running go on
+//     but the ones not started yet are skipped, reported as RES_OTHER, and the
+//     error of the first failed step is returned.
+//   - continue reports the step as RES_OTHER and runs the steps depending on
+//     it anyway
+//   - compensate runs the compensation of the step, then aborts
+//
+// Steps not started when ctx ends are reported as RES_ERROR and the error
+// of ctx is returned, unless a step failed first.
+func (r *Runner) Run(ctx context.Context, s *api.Spec) error {
+	if err := Validate(s); err != nil {
+		return err
+	}
+	if err := r.checkExecutors(s.Steps); err != nil {
+		return err
+	}
+	done := make(map[string]chan struct{}, len(s.Steps))
+	for _, step := range s.Steps {
+		done[step.Name] = make(chan struct{})
+		r.report(step.Name, pb.ResourceState_RES_PENDING, 0, "")
+	}
+	var mu sync.Mutex
+	// succeeded holds the steps the ones depending on them may follow,
+	// failures ignored included
+	succeeded := make(map[string]bool, len(s.Steps))
+	var firstErr error
+	failed := false
+	var wg sync.WaitGroup
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[step.Name])
+			for _, dep := range step.DependsOn {
+				<-done[dep]
+			}
+			mu.Lock()
+			blocked := failed
+			for _, dep := range step.DependsOn {
+				blocked = blocked || !succeeded[dep]
+			}
+			if err := ctx.Err(); err != nil && !blocked {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("step %s not started: %v", step.Name, err)
+				}
+				mu.Unlock()
+				r.logf("step %s not started: %v", step.Name, err)
+				r.report(step.Name, pb.ResourceState_RES_ERROR, 0, err.Error())
+				return
+			}
+			mu.Unlock()
+			if blocked {
+				r.logf("step %s skipped", step.Name)
+				r.report(step.Name, pb.ResourceState_RES_OTHER, 0, "skipped")
+				return
+			}
+
+			r.logf("step %s started", step.Name)
+			attempts, err := r.attempt(ctx, step, func(format string, args ...interface{}) {
+				r.logf("%s: %s", step.Name, fmt.Sprintf(format, args...))
+			})
+			if err == nil {
+				mu.Lock()
+				succeeded[step.Name] = true
+				mu.Unlock()
+				r.logf("step %s succeeded after %d attempt(s)", step.Name, attempts)
+				r.report(step.Name, pb.ResourceState_RES_SUCCESS, attempts, "")
+				return
+			}
+			message := fmt.Sprintf("failed after %d attempt(s): %v", attempts, err)
+			r.logf("step %s %s", step.Name, message)
+			if step.OnFailure == api.OnFailureContinue {
+				mu.Lock()
+				succeeded[step.Name] = true
+				mu.Unlock()
+				r.logf("step %s failure ignored", step.Name)
+				r.report(step.Name, pb.ResourceState_RES_OTHER, attempts, message)
+				return
+			}
+			if step.OnFailure == api.OnFailureCompensate {
+				cerr := r.compensate(ctx, step, func(format string, args ...interface{}) {
+					r.logf("%s (compensate): %s", step.Name, fmt.Sprintf(format, args...))
+				})
+				if cerr != nil {
+					message += fmt.Sprintf(", compensation failed: %v", cerr)
+				} else {
+					message += ", compensated"
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			r.report(step.Name, pb.ResourceState_RES_ERROR, attempts, message)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("step %s %s", step.Name, message)
+			}
+			failed = true
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
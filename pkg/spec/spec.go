@@ -0,0 +1,210 @@
+// Package spec parses the spec files declaring the steps of a deployment and
+// runs their steps, in parallel unless ordered by dependsOn
+package spec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+// ResourcePrefix starts the resources recording the steps of a worker
+const ResourcePrefix = "step:"
+
+// Resource is the resource recording the outcome of step
+func Resource(step string) string {
+	return ResourcePrefix + step
+}
+
+// IsResource tells whether resource records a step
+func IsResource(resource string) bool {
+	return strings.HasPrefix(resource, ResourcePrefix)
+}
+
+var stepName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Parse parses and validates a spec, in YAML or JSON
+func Parse(data []byte) (*api.Spec, error) {
+	s := &api.Spec{}
+	if err := yaml.UnmarshalStrict(data, s); err != nil {
+		return nil, err
+	}
+	if err := Validate(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load parses the spec file
+func Load(file string) (*api.Spec, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec file %s:%v", file, err)
+	}
+	s, err := Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec file %s:%v", file, err)
+	}
+	return s, nil
+}
+
+// Validate checks that steps have unique names, executors and valid failure
+// handling, and that they depend on existing steps without cycles. Hooks are
+// checked as well.
+func Validate(s *api.Spec) error {
+	if len(s.Steps) == 0 && s.Hooks == nil {
+		return fmt.Errorf("spec has no steps nor hooks")
+	}
+	if err := ValidateHooks(s.Hooks); err != nil {
+		return err
+	}
+	steps := make(map[string]*api.Step, len(s.Steps))
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if !stepName.MatchString(step.Name) {
+			return fmt.Errorf("invalid step name %q", step.Name)
+		}
+		if _, ok := steps[step.Name]; ok {
+			return fmt.Errorf("duplicate step %s", step.Name)
+		}
+		if step.Executor == "" {
+			return fmt.Errorf("step %s has no executor", step.Name)
+		}
+		if err := validatePolicy(step); err != nil {
+			return fmt.Errorf("step %s %v", step.Name, err)
+		}
+		steps[step.Name] = step
+	}
+	for _, step := range s.Steps {
+		for _, dep := range step.DependsOn {
+			if dep == step.Name {
+				return fmt.Errorf("step %s depends on itself", step.Name)
+			}
+			if _, ok := steps[dep]; !ok {
+				return fmt.Errorf("step %s depends on unknown step %s", step.Name, dep)
+			}
+		}
+	}
+	if cycle := findCycle(s); cycle != nil {
+		return fmt.Errorf("steps depend on each other: %s", strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// validatePolicy checks how a step is retried and what its failure does
+func validatePolicy(step *api.Step) error {
+	if step.Retries < 0 {
+		return fmt.Errorf("has negative retries")
+	}
+	for _, f := range []struct{ name, value string }{{"backoff", step.Backoff}, {"timeout", step.Timeout}} {
+		if f.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(f.value); err != nil || d <= 0 {
+			return fmt.Errorf("has invalid %s %q", f.name, f.value)
+		}
+	}
+	switch step.OnFailure {
+	case "", api.OnFailureAbort, api.OnFailureContinue:
+		if step.Compensate != nil {
+			return fmt.Errorf("has a compensation but onFailure is not %s", api.OnFailureCompensate)
+		}
+	case api.OnFailureCompensate:
+		if step.Compensate == nil || step.Compensate.Executor == "" {
+			return fmt.Errorf("has no compensation executor")
+		}
+	default:
+		return fmt.Errorf("has unknown onFailure %q", step.OnFailure)
+	}
+	return nil
+}
+
+// findCycle returns the steps of a dependency cycle, the first one repeated
+// at the end, nil when there is none
+func findCycle(s *api.Spec) []string {
+	deps := make(map[string][]string, len(s.Steps))
+	for _, step := range s.Steps {
+		deps[step.Name] = step.DependsOn
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(s.Steps))
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			switch state[dep] {
+			case visiting:
+				for i, n := range path {
+					if n == dep {
+						return append(append([]string(nil), path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, step := range s.Steps {
+		if state[step.Name] == unvisited {
+			if cycle := visit(step.Name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// Levels groups the steps of a valid spec by how many steps must run before
+// them, the steps of a level may run in parallel once the previous levels
+// are done
+func Levels(s *api.Spec) [][]string {
+	steps := make(map[string]*api.Step, len(s.Steps))
+	for i := range s.Steps {
+		steps[s.Steps[i].Name] = &s.Steps[i]
+	}
+	level := make(map[string]int, len(s.Steps))
+	var depth func(step *api.Step) int
+	depth = func(step *api.Step) int {
+		if l, ok := level[step.Name]; ok {
+			return l
+		}
+		l := 0
+		for _, dep := range step.DependsOn {
+			if d := depth(steps[dep]) + 1; d > l {
+				l = d
+			}
+		}
+		level[step.Name] = l
+		return l
+	}
+	var levels [][]string
+	for i := range s.Steps {
+		l := depth(&s.Steps[i])
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], s.Steps[i].Name)
+	}
+	for _, names := range levels {
+		sort.Strings(names)
+	}
+	return levels
+}
@@ -0,0 +1,254 @@
+package spec
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+	pb "github.com/beacon/deployer/pkg/proto"
+)
+
+const deploySpec = `
+steps:
+- name: migrate
+  executor: exec
+  inputs:
+    command: ./migrate up
+- name: app
+  executor: exec
+  dependsOn: [migrate]
+- name: cache
+  executor: exec
+  dependsOn: [migrate]
+- name: warm
+  executor: exec
+  dependsOn: [app, cache]
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(deploySpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Steps[0].Inputs["command"] != "./migrate up" {
+		t.Errorf("unexpected inputs %v", s.Steps[0].Inputs)
+	}
+	want := [][]string{{"migrate"}, {"app", "cache"}, {"warm"}}
+	if got := Levels(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected levels %v, got %v", want, got)
+	}
+
+	for spec, want := range map[string]string{
+		"steps: []": "no steps",
+		"steps: [{name: a, executor: exec, depends: [b]}]": "unknown field",
+		"steps: [{name: a}]": "no executor",
+		"steps: [{name: a, executor: exec}, {name: a, executor: exec}]": "duplicate step a",
+		"steps: [{name: a b, executor: exec}]":                          "invalid step name",
+		"steps: [{name: a, executor: exec, dependsOn: [a]}]":            "depends on itself",
+		"steps: [{name: a, executor: exec, dependsOn: [b]}]":            "unknown step b",
+		"steps: [{name: a, executor: exec, dependsOn: [c]}, {name: b, executor: exec, dependsOn: [a]}, {name: c, executor: exec, dependsOn: [b]}]": "a -> c -> b -> a",
+	} {
+		if _, err := Parse([]byte(spec)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q to fail with %q, got %v", spec, want, err)
+		}
+	}
+}
+
+// recorder keeps what a runner reports
+type recorder struct {
+	mu       sync.Mutex
+	order    []string
+	states   map[string]pb.ResourceState
+	attempts map[string]int
+}
+
+func (r *recorder) runner(executor Executor) *Runner {
+	r.states = make(map[string]pb.ResourceState)
+	r.attempts = make(map[string]int)
+	return &Runner{
+		Executors: map[string]Executor{"exec": executor},
+		Report: func(status *pb.StepStatus) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.states[Resource(status.Name)] = status.State
+			r.attempts[status.Name] = int(status.Attempts)
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, err := Parse([]byte(deploySpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r recorder
+	// app and cache only end once both started, they must run in parallel
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	runner := r.runner(ExecutorFunc(func(ctx context.Context, step *api.Step, logf func(string, ...interface{})) error {
+		r.mu.Lock()
+		r.order = append(r.order, step.Name)
+		r.mu.Unlock()
+		if step.Name == "app" || step.Name == "cache" {
+			barrier.Done()
+			barrier.Wait()
+		}
+		return nil
+	}))
+	if err := runner.Run(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.order) != 4 || r.order[0] != "migrate" || r.order[3] != "warm" {
+		t.Errorf("unexpected order %v", r.order)
+	}
+	for _, step := range s.Steps {
+		if r.states[Resource(step.Name)] != pb.ResourceState_RES_SUCCESS {
+			t.Errorf("expected every step to succeed, got %v", r.states)
+		}
+	}
+
+	// A failure skips the steps depending on it, cache started before app
+	// failed goes on
+	cacheStarted := make(chan struct{})
+	runner = r.runner(ExecutorFunc(func(ctx context.Context, step *api.Step, logf func(string, ...interface{})) error {
+		switch step.Name {
+		case "cache":
+			close(cacheStarted)
+		case "app":
+			<-cacheStarted
+			return fmt.Errorf("crashed")
+		}
+		return nil
+	}))
+	if err := runner.Run(context.Background(), s); err == nil || !strings.Contains(err.Error(), "step app failed") {
+		t.Fatalf("expected step app to fail, got %v", err)
+	}
+	want := map[string]pb.ResourceState{
+		"step:migrate": pb.ResourceState_RES_SUCCESS,
+		"step:app":     pb.ResourceState_RES_ERROR,
+		"step:cache":   pb.ResourceState_RES_SUCCESS,
+		"step:warm":    pb.ResourceState_RES_OTHER,
+	}
+	if !reflect.DeepEqual(r.states, want) {
+		t.Errorf("expected %v, got %v", want, r.states)
+	}
+
+	// The deadline passing between two steps fails the run
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	runner = r.runner(ExecutorFunc(func(ctx context.Context, step *api.Step, logf func(string, ...interface{})) error {
+		if step.Name == "migrate" {
+			// Ignores the deadline, as executors may
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	}))
+	if err := runner.Run(ctx, s); err == nil || !strings.Contains(err.Error(), "not started") {
+		t.Fatalf("expected the run to fail past its deadline, got %v", err)
+	}
+	if r.states["step:migrate"] != pb.ResourceState_RES_SUCCESS || r.states["step:app"] != pb.ResourceState_RES_ERROR {
+		t.Errorf("expected the steps after migrate to fail, got %v", r.states)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	s, err := Parse([]byte(`
+steps:
+- name: fetch
+  executor: exec
+  retries: 3
+  backoff: 1ms
+- name: lint
+  executor: exec
+  onFailure: continue
+- name: app
+  executor: exec
+  dependsOn: [fetch, lint]
+  timeout: 50ms
+  onFailure: compensate
+  compensate:
+    executor: exec
+    inputs:
+      undo: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r recorder
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	compensated := false
+	runner := r.runner(ExecutorFunc(func(ctx context.Context, step *api.Step, logf func(string, ...interface{})) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if step.Inputs["undo"] == true {
+			compensated = true
+			return nil
+		}
+		calls[step.Name]++
+		switch {
+		case step.Name == "fetch" && calls[step.Name] < 3:
+			return fmt.Errorf("mirror unavailable")
+		case step.Name == "lint":
+			return fmt.Errorf("warnings")
+		case step.Name == "app":
+			mu.Unlock()
+			<-ctx.Done()
+			mu.Lock()
+			return ctx.Err()
+		}
+		return nil
+	}))
+	err = runner.Run(context.Background(), s)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") || !strings.Contains(err.Error(), "compensated") {
+		t.Fatalf("expected app to time out and be compensated, got %v", err)
+	}
+	want := map[string]pb.ResourceState{
+		"step:fetch": pb.ResourceState_RES_SUCCESS,
+		"step:lint":  pb.ResourceState_RES_OTHER,
+		"step:app":   pb.ResourceState_RES_ERROR,
+	}
+	if !reflect.DeepEqual(r.states, want) || !compensated {
+		t.Errorf("expected %v and a compensation, got %v %v", want, r.states, compensated)
+	}
+	if r.attempts["fetch"] != 3 || calls["fetch"] != 3 {
+		t.Errorf("expected fetch to succeed at the third attempt, got %v", r.attempts)
+	}
+	for _, delay := range []time.Duration{time.Second, time.Minute} {
+		if j := jitter(delay); j < delay/2 || j > delay {
+			t.Errorf("jitter of %s out of bounds: %s", delay, j)
+		}
+	}
+
+	// The run ending first is not the timeout of the step
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = runner.attempt(ctx, &api.Step{Name: "app", Executor: "exec", Timeout: "1h"}, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline of the run, got %v", err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	var lines []string
+	logf := func(format string, args ...interface{}) { lines = append(lines, fmt.Sprintf(format, args...)) }
+	step := &api.Step{Name: "hello", Executor: "exec", Inputs: map[string]interface{}{
+		"command": "echo $GREETING; echo done >&2",
+		"env":     map[string]interface{}{"GREETING": "hi"},
+	}}
+	if err := Exec.Execute(context.Background(), step, logf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, ",") != "hi,done" {
+		t.Errorf("unexpected output %q", lines)
+	}
+	step.Inputs = map[string]interface{}{"command": []interface{}{"false"}}
+	if err := Exec.Execute(context.Background(), step, logf); err == nil {
+		t.Error("expected a failing command to fail the step")
+	}
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lockTimeout is how long a lease lock file may exist before it is
+// considered left behind by a crashed process
+const lockTimeout = 10 * time.Second
+
+// File keeps every document in its own file under dir/kind/, writes are
+// atomic so a crash never leaves a half written document behind. Several
+// processes may share dir, leases are guarded by a lock file.
+type File struct {
+	dir string
+}
+
+// NewFile creates a file store rooted at dir
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store dir %s:%v", dir, err)
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) path(kind, key string) string {
+	return filepath.Join(f.dir, kind, url.PathEscape(key)+".json")
+}
+
+func (f *File) Get(kind, key string, v interface{}) error {
+	raw, err := ioutil.ReadFile(f.path(kind, key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (f *File) Put(kind, key string, v interface{}) error {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	dst := f.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (f *File) Delete(kind, key string) error {
+	err := os.Remove(f.path(kind, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (f *File) List(kind string) ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(f.dir, kind))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// lock creates a lock file exclusively, waiting for other processes holding it
+func (f *File) lock(name string) (func(), error) {
+	path := filepath.Join(f.dir, kindLeases, "."+url.PathEscape(name)+".lock")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		lf, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			lf.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockTimeout {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (f *File) Acquire(name string, l Lease) (Lease, error) {
+	unlock, err := f.lock(name)
+	if err != nil {
+		return Lease{}, err
+	}
+	defer unlock()
+	var current *Lease
+	var stored Lease
+	switch err := f.Get(kindLeases, name, &stored); err {
+	case nil:
+		current = &stored
+	case ErrNotFound:
+	default:
+		return Lease{}, err
+	}
+	granted := acquire(current, l, time.Now())
+	if granted.Holder == l.Holder {
+		if err := f.Put(kindLeases, name, &granted); err != nil {
+			return Lease{}, err
+		}
+	}
+	return granted, nil
+}
+
+func (f *File) Release(name, holder string) error {
+	unlock, err := f.lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var current Lease
+	switch err := f.Get(kindLeases, name, &current); err {
+	case nil:
+	case ErrNotFound:
+		return nil
+	default:
+		return err
+	}
+	if current.Holder != holder {
+		return nil
+	}
+	return f.Delete(kindLeases, name)
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory keeps documents in memory, state is lost when the process exits
+type Memory struct {
+	mu   sync.RWMutex
+	data map[string]map[string][]byte
+}
+
+// NewMemory creates an empty memory store
+func NewMemory() *Memory {
+	return &Memory{data: make(map[string]map[string][]byte)}
+}
+
+func (m *Memory) Get(kind, key string, v interface{}) error {
+	m.mu.RLock()
+	raw, ok := m.data[kind][key]
+	m.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (m *Memory) Put(kind, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data[kind] == nil {
+		m.data[kind] = make(map[string][]byte)
+	}
+	m.data[kind][key] = raw
+	return nil
+}
+
+func (m *Memory) Delete(kind, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data[kind], key)
+	return nil
+}
+
+func (m *Memory) List(kind string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.data[kind]))
+	for k := range m.data[kind] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *Memory) Acquire(name string, l Lease) (Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var current *Lease
+	if raw, ok := m.data[kindLeases][name]; ok {
+		current = &Lease{}
+		if err := json.Unmarshal(raw, current); err != nil {
+			return Lease{}, err
+		}
+	}
+	granted := acquire(current, l, time.Now())
+	raw, err := json.Marshal(granted)
+	if err != nil {
+		return Lease{}, err
+	}
+	if m.data[kindLeases] == nil {
+		m.data[kindLeases] = make(map[string][]byte)
+	}
+	m.data[kindLeases][name] = raw
+	return granted, nil
+}
+
+func (m *Memory) Release(name, holder string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	raw, ok := m.data[kindLeases][name]
+	if !ok {
+		return nil
+	}
+	var current Lease
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return err
+	}
+	if current.Holder == holder {
+		delete(m.data[kindLeases], name)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Package store persists deployer state as JSON documents grouped by kind
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a key does not exist
+var ErrNotFound = errors.New("not found")
+
+// Store is a key/value store of JSON documents, keys are scoped by kind
+type Store interface {
+	// Get decodes the document stored under kind/key into v
+	Get(kind, key string, v interface{}) error
+	// Put encodes v and stores it under kind/key
+	Put(kind, key string, v interface{}) error
+	// Delete removes kind/key, it is not an error if it does not exist
+	Delete(kind, key string) error
+	// List returns all keys of given kind in lexical order
+	List(kind string) ([]string, error)
+
+	// Acquire takes lease name for l.Holder, or renews it, unless another
+	// holder's lease is still valid. It returns the lease in effect afterwards.
+	Acquire(name string, l Lease) (Lease, error)
+	// Release gives up lease name if holder owns it
+	Release(name, holder string) error
+}
+
+// Lease grants its holder exclusive ownership of something until it expires
+type Lease struct {
+	Holder string `json:"holder"`
+	// Addr is where the holder can be reached
+	Addr    string    `json:"addr,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// kindLeases keeps leases among the other documents
+const kindLeases = "leases"
+
+// acquire decides the outcome of a lease request given the current lease
+func acquire(current *Lease, l Lease, now time.Time) Lease {
+	if current != nil && current.Holder != l.Holder && now.Before(current.Expires) {
+		return *current
+	}
+	return l
+}
+
+// Open returns a file store rooted at dir, or a memory store if dir is empty
+func Open(dir string) (Store, error) {
+	if dir == "" {
+		return NewMemory(), nil
+	}
+	return NewFile(dir)
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type doc struct {
+	Name  string
+	Count int
+}
+
+func testStore(t *testing.T, s Store) {
+	if err := s.Get("docs", "missing", &doc{}); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	for _, key := range []string{"b", "a/1", "c"} {
+		if err := s.Put("docs", key, &doc{Name: key, Count: len(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var d doc
+	if err := s.Get("docs", "a/1", &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "a/1" || d.Count != 3 {
+		t.Errorf("unexpected document %+v", d)
+	}
+	if err := s.Delete("docs", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("docs", "c"); err != nil {
+		t.Fatalf("deleting twice should not fail: %v", err)
+	}
+	keys, err := s.List("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a/1", "b"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if keys, _ := s.List("none"); len(keys) != 0 {
+		t.Errorf("expected no keys, got %v", keys)
+	}
+}
+
+func testLeases(t *testing.T, s Store) {
+	ttl := 100 * time.Millisecond
+	a := Lease{Holder: "a", Addr: "a:9000", Expires: time.Now().Add(ttl)}
+	if l, err := s.Acquire("leader", a); err != nil || l.Holder != "a" {
+		t.Fatalf("a should take a free lease, got %+v, %v", l, err)
+	}
+	b := Lease{Holder: "b", Expires: time.Now().Add(ttl)}
+	if l, err := s.Acquire("leader", b); err != nil || l.Holder != "a" || l.Addr != "a:9000" {
+		t.Fatalf("b should see the lease of a, got %+v, %v", l, err)
+	}
+	time.Sleep(ttl)
+	b.Expires = time.Now().Add(ttl)
+	if l, err := s.Acquire("leader", b); err != nil || l.Holder != "b" {
+		t.Fatalf("b should take an expired lease, got %+v, %v", l, err)
+	}
+	if err := s.Release("leader", "a"); err != nil {
+		t.Fatal(err)
+	}
+	a.Expires = time.Now().Add(ttl)
+	if l, _ := s.Acquire("leader", a); l.Holder != "b" {
+		t.Fatalf("releasing a lease of someone else should have no effect, got %+v", l)
+	}
+	if err := s.Release("leader", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if l, _ := s.Acquire("leader", a); l.Holder != "a" {
+		t.Fatalf("a should take a released lease, got %+v", l)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+	testLeases(t, NewMemory())
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	testLeases(t, s)
+
+	// A second instance sees what the first one wrote
+	s2, _ := NewFile(dir)
+	var d doc
+	if err := s2.Get("docs", "b", &d); err != nil || d.Name != "b" {
+		t.Errorf("expected persisted document, got %+v, %v", d, err)
+	}
+}
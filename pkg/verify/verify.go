@@ -0,0 +1,229 @@
+// Package verify runs the probes checking that a deployed worker is healthy.
+// Probes run where they are called from, the server for now: HTTP and TCP
+// probes reach workers from the server and exec probes run commands on it.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+const (
+	defaultInterval = 5 * time.Second
+	defaultTimeout  = 10 * time.Second
+	defaultDeadline = time.Minute
+	// maxBody is how much of an HTTP response body is matched
+	maxBody = 1 << 20
+)
+
+// Vars are available to probe templates, such as
+// "http://{{.Host}}:8080/health"
+type Vars struct {
+	Deployment string
+	Target     string
+	Env        string
+	Worker     string
+	// Addr is the host:port the worker registered, Host is its host part
+	Addr   string
+	Host   string
+	Values map[string]interface{}
+}
+
+// Validate checks a probe before it is accepted
+func Validate(p *api.Probe, allowExec bool) error {
+	kinds := 0
+	for _, set := range []bool{p.HTTP != nil, p.TCP != nil, p.Exec != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("probe %s must have exactly one of http, tcp and exec", p.Name)
+	}
+	if p.Exec != nil && !allowExec {
+		return fmt.Errorf("probe %s: exec probes are not allowed by the server", p.Name)
+	}
+	if p.Retries < 0 {
+		return fmt.Errorf("probe %s: retries cannot be negative", p.Name)
+	}
+	for field, value := range map[string]string{"interval": p.Interval, "timeout": p.Timeout, "deadline": p.Deadline} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("probe %s: invalid %s %q", p.Name, field, value)
+		}
+	}
+	if p.HTTP != nil && p.HTTP.Body != "" {
+		if _, err := regexp.Compile(p.HTTP.Body); err != nil {
+			return fmt.Errorf("probe %s: invalid body pattern:%v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func duration(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// Run probes until an attempt succeeds, retries run out or the deadline
+// passes. The error of the last attempt is returned.
+func Run(ctx context.Context, p *api.Probe, vars Vars) error {
+	ctx, cancel := context.WithTimeout(ctx, duration(p.Deadline, defaultDeadline))
+	defer cancel()
+	interval := duration(p.Interval, defaultInterval)
+	timeout := duration(p.Timeout, defaultTimeout)
+	var err error
+	for attempt := 0; attempt <= p.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("deadline exceeded after %d attempts: %v", attempt, err)
+			case <-time.After(interval):
+			}
+		}
+		attemptCtx, cancelAttempt := context.WithTimeout(ctx, timeout)
+		err = probe(attemptCtx, p, vars)
+		cancelAttempt()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func probe(ctx context.Context, p *api.Probe, vars Vars) error {
+	switch {
+	case p.HTTP != nil:
+		return probeHTTP(ctx, p.HTTP, vars)
+	case p.TCP != nil:
+		addr, err := expand(p.TCP.Addr, vars)
+		if err != nil {
+			return err
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case p.Exec != nil:
+		return probeExec(ctx, p.Exec, vars)
+	}
+	return fmt.Errorf("probe %s has nothing to check", p.Name)
+}
+
+func probeHTTP(ctx context.Context, p *api.HTTPProbe, vars Vars) error {
+	url, err := expand(p.URL, vars)
+	if err != nil {
+		return err
+	}
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return err
+	}
+	if p.Status != 0 && resp.StatusCode != p.Status {
+		return fmt.Errorf("%s %s returned %d, expected %d", method, url, resp.StatusCode, p.Status)
+	}
+	if p.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		return fmt.Errorf("%s %s returned %d", method, url, resp.StatusCode)
+	}
+	if p.Body != "" {
+		re, err := regexp.Compile(p.Body)
+		if err != nil {
+			return err
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("%s %s returned a body not matching %q", method, url, p.Body)
+		}
+	}
+	return nil
+}
+
+func probeExec(ctx context.Context, p *api.ExecProbe, vars Vars) error {
+	if len(p.Command) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	args := make([]string, len(p.Command))
+	for i, arg := range p.Command {
+		expanded, err := expand(arg, vars)
+		if err != nil {
+			return err
+		}
+		args[i] = expanded
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"DEPLOYER_DEPLOYMENT="+vars.Deployment,
+		"DEPLOYER_TARGET="+vars.Target,
+		"DEPLOYER_ENV="+vars.Env,
+		"DEPLOYER_WORKER="+vars.Worker,
+		"DEPLOYER_WORKER_ADDR="+vars.Addr,
+	)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		return err
+	}
+	if code != p.ExitCode {
+		return fmt.Errorf("%s exited with %d, expected %d: %s", args[0], code, p.ExitCode, strings.TrimSpace(lastLine(out.String())))
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+func expand(text string, vars Vars) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	t, err := template.New("probe").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
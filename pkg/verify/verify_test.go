@@ -0,0 +1,98 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beacon/deployer/pkg/api"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		probe api.Probe
+		ok    bool
+	}{
+		{api.Probe{Name: "http", HTTP: &api.HTTPProbe{URL: "http://x"}}, true},
+		{api.Probe{Name: "none"}, false},
+		{api.Probe{Name: "both", HTTP: &api.HTTPProbe{URL: "http://x"}, TCP: &api.TCPProbe{Addr: "x:1"}}, false},
+		{api.Probe{Name: "exec", Exec: &api.ExecProbe{Command: []string{"true"}}}, false},
+		{api.Probe{Name: "retries", TCP: &api.TCPProbe{Addr: "x:1"}, Retries: -1}, false},
+		{api.Probe{Name: "timeout", TCP: &api.TCPProbe{Addr: "x:1"}, Timeout: "0s"}, false},
+		{api.Probe{Name: "body", HTTP: &api.HTTPProbe{URL: "http://x", Body: "("}}, false},
+	}
+	for _, test := range tests {
+		if err := Validate(&test.probe, false); (err == nil) != test.ok {
+			t.Errorf("probe %s: expected ok=%v, got %v", test.probe.Name, test.ok, err)
+		}
+	}
+}
+
+func TestRunHTTP(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/w1/health" || calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer ts.Close()
+
+	p := &api.Probe{
+		Name:     "health",
+		HTTP:     &api.HTTPProbe{URL: ts.URL + "/{{.Worker}}/health", Body: `"status":"ok"`},
+		Retries:  2,
+		Interval: "10ms",
+	}
+	if err := Run(context.Background(), p, Vars{Worker: "w1"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+
+	calls = 0
+	p.Retries = 1
+	if err := Run(context.Background(), p, Vars{Worker: "w1"}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the last attempt to fail with 503, got %v", err)
+	}
+
+	p.HTTP.Status = http.StatusNotFound
+	p.Retries = 0
+	if err := Run(context.Background(), p, Vars{Worker: "w1"}); err == nil {
+		t.Error("expected an unexpected status to fail")
+	}
+}
+
+func TestRunTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	p := &api.Probe{Name: "port", TCP: &api.TCPProbe{Addr: "{{.Host}}:" + port}}
+	if err := Run(context.Background(), p, Vars{Host: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if err := Run(context.Background(), p, Vars{Host: "127.0.0.1"}); err == nil {
+		t.Error("expected a closed port to fail")
+	}
+}
+
+func TestRunExec(t *testing.T) {
+	p := &api.Probe{Name: "exec", Exec: &api.ExecProbe{Command: []string{"sh", "-c", `test "$DEPLOYER_WORKER" = {{.Worker}} && exit 3`}, ExitCode: 3}}
+	if err := Run(context.Background(), p, Vars{Worker: "w1"}); err != nil {
+		t.Fatal(err)
+	}
+	p.Exec.ExitCode = 0
+	if err := Run(context.Background(), p, Vars{Worker: "w1"}); err == nil {
+		t.Error("expected an unexpected exit code to fail")
+	}
+}